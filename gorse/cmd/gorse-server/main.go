@@ -43,6 +43,9 @@ var serverCommand = &cobra.Command{
 		httpPort, _ := cmd.PersistentFlags().GetInt("http-port")
 		httpHost, _ := cmd.PersistentFlags().GetString("http-host")
 		s := server.NewServer(masterHost, masterPort, httpHost, httpPort)
+		if feedbackLog, _ := cmd.PersistentFlags().GetString("feedback-log"); feedbackLog != "" {
+			s.EnableFeedbackLog(feedbackLog)
+		}
 		s.Serve()
 	},
 }
@@ -54,6 +57,7 @@ func init() {
 	serverCommand.PersistentFlags().Int("http-port", 8087, "port of RESTful API")
 	serverCommand.PersistentFlags().String("http-host", "127.0.0.1", "host of RESTful API")
 	serverCommand.PersistentFlags().Bool("debug", false, "use debug log mode")
+	serverCommand.PersistentFlags().String("feedback-log", "", "path of local feedback log (disabled if empty)")
 }
 
 func main() {
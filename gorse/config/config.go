@@ -15,6 +15,8 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/BurntSushi/toml"
 )
 
@@ -41,16 +43,18 @@ func (config *Config) LoadDefaultIfNil() *Config {
 
 // DatabaseConfig is the configuration for the database.
 type DatabaseConfig struct {
-	DataStore            string   `toml:"data_store"`              // database for data store
-	CacheStore           string   `toml:"cache_store"`             // database for cache store
-	AutoInsertUser       bool     `toml:"auto_insert_user"`        // insert new users while inserting feedback
-	AutoInsertItem       bool     `toml:"auto_insert_item"`        // insert new items while inserting feedback
-	CacheSize            int      `toml:"cache_size"`              // cache size for recommended/popular/latest items
-	PositiveFeedbackType []string `toml:"positive_feedback_types"` // positive feedback type
-	ClickFeedbackTypes   []string `toml:"click_feedback_types"`    // feedback types for click event
-	ReadFeedbackType     string   `toml:"read_feedback_type"`      // feedback type for read event
-	PositiveFeedbackTTL  uint     `toml:"positive_feedback_ttl"`   // time-to-live of positive feedbacks
-	ItemTTL              uint     `toml:"item_ttl"`                // item-to-live of items
+	DataStore             string             `toml:"data_store"`              // database for data store
+	CacheStore            string             `toml:"cache_store"`             // database for cache store
+	AutoInsertUser        bool               `toml:"auto_insert_user"`        // insert new users while inserting feedback
+	AutoInsertItem        bool               `toml:"auto_insert_item"`        // insert new items while inserting feedback
+	CacheSize             int                `toml:"cache_size"`              // cache size for recommended/popular/latest items
+	PositiveFeedbackType  []string           `toml:"positive_feedback_types"` // positive feedback type
+	ClickFeedbackTypes    []string           `toml:"click_feedback_types"`    // feedback types for click event
+	ReadFeedbackType      string             `toml:"read_feedback_type"`      // feedback type for read event
+	PositiveFeedbackTTL   uint               `toml:"positive_feedback_ttl"`   // time-to-live of positive feedbacks
+	ItemTTL               uint               `toml:"item_ttl"`                // item-to-live of items
+	FeedbackWeights       map[string]float32 `toml:"feedback_weights"`        // weights of feedback types in training
+	NegativeFeedbackTypes []string           `toml:"negative_feedback_types"` // feedback types for explicit negative events
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
@@ -94,14 +98,66 @@ func (config *MasterConfig) LoadDefaultIfNil() *MasterConfig {
 
 // RecommendConfig is the configuration of recommendation setup.
 type RecommendConfig struct {
-	PopularWindow          int    `toml:"popular_window"`
-	FitPeriod              int    `toml:"fit_period"`
-	SearchPeriod           int    `toml:"search_period"`
-	SearchEpoch            int    `toml:"search_epoch"`
-	SearchTrials           int    `toml:"search_trials"`
-	RefreshRecommendPeriod int    `toml:"refresh_recommend_period"`
-	FallbackRecommend      string `toml:"fallback_recommend"`
-	ExploreLatestNum       int    `toml:"explore_latest_num"`
+	PopularWindow             int                `toml:"popular_window"`
+	FitPeriod                 int                `toml:"fit_period"`
+	SearchPeriod              int                `toml:"search_period"`
+	SearchEpoch               int                `toml:"search_epoch"`
+	SearchTrials              int                `toml:"search_trials"`
+	SearchMethod              string             `toml:"search_method"`
+	RefreshRecommendPeriod    int                `toml:"refresh_recommend_period"`
+	FallbackRecommend         string             `toml:"fallback_recommend"`
+	ExploreLatestNum          int                `toml:"explore_latest_num"`
+	Stages                    []StageConfig      `toml:"stages"`                      // stages of the online recommendation pipeline
+	DiversityLambda           float32            `toml:"diversity_lambda"`            // trade-off of label diversity in re-ranking (0 means disabled)
+	MaxItemsPerLabel          int                `toml:"max_items_per_label"`         // max number of recommended items with a label (0 means unlimited)
+	PinnedItems               []string           `toml:"pinned_items"`                // items pinned at the top of recommendation
+	BoostedItems              map[string]float32 `toml:"boosted_items"`               // items boosted by factors in re-ranking
+	SessionSize               int                `toml:"session_size"`                // number of recent feedback used by session recommendation
+	SessionWeight             float32            `toml:"session_weight"`              // weight of session items versus collaborative filtering items
+	EnableIndex               bool               `toml:"enable_index"`                // retrieve candidates from vector index for matrix factorization
+	IndexClusters             int                `toml:"index_clusters"`              // number of clusters in vector index (0 means auto)
+	IndexProbes               int                `toml:"index_probes"`                // number of clusters probed in vector index (0 means auto)
+	IndexMinRecall            float32            `toml:"index_min_recall"`            // min recall of vector index, otherwise all items are scored
+	NeighborType              string             `toml:"neighbor_type"`               // source of similarity between items
+	FeedbackWeight            float32            `toml:"feedback_weight"`             // weight of feedback similarity in hybrid neighbors
+	EmbeddingWeight           float32            `toml:"embedding_weight"`            // weight of embedding similarity in hybrid neighbors
+	LabelWeight               float32            `toml:"label_weight"`                // weight of label similarity in hybrid neighbors
+	EnableIncrementalNeighbor bool               `toml:"enable_incremental_neighbor"` // update neighbors of changed items only
+	FullNeighborPeriod        int                `toml:"full_neighbor_period"`        // period of updating neighbors of all items (minutes)
+	UserNeighborPeriod        int                `toml:"user_neighbor_period"`        // period of updating neighbors of users (minutes)
+	TrendingDecay             string             `toml:"trending_decay"`              // decay function of trending scores
+	TrendingDecayRate         float32            `toml:"trending_decay_rate"`         // decay rate of exponential decay (per day)
+	TrendingHalfLife          float32            `toml:"trending_half_life"`          // half life of half-life decay (days)
+	TrendingWeights           map[string]float32 `toml:"trending_weights"`            // weights of feedback types in trending scores
+	NegativeNeighborWeight    float32            `toml:"negative_neighbor_weight"`    // weight of neighbors of items with negative feedback
+	EarlyStoppingPatience     int                `toml:"early_stopping_patience"`     // number of evaluations without improvement before stopping fitting (0 means disabled)
+	EASEMaxItems              int                `toml:"ease_max_items"`              // max number of items to search EASE (0 means EASE is disabled)
+	SLIMMaxItems              int                `toml:"slim_max_items"`              // max number of items to search SLIM (0 means SLIM is disabled)
+}
+
+const (
+	NeighborTypeFeedback  = "feedback"  // items are similar if they are liked by the same users
+	NeighborTypeEmbedding = "embedding" // items are similar if their factors in the ranking model are close
+	NeighborTypeLabel     = "label"     // items are similar if they share labels
+	NeighborTypeHybrid    = "hybrid"    // weighted sum of above similarities
+)
+
+const (
+	SearchMethodRandom = "random" // sample hyper-parameters from candidates at random
+	SearchMethodTPE    = "tpe"    // suggest hyper-parameters by the tree-structured Parzen estimator
+)
+
+const (
+	TrendingDecayExponential = "exponential" // weight of feedback is exp(-rate * age)
+	TrendingDecayHalfLife    = "half-life"   // weight of feedback halves every half life
+)
+
+// StageConfig is the configuration of a stage in the online recommendation pipeline.
+type StageConfig struct {
+	Name   string  `toml:"name"`   // name of the registered recommender
+	Label  string  `toml:"label"`  // label of items for popular-by-label and latest-by-label
+	Weight float32 `toml:"weight"` // weight multiplied to scores from this stage, consecutive weighted stages are blended
+	Quota  int     `toml:"quota"`  // max number of items from this stage (unlimited if not set)
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
@@ -113,9 +169,25 @@ func (config *RecommendConfig) LoadDefaultIfNil() *RecommendConfig {
 			SearchPeriod:           180,
 			SearchEpoch:            100,
 			SearchTrials:           10,
+			SearchMethod:           SearchMethodRandom,
 			RefreshRecommendPeriod: 5,
 			FallbackRecommend:      "latest",
 			ExploreLatestNum:       10,
+			SessionSize:            10,
+			SessionWeight:          0.5,
+			IndexMinRecall:         0.9,
+			NeighborType:           NeighborTypeFeedback,
+			FeedbackWeight:         1,
+			EmbeddingWeight:        1,
+			LabelWeight:            1,
+			FullNeighborPeriod:     1440,
+			UserNeighborPeriod:     1440,
+			TrendingDecay:          TrendingDecayHalfLife,
+			TrendingDecayRate:      0.1,
+			TrendingHalfLife:       7,
+			NegativeNeighborWeight: 1,
+			EASEMaxItems:           5000,
+			SLIMMaxItems:           10000,
 		}
 	}
 	return config
@@ -123,15 +195,21 @@ func (config *RecommendConfig) LoadDefaultIfNil() *RecommendConfig {
 
 // ServerConfig is the configuration for the server.
 type ServerConfig struct {
-	APIKey   string `toml:"api_key"`   // default number of returned items
-	DefaultN int    `toml:"default_n"` // secret key for RESTful APIs (SSL required)
+	APIKey           string `toml:"api_key"`            // default number of returned items
+	DefaultN         int    `toml:"default_n"`          // secret key for RESTful APIs (SSL required)
+	IngestBatchSize  int    `toml:"ingest_batch_size"`  // number of feedback written in a batch by streaming ingestion
+	IngestMaxPending int    `toml:"ingest_max_pending"` // max number of batches being written by streaming ingestion
+	IngestTimeout    int    `toml:"ingest_timeout"`     // time to wait for a pending batch before rejecting ingestion (seconds)
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
 func (config *ServerConfig) LoadDefaultIfNil() *ServerConfig {
 	if config == nil {
 		return &ServerConfig{
-			DefaultN: 10,
+			DefaultN:         10,
+			IngestBatchSize:  1000,
+			IngestMaxPending: 4,
+			IngestTimeout:    5,
 		}
 	}
 	return config
@@ -181,6 +259,15 @@ func (config *Config) FillDefault(meta toml.MetaData) {
 	if !meta.IsDefined("server", "default_n") {
 		config.Server.DefaultN = defaultServerConfig.DefaultN
 	}
+	if !meta.IsDefined("server", "ingest_batch_size") {
+		config.Server.IngestBatchSize = defaultServerConfig.IngestBatchSize
+	}
+	if !meta.IsDefined("server", "ingest_max_pending") {
+		config.Server.IngestMaxPending = defaultServerConfig.IngestMaxPending
+	}
+	if !meta.IsDefined("server", "ingest_timeout") {
+		config.Server.IngestTimeout = defaultServerConfig.IngestTimeout
+	}
 	// Default recommend config
 	defaultRecommendConfig := *(*RecommendConfig)(nil).LoadDefaultIfNil()
 	if !meta.IsDefined("recommend", "popular_window") {
@@ -198,6 +285,9 @@ func (config *Config) FillDefault(meta toml.MetaData) {
 	if !meta.IsDefined("recommend", "search_trials") {
 		config.Recommend.SearchTrials = defaultRecommendConfig.SearchTrials
 	}
+	if !meta.IsDefined("recommend", "search_method") {
+		config.Recommend.SearchMethod = defaultRecommendConfig.SearchMethod
+	}
 	if !meta.IsDefined("recommend", "refresh_recommend_period") {
 		config.Recommend.RefreshRecommendPeriod = defaultRecommendConfig.RefreshRecommendPeriod
 	}
@@ -207,6 +297,77 @@ func (config *Config) FillDefault(meta toml.MetaData) {
 	if !meta.IsDefined("recommend", "explore_latest_num") {
 		config.Recommend.ExploreLatestNum = defaultRecommendConfig.ExploreLatestNum
 	}
+	if !meta.IsDefined("recommend", "session_size") {
+		config.Recommend.SessionSize = defaultRecommendConfig.SessionSize
+	}
+	if !meta.IsDefined("recommend", "session_weight") {
+		config.Recommend.SessionWeight = defaultRecommendConfig.SessionWeight
+	}
+	if !meta.IsDefined("recommend", "index_min_recall") {
+		config.Recommend.IndexMinRecall = defaultRecommendConfig.IndexMinRecall
+	}
+	if !meta.IsDefined("recommend", "neighbor_type") {
+		config.Recommend.NeighborType = defaultRecommendConfig.NeighborType
+	}
+	if !meta.IsDefined("recommend", "feedback_weight") {
+		config.Recommend.FeedbackWeight = defaultRecommendConfig.FeedbackWeight
+	}
+	if !meta.IsDefined("recommend", "embedding_weight") {
+		config.Recommend.EmbeddingWeight = defaultRecommendConfig.EmbeddingWeight
+	}
+	if !meta.IsDefined("recommend", "label_weight") {
+		config.Recommend.LabelWeight = defaultRecommendConfig.LabelWeight
+	}
+	if !meta.IsDefined("recommend", "full_neighbor_period") {
+		config.Recommend.FullNeighborPeriod = defaultRecommendConfig.FullNeighborPeriod
+	}
+	if !meta.IsDefined("recommend", "user_neighbor_period") {
+		config.Recommend.UserNeighborPeriod = defaultRecommendConfig.UserNeighborPeriod
+	}
+	if !meta.IsDefined("recommend", "trending_decay") {
+		config.Recommend.TrendingDecay = defaultRecommendConfig.TrendingDecay
+	}
+	if !meta.IsDefined("recommend", "trending_decay_rate") {
+		config.Recommend.TrendingDecayRate = defaultRecommendConfig.TrendingDecayRate
+	}
+	if !meta.IsDefined("recommend", "trending_half_life") {
+		config.Recommend.TrendingHalfLife = defaultRecommendConfig.TrendingHalfLife
+	}
+	if !meta.IsDefined("recommend", "negative_neighbor_weight") {
+		config.Recommend.NegativeNeighborWeight = defaultRecommendConfig.NegativeNeighborWeight
+	}
+	if !meta.IsDefined("recommend", "ease_max_items") {
+		config.Recommend.EASEMaxItems = defaultRecommendConfig.EASEMaxItems
+	}
+	if !meta.IsDefined("recommend", "slim_max_items") {
+		config.Recommend.SLIMMaxItems = defaultRecommendConfig.SLIMMaxItems
+	}
+}
+
+// Validate checks settings which only accept a set of values or positive values.
+func (config *Config) Validate() error {
+	if config.Server.IngestBatchSize <= 0 {
+		return fmt.Errorf("ingest batch size should be positive (got %d)", config.Server.IngestBatchSize)
+	}
+	if config.Server.IngestMaxPending <= 0 {
+		return fmt.Errorf("max pending batches of ingestion should be positive (got %d)", config.Server.IngestMaxPending)
+	}
+	switch config.Recommend.SearchMethod {
+	case SearchMethodRandom, SearchMethodTPE:
+	default:
+		return fmt.Errorf("invalid search method %q (random/tpe)", config.Recommend.SearchMethod)
+	}
+	switch config.Recommend.TrendingDecay {
+	case TrendingDecayExponential, TrendingDecayHalfLife:
+	default:
+		return fmt.Errorf("invalid trending decay %q (exponential/half-life)", config.Recommend.TrendingDecay)
+	}
+	switch config.Recommend.NeighborType {
+	case NeighborTypeFeedback, NeighborTypeEmbedding, NeighborTypeLabel, NeighborTypeHybrid:
+	default:
+		return fmt.Errorf("invalid neighbor type %q (feedback/embedding/label/hybrid)", config.Recommend.NeighborType)
+	}
+	return nil
 }
 
 // LoadConfig loads configuration from toml file.
@@ -217,5 +378,8 @@ func LoadConfig(path string) (*Config, *toml.MetaData, error) {
 		return nil, nil, err
 	}
 	conf.FillDefault(metaData)
+	if err = conf.Validate(); err != nil {
+		return nil, nil, err
+	}
 	return &conf, &metaData, nil
 }
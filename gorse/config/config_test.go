@@ -14,6 +14,9 @@
 package config
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/BurntSushi/toml"
@@ -35,6 +38,8 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, "read", config.Database.ReadFeedbackType)
 	assert.Equal(t, uint(0), config.Database.PositiveFeedbackTTL)
 	assert.Equal(t, uint(0), config.Database.ItemTTL)
+	assert.Equal(t, map[string]float32{}, config.Database.FeedbackWeights)
+	assert.Equal(t, []string{}, config.Database.NegativeFeedbackTypes)
 
 	// master configuration
 	assert.Equal(t, 8086, config.Master.Port)
@@ -48,6 +53,9 @@ func TestLoadConfig(t *testing.T) {
 	// server configuration
 	assert.Equal(t, 20, config.Server.DefaultN)
 	assert.Equal(t, "", config.Server.APIKey)
+	assert.Equal(t, 1000, config.Server.IngestBatchSize)
+	assert.Equal(t, 4, config.Server.IngestMaxPending)
+	assert.Equal(t, 5, config.Server.IngestTimeout)
 
 	// recommend configuration
 	assert.Equal(t, 365, config.Recommend.PopularWindow)
@@ -55,9 +63,35 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, 60, config.Recommend.SearchPeriod)
 	assert.Equal(t, 100, config.Recommend.SearchEpoch)
 	assert.Equal(t, 10, config.Recommend.SearchTrials)
+	assert.Equal(t, SearchMethodRandom, config.Recommend.SearchMethod)
 	assert.Equal(t, 1, config.Recommend.RefreshRecommendPeriod)
 	assert.Equal(t, "latest", config.Recommend.FallbackRecommend)
 	assert.Equal(t, 20, config.Recommend.ExploreLatestNum)
+	assert.Equal(t, float32(0), config.Recommend.DiversityLambda)
+	assert.Equal(t, 0, config.Recommend.MaxItemsPerLabel)
+	assert.Equal(t, []string{}, config.Recommend.PinnedItems)
+	assert.Equal(t, map[string]float32{}, config.Recommend.BoostedItems)
+	assert.Equal(t, 10, config.Recommend.SessionSize)
+	assert.Equal(t, float32(0.5), config.Recommend.SessionWeight)
+	assert.False(t, config.Recommend.EnableIndex)
+	assert.Equal(t, 0, config.Recommend.IndexClusters)
+	assert.Equal(t, 0, config.Recommend.IndexProbes)
+	assert.Equal(t, float32(0.9), config.Recommend.IndexMinRecall)
+	assert.Equal(t, NeighborTypeFeedback, config.Recommend.NeighborType)
+	assert.Equal(t, float32(1), config.Recommend.FeedbackWeight)
+	assert.Equal(t, float32(1), config.Recommend.EmbeddingWeight)
+	assert.Equal(t, float32(1), config.Recommend.LabelWeight)
+	assert.False(t, config.Recommend.EnableIncrementalNeighbor)
+	assert.Equal(t, 1440, config.Recommend.FullNeighborPeriod)
+	assert.Equal(t, 1440, config.Recommend.UserNeighborPeriod)
+	assert.Equal(t, TrendingDecayHalfLife, config.Recommend.TrendingDecay)
+	assert.Equal(t, float32(0.1), config.Recommend.TrendingDecayRate)
+	assert.Equal(t, float32(7), config.Recommend.TrendingHalfLife)
+	assert.Equal(t, map[string]float32{}, config.Recommend.TrendingWeights)
+	assert.Equal(t, float32(1), config.Recommend.NegativeNeighborWeight)
+	assert.Equal(t, 0, config.Recommend.EarlyStoppingPatience)
+	assert.Equal(t, 5000, config.Recommend.EASEMaxItems)
+	assert.Equal(t, 10000, config.Recommend.SLIMMaxItems)
 }
 
 func TestConfig_FillDefault(t *testing.T) {
@@ -67,3 +101,64 @@ func TestConfig_FillDefault(t *testing.T) {
 	config.FillDefault(meta)
 	assert.Equal(t, *(*Config)(nil).LoadDefaultIfNil(), config)
 }
+
+func TestConfig_Stages(t *testing.T) {
+	var config Config
+	meta, err := toml.Decode(`
+[[recommend.stages]]
+name = "collaborative"
+quota = 10
+[[recommend.stages]]
+name = "popular-by-label"
+label = "a"
+weight = 0.5
+`, &config)
+	assert.Nil(t, err)
+	config.FillDefault(meta)
+	assert.Equal(t, []StageConfig{
+		{Name: "collaborative", Quota: 10},
+		{Name: "popular-by-label", Label: "a", Weight: 0.5},
+	}, config.Recommend.Stages)
+	assert.Equal(t, "latest", config.Recommend.FallbackRecommend)
+}
+
+func TestConfig_SearchMethod(t *testing.T) {
+	var config Config
+	meta, err := toml.Decode(`
+[recommend]
+search_method = "tpe"
+`, &config)
+	assert.Nil(t, err)
+	config.FillDefault(meta)
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, SearchMethodTPE, config.Recommend.SearchMethod)
+	// unknown search method
+	path := filepath.Join(os.TempDir(), "TestConfig_SearchMethod.toml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("[recommend]\nsearch_method = \"grid\"\n"), 0644))
+	defer os.Remove(path)
+	_, _, err = LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config := *(*Config)(nil).LoadDefaultIfNil()
+	assert.Nil(t, config.Validate())
+	// unknown trending decay
+	config.Recommend.TrendingDecay = "linear"
+	assert.Error(t, config.Validate())
+	config.Recommend.TrendingDecay = TrendingDecayExponential
+	assert.Nil(t, config.Validate())
+	// unknown neighbor type
+	config.Recommend.NeighborType = "random"
+	assert.Error(t, config.Validate())
+	config.Recommend.NeighborType = NeighborTypeHybrid
+	assert.Nil(t, config.Validate())
+	// non-positive ingestion settings
+	config.Server.IngestBatchSize = 0
+	assert.Error(t, config.Validate())
+	config.Server.IngestBatchSize = 1000
+	config.Server.IngestMaxPending = -1
+	assert.Error(t, config.Validate())
+	config.Server.IngestMaxPending = 4
+	assert.Nil(t, config.Validate())
+}
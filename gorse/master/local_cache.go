@@ -44,6 +44,20 @@ type LocalCache struct {
 // If the click model is invalid, ClickModel == nil.
 func LoadLocalCache(path string) (*LocalCache, error) {
 	base.Logger().Info("load cache", zap.String("path", path))
+	state, err := loadLocalCache(path, false)
+	if err == errInterfaceClickModel {
+		// click models were encoded as concrete factorization machines in earlier versions
+		state, err = loadLocalCache(path, true)
+	}
+	return state, err
+}
+
+// errInterfaceClickModel is returned if the click model in local cache isn't encoded as an interface.
+var errInterfaceClickModel = errors.New("failed to load click model")
+
+// loadLocalCache loads local cache from a file. The click model is decoded as a concrete factorization machine
+// if legacyClickModel is set.
+func loadLocalCache(path string, legacyClickModel bool) (*LocalCache, error) {
 	state := &LocalCache{path: path}
 	// check if file exists
 	if _, err := os.Stat(path); err != nil {
@@ -103,10 +117,14 @@ func LoadLocalCache(path string) (*LocalCache, error) {
 		return state, errors.Wrap(err, "failed to load click model score")
 	}
 	// 9. click model
-	state.ClickModel = click.NewFM(click.FMClassification, nil)
-	err = decoder.Decode(state.ClickModel)
-	if err != nil {
-		return state, errors.Wrap(err, "failed to load click model")
+	if legacyClickModel {
+		fm := click.NewFM(click.FMClassification, nil)
+		if err = decoder.Decode(fm); err != nil {
+			return state, errors.Wrap(err, "failed to load click model")
+		}
+		state.ClickModel = fm
+	} else if err = decoder.Decode(&state.ClickModel); err != nil {
+		return state, errInterfaceClickModel
 	}
 	state.ClickModel.SetParams(state.ClickModel.GetParams())
 	return state, nil
@@ -170,7 +188,7 @@ func (c *LocalCache) WriteLocalCache() error {
 		return errors.Wrap(err, "failed to write click model score")
 	}
 	// 9. click model
-	err = encoder.Encode(c.ClickModel)
+	err = encoder.Encode(&c.ClickModel)
 	if err != nil {
 		return errors.Wrap(err, "failed to write click model")
 	}
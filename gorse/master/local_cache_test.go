@@ -15,6 +15,7 @@
 package master
 
 import (
+	"encoding/gob"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/model"
@@ -93,3 +94,35 @@ func TestLocalCache(t *testing.T) {
 	// delete test file
 	assert.NoError(t, os.Remove(path))
 }
+
+func TestLocalCache_LegacyClickModel(t *testing.T) {
+	// delete test file if exists
+	path := filepath.Join(os.TempDir(), "TestLocalCache_LegacyClickModel")
+	_ = os.Remove(path)
+
+	// write local cache with a concrete factorization machine
+	trainSet, testSet := newRankingDataset()
+	bpr := ranking.NewBPR(model.Params{model.NEpochs: 0})
+	bpr.Fit(trainSet, testSet, nil)
+	train, test := newClickDataset()
+	fm := click.NewFM(click.FMClassification, model.Params{model.NEpochs: 0})
+	fm.Fit(train, test, nil)
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	encoder := gob.NewEncoder(f)
+	for _, v := range []interface{}{"bpr", int64(123), bpr, ranking.Score{}, int64(789), bpr.UserIndex,
+		int64(456), click.Score{Precision: 1, Task: click.FMClassification}, fm} {
+		assert.NoError(t, encoder.Encode(v))
+	}
+	assert.NoError(t, f.Close())
+
+	read, err := LoadLocalCache(path)
+	assert.NoError(t, err)
+	assert.NotNil(t, read.RankingModel)
+	assert.Equal(t, int64(456), read.ClickModelVersion)
+	assert.IsType(t, &click.FM{}, read.ClickModel)
+	assert.Equal(t, fm.GetParams(), read.ClickModel.GetParams())
+
+	// delete test file
+	assert.NoError(t, os.Remove(path))
+}
@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/ReneKroon/ttlcache/v2"
+	"github.com/scylladb/go-set/strset"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/model/ranking"
@@ -56,6 +57,7 @@ type Master struct {
 	// ranking dataset
 	rankingItems     []data.Item
 	rankingFeedbacks []data.Feedback
+	trendingFeedback []data.Feedback
 	rankingTrainSet  *ranking.DataSet
 	rankingTestSet   *ranking.DataSet
 	rankingFullSet   *ranking.DataSet
@@ -81,6 +83,9 @@ type Master struct {
 	clickModelMutex    sync.RWMutex
 	clickModelSearcher *click.ModelSearcher
 
+	// feedback of items and users when neighbors of items are updated
+	neighborSnapshot *neighborSnapshot
+
 	localCache *LocalCache
 
 	// events
@@ -103,13 +108,19 @@ func NewMaster(cfg *config.Config) *Master {
 		rankingModelSearcher: ranking.NewModelSearcher(
 			cfg.Recommend.SearchEpoch,
 			cfg.Recommend.SearchTrials,
-			cfg.Master.SearchJobs),
+			cfg.Master.SearchJobs,
+			cfg.Recommend.EarlyStoppingPatience,
+			cfg.Recommend.EASEMaxItems,
+			cfg.Recommend.SLIMMaxItems,
+			cfg.Recommend.SearchMethod == config.SearchMethodTPE),
 		// default click model
 		clickModel: click.NewFM(click.FMClassification, nil),
 		clickModelSearcher: click.NewModelSearcher(
 			cfg.Recommend.SearchEpoch,
 			cfg.Recommend.SearchTrials,
 			cfg.Master.SearchJobs,
+			cfg.Recommend.EarlyStoppingPatience,
+			cfg.Recommend.SearchMethod == config.SearchMethodTPE,
 		),
 		RestServer: server.RestServer{
 			GorseConfig: cfg,
@@ -331,7 +342,8 @@ func (m *Master) hasFeedbackInserted() bool {
 func (m *Master) loadRankingDataset() error {
 	base.Logger().Info("load ranking dataset",
 		zap.Strings("positive_feedback_types", m.GorseConfig.Database.PositiveFeedbackType))
-	rankingDataset, rankingItems, rankingFeedbacks, err := ranking.LoadDataFromDatabase(m.DataClient, m.GorseConfig.Database.PositiveFeedbackType,
+	rankingDataset, rankingItems, rankingFeedbacks, err := ranking.LoadDataFromDatabase(m.DataClient,
+		m.GorseConfig.Database.PositiveFeedbackType, m.GorseConfig.Database.NegativeFeedbackTypes, m.GorseConfig.Database.FeedbackWeights,
 		m.GorseConfig.Database.ItemTTL, m.GorseConfig.Database.PositiveFeedbackTTL)
 	if err != nil {
 		return err
@@ -345,22 +357,55 @@ func (m *Master) loadRankingDataset() error {
 	if err = m.CacheClient.SetString(cache.GlobalMeta, cache.NumPositiveFeedback, strconv.Itoa(rankingDataset.Count())); err != nil {
 		base.Logger().Error("failed to write meta", zap.Error(err))
 	}
+	trendingFeedback, err := m.loadTrendingFeedback()
+	if err != nil {
+		return err
+	}
+	m.hidden(rankingItems)
 	m.rankingModelMutex.Lock()
 	m.rankingItems = rankingItems
 	m.rankingFeedbacks = rankingFeedbacks
+	m.trendingFeedback = trendingFeedback
 	m.rankingFullSet = rankingDataset
 	m.rankingTrainSet, m.rankingTestSet = rankingDataset.Split(0, 0)
 	m.rankingModelMutex.Unlock()
 	return nil
 }
 
+// loadTrendingFeedback loads feedback counted in trending items, which are positive feedback and feedback of types
+// weighted in trending scores. Feedback isn't expired by the time-to-live of positive feedback but skipped once its
+// weight is decayed to be negligible.
+func (m *Master) loadTrendingFeedback() ([]data.Feedback, error) {
+	feedbackTypes := strset.New(m.GorseConfig.Database.PositiveFeedbackType...)
+	for feedbackType := range m.GorseConfig.Recommend.TrendingWeights {
+		feedbackTypes.Add(feedbackType)
+	}
+	const batchSize = 1024
+	timeLimit := m.trendingTimeLimit()
+	var cursor string
+	var trendingFeedback []data.Feedback
+	for {
+		var feedback []data.Feedback
+		var err error
+		cursor, feedback, err = m.DataClient.GetFeedback(cursor, batchSize, timeLimit, feedbackTypes.List()...)
+		if err != nil {
+			return nil, err
+		}
+		trendingFeedback = append(trendingFeedback, feedback...)
+		if cursor == "" {
+			return trendingFeedback, nil
+		}
+	}
+}
+
 func (m *Master) loadClickDataset() error {
 	base.Logger().Info("load click dataset",
 		zap.Strings("click_feedback_types", m.GorseConfig.Database.ClickFeedbackTypes),
 		zap.String("read_feedback_type", m.GorseConfig.Database.ReadFeedbackType))
 	clickDataset, err := click.LoadDataFromDatabase(m.DataClient,
 		m.GorseConfig.Database.ClickFeedbackTypes,
-		m.GorseConfig.Database.ReadFeedbackType)
+		m.GorseConfig.Database.ReadFeedbackType,
+		m.GorseConfig.Database.FeedbackWeights)
 	if err != nil {
 		return err
 	}
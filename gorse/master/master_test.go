@@ -14,13 +14,16 @@
 package master
 
 import (
+	"encoding/json"
 	"github.com/alicebob/miniredis/v2"
+	"github.com/chewxy/math32"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
+	"math"
 	"math/rand"
 	"strconv"
 	"testing"
@@ -63,34 +66,34 @@ func TestMaster_CollectLatest(t *testing.T) {
 	m.GorseConfig.Database.CacheSize = 3
 	// collect latest
 	items := []data.Item{
-		{"0", time.Date(2000, 1, 1, 1, 1, 0, 0, time.UTC), []string{"even"}, ""},
-		{"1", time.Date(2001, 1, 1, 1, 1, 0, 0, time.UTC), []string{"odd"}, ""},
-		{"2", time.Date(2002, 1, 1, 1, 1, 0, 0, time.UTC), []string{"even"}, ""},
-		{"3", time.Date(2003, 1, 1, 1, 1, 0, 0, time.UTC), []string{"odd"}, ""},
-		{"4", time.Date(2004, 1, 1, 1, 1, 0, 0, time.UTC), []string{"even"}, ""},
-		{"5", time.Date(2005, 1, 1, 1, 1, 0, 0, time.UTC), []string{"odd"}, ""},
-		{"6", time.Date(2006, 1, 1, 1, 1, 0, 0, time.UTC), []string{"even"}, ""},
-		{"7", time.Date(2007, 1, 1, 1, 1, 0, 0, time.UTC), []string{"odd"}, ""},
-		{"8", time.Date(2008, 1, 1, 1, 1, 0, 0, time.UTC), []string{"even"}, ""},
-		{"9", time.Date(2009, 1, 1, 1, 1, 0, 0, time.UTC), []string{"odd"}, ""},
+		{ItemId: "0", Timestamp: time.Date(2000, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"even"}},
+		{ItemId: "1", Timestamp: time.Date(2001, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"odd"}},
+		{ItemId: "2", Timestamp: time.Date(2002, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"even"}},
+		{ItemId: "3", Timestamp: time.Date(2003, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"odd"}},
+		{ItemId: "4", Timestamp: time.Date(2004, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"even"}},
+		{ItemId: "5", Timestamp: time.Date(2005, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"odd"}},
+		{ItemId: "6", Timestamp: time.Date(2006, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"even"}},
+		{ItemId: "7", Timestamp: time.Date(2007, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"odd"}},
+		{ItemId: "8", Timestamp: time.Date(2008, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"even"}},
+		{ItemId: "9", Timestamp: time.Date(2009, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"odd"}},
 	}
 	m.latest(items)
 	// check latest items
-	latest, err := m.CacheClient.GetScores(cache.LatestItems, "", 0, 100)
+	latest, err := m.CacheClient.GetSortedScores(cache.LatestItems, "", 0, 100)
 	assert.Nil(t, err)
 	assert.Equal(t, []cache.ScoredItem{
 		{items[9].ItemId, float32(items[9].Timestamp.Unix())},
 		{items[8].ItemId, float32(items[8].Timestamp.Unix())},
 		{items[7].ItemId, float32(items[7].Timestamp.Unix())},
 	}, latest)
-	latest, err = m.CacheClient.GetScores(cache.LatestItems, "even", 0, 100)
+	latest, err = m.CacheClient.GetSortedScores(cache.LatestItems, "even", 0, 100)
 	assert.Nil(t, err)
 	assert.Equal(t, []cache.ScoredItem{
 		{items[8].ItemId, float32(items[8].Timestamp.Unix())},
 		{items[6].ItemId, float32(items[6].Timestamp.Unix())},
 		{items[4].ItemId, float32(items[4].Timestamp.Unix())},
 	}, latest)
-	latest, err = m.CacheClient.GetScores(cache.LatestItems, "odd", 0, 100)
+	latest, err = m.CacheClient.GetSortedScores(cache.LatestItems, "odd", 0, 100)
 	assert.Nil(t, err)
 	assert.Equal(t, []cache.ScoredItem{
 		{items[9].ItemId, float32(items[9].Timestamp.Unix())},
@@ -109,16 +112,16 @@ func TestMaster_CollectPopItem(t *testing.T) {
 	m.GorseConfig.Recommend.PopularWindow = 365
 	// collect latest
 	items := []data.Item{
-		{"0", time.Now(), []string{"even"}, ""},
-		{"1", time.Now(), []string{"odd"}, ""},
-		{"2", time.Now(), []string{"even"}, ""},
-		{"3", time.Now(), []string{"odd"}, ""},
-		{"4", time.Now(), []string{"even"}, ""},
-		{"5", time.Now(), []string{"odd"}, ""},
-		{"6", time.Now(), []string{"even"}, ""},
-		{"7", time.Now(), []string{"odd"}, ""},
-		{"8", time.Now(), []string{"even"}, ""},
-		{"9", time.Now(), []string{"odd"}, ""},
+		{ItemId: "0", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "1", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "2", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "3", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "4", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "5", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "6", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "7", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "8", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "9", Timestamp: time.Now(), Labels: []string{"odd"}},
 	}
 	feedbacks := make([]data.Feedback, 0)
 	for i := 0; i < 10; i++ {
@@ -143,21 +146,21 @@ func TestMaster_CollectPopItem(t *testing.T) {
 	}
 	m.popItem(items, feedbacks)
 	// check popular items
-	popular, err := m.CacheClient.GetScores(cache.PopularItems, "", 0, 100)
+	popular, err := m.CacheClient.GetSortedScores(cache.PopularItems, "", 0, 100)
 	assert.Nil(t, err)
 	assert.Equal(t, []cache.ScoredItem{
 		{ItemId: items[9].ItemId, Score: 10},
 		{ItemId: items[8].ItemId, Score: 9},
 		{ItemId: items[7].ItemId, Score: 8},
 	}, popular)
-	popular, err = m.CacheClient.GetScores(cache.PopularItems, "even", 0, 100)
+	popular, err = m.CacheClient.GetSortedScores(cache.PopularItems, "even", 0, 100)
 	assert.Nil(t, err)
 	assert.Equal(t, []cache.ScoredItem{
 		{ItemId: items[8].ItemId, Score: 9},
 		{ItemId: items[6].ItemId, Score: 7},
 		{ItemId: items[4].ItemId, Score: 5},
 	}, popular)
-	popular, err = m.CacheClient.GetScores(cache.PopularItems, "odd", 0, 100)
+	popular, err = m.CacheClient.GetSortedScores(cache.PopularItems, "odd", 0, 100)
 	assert.Nil(t, err)
 	assert.Equal(t, []cache.ScoredItem{
 		{ItemId: items[9].ItemId, Score: 10},
@@ -166,6 +169,222 @@ func TestMaster_CollectPopItem(t *testing.T) {
 	}, popular)
 }
 
+func TestMaster_CollectTrending(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Recommend.TrendingDecay = config.TrendingDecayHalfLife
+	m.GorseConfig.Recommend.TrendingHalfLife = 1
+	m.GorseConfig.Recommend.TrendingWeights = map[string]float32{"star": 3}
+	items := []data.Item{
+		{ItemId: "0", Labels: []string{"even"}},
+		{ItemId: "1", Labels: []string{"odd"}},
+		{ItemId: "2", Labels: []string{"even"}},
+		{ItemId: "3", Labels: []string{"odd"}},
+	}
+	// item 0: 4 feedback two days ago, item 1: 2 feedback now,
+	// item 2: 1 feedback one day ago, item 3: 1 weighted feedback now
+	feedbacks := make([]data.Feedback, 0)
+	for i := 0; i < 4; i++ {
+		feedbacks = append(feedbacks, data.Feedback{
+			FeedbackKey: data.FeedbackKey{ItemId: "0", UserId: strconv.Itoa(i)},
+			Timestamp:   time.Now().AddDate(0, 0, -2),
+		})
+	}
+	for i := 0; i < 2; i++ {
+		feedbacks = append(feedbacks, data.Feedback{
+			FeedbackKey: data.FeedbackKey{ItemId: "1", UserId: strconv.Itoa(i)},
+			Timestamp:   time.Now(),
+		})
+	}
+	feedbacks = append(feedbacks, data.Feedback{
+		FeedbackKey: data.FeedbackKey{ItemId: "2", UserId: "0"},
+		Timestamp:   time.Now().AddDate(0, 0, -1),
+	}, data.Feedback{
+		FeedbackKey: data.FeedbackKey{ItemId: "3", UserId: "0", FeedbackType: "star"},
+		Timestamp:   time.Now(),
+	})
+	m.trending(items, feedbacks)
+	trending, err := m.CacheClient.GetSortedScores(cache.TrendingItems, "", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(trending))
+	for i, itemId := range []string{"3", "1", "0"} {
+		assert.Equal(t, itemId, trending[i].ItemId)
+	}
+	assert.InDelta(t, 3, trending[0].Score, 1e-3)
+	assert.InDelta(t, 1, trending[2].Score, 1e-3)
+	trending, err = m.CacheClient.GetSortedScores(cache.TrendingItems, "even", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0", "2"}, cache.RemoveScores(trending))
+	// exponential decay
+	m.GorseConfig.Recommend.TrendingDecay = config.TrendingDecayExponential
+	m.GorseConfig.Recommend.TrendingDecayRate = 1
+	m.trending(items, feedbacks)
+	trending, err = m.CacheClient.GetSortedScores(cache.TrendingItems, "even", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0", "2"}, cache.RemoveScores(trending))
+	assert.InDelta(t, 4*math32.Exp(-2), trending[0].Score, 1e-3)
+}
+
+func TestMaster_LoadTrendingFeedback(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.PositiveFeedbackType = []string{"like"}
+	m.GorseConfig.Database.PositiveFeedbackTTL = 1
+	m.GorseConfig.Recommend.TrendingWeights = map[string]float32{"read": 0.5}
+	m.GorseConfig.Recommend.TrendingDecay = config.TrendingDecayHalfLife
+	m.GorseConfig.Recommend.TrendingHalfLife = 1
+	// insert feedback
+	err := m.DataClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "like", UserId: "0", ItemId: "0"}, Timestamp: time.Now().AddDate(0, 0, -5)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "like", UserId: "0", ItemId: "3"}, Timestamp: time.Now().AddDate(0, 0, -11)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "0", ItemId: "1"}, Timestamp: time.Now()},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "share", UserId: "0", ItemId: "2"}, Timestamp: time.Now()},
+	}, true, true)
+	assert.NoError(t, err)
+	// feedback of weighted types is loaded, positive feedback isn't expired but negligible feedback is skipped
+	feedback, err := m.loadTrendingFeedback()
+	assert.NoError(t, err)
+	itemIds := make([]string, len(feedback))
+	for i, v := range feedback {
+		itemIds[i] = v.ItemId
+	}
+	assert.ElementsMatch(t, []string{"0", "1"}, itemIds)
+	// feedback is never skipped without decay
+	m.GorseConfig.Recommend.TrendingHalfLife = 0
+	assert.Nil(t, m.trendingTimeLimit())
+	m.GorseConfig.Recommend.TrendingDecay = config.TrendingDecayExponential
+	m.GorseConfig.Recommend.TrendingDecayRate = 1
+	timeLimit := m.trendingTimeLimit()
+	assert.NotNil(t, timeLimit)
+	assert.InDelta(t, math32.Log(1000), time.Since(*timeLimit).Hours()/24, 1e-3)
+}
+
+func TestMaster_CollectHidden(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Recommend.PopularWindow = 365
+	m.GorseConfig.Master.FitJobs = 4
+	// collect hidden items
+	items := []data.Item{
+		{ItemId: "0", Timestamp: time.Date(2000, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"a"}},
+		{ItemId: "1", Timestamp: time.Date(2001, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"a"}},
+		{ItemId: "2", Timestamp: time.Date(2002, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"a"}, IsHidden: true},
+		{ItemId: "3", Timestamp: time.Date(2003, 1, 1, 1, 1, 0, 0, time.UTC), Labels: []string{"a"}, IsHidden: true},
+	}
+	err := m.CacheClient.AddSet(cache.HiddenItems, "", "0")
+	assert.NoError(t, err)
+	m.hidden(items)
+	hidden, err := m.CacheClient.GetSet(cache.HiddenItems, "")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "3"}, hidden)
+	// hidden items are not latest items
+	m.latest(items)
+	latest, err := m.CacheClient.GetSortedScores(cache.LatestItems, "a", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{items[1].ItemId, float32(items[1].Timestamp.Unix())},
+		{items[0].ItemId, float32(items[0].Timestamp.Unix())},
+	}, latest)
+	// hidden items are not popular items
+	var feedback []data.Feedback
+	for i, item := range items {
+		for j := 0; j <= i; j++ {
+			feedback = append(feedback, data.Feedback{
+				FeedbackKey: data.FeedbackKey{ItemId: item.ItemId, UserId: strconv.Itoa(j)},
+				Timestamp:   time.Now(),
+			})
+		}
+	}
+	m.popItem(items, feedback)
+	popular, err := m.CacheClient.GetSortedScores(cache.PopularItems, "", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: 2}, {ItemId: "0", Score: 1}}, popular)
+	m.trending(items, feedback)
+	trending, err := m.CacheClient.GetSortedScores(cache.TrendingItems, "a", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "0"}, cache.RemoveScores(trending))
+	// hidden items are not neighbors but have neighbors
+	dataset := ranking.NewMapIndexDataset()
+	for _, v := range feedback {
+		dataset.AddFeedback(v.UserId, v.ItemId, true)
+	}
+	m.similar(items, dataset, model.SimilarityDot)
+	similar, err := m.CacheClient.GetScores(cache.SimilarItems, "3", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "0"}, cache.RemoveScores(similar))
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, cache.RemoveScores(similar))
+}
+
+func TestMaster_CollectScheduled(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 4
+	m.GorseConfig.Recommend.PopularWindow = 365
+	// collect scheduled items
+	timestamp := time.Date(2000, 1, 1, 1, 1, 0, 0, time.UTC)
+	past, future := time.Now().Add(-time.Hour).Truncate(time.Second), time.Now().Add(time.Hour)
+	items := []data.Item{
+		{ItemId: "0", Timestamp: timestamp},
+		{ItemId: "1", Timestamp: timestamp, PublishAt: &past},
+		{ItemId: "2", Timestamp: timestamp, PublishAt: &future},
+		{ItemId: "3", Timestamp: timestamp, ExpireAt: &past},
+		{ItemId: "4", Timestamp: timestamp, ExpireAt: &future},
+	}
+	err := m.CacheClient.AddSorted(cache.UnpublishedItems, "", map[string]float64{"1": cache.TimeScore(past)})
+	assert.NoError(t, err)
+	err = m.CacheClient.AddSorted(cache.ExpiringItems, "", map[string]float64{"3": cache.TimeScore(past)})
+	assert.NoError(t, err)
+	m.hidden(items)
+	// published items are pruned and expired items are hidden
+	unpublished, err := m.CacheClient.GetSorted(cache.UnpublishedItems, "", math.Inf(-1), math.Inf(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, unpublished)
+	expiring, err := m.CacheClient.GetSorted(cache.ExpiringItems, "", math.Inf(-1), math.Inf(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4"}, expiring)
+	hidden, err := m.CacheClient.GetSet(cache.HiddenItems, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3"}, hidden)
+	// latest items are sorted by publish times
+	m.latest(items)
+	latest, err := m.CacheClient.GetSortedScores(cache.LatestItems, "", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{"2", float32(future.Unix())},
+		{"1", float32(past.Unix())},
+		{"4", float32(timestamp.Unix())},
+		{"0", float32(timestamp.Unix())},
+	}, latest)
+	// expired items are not popular items
+	var feedback []data.Feedback
+	for _, item := range items {
+		feedback = append(feedback, data.Feedback{
+			FeedbackKey: data.FeedbackKey{ItemId: item.ItemId, UserId: "0"},
+			Timestamp:   time.Now(),
+		})
+	}
+	m.popItem(items, feedback)
+	popular, err := m.CacheClient.GetSortedScores(cache.PopularItems, "", 0, -1)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0", "1", "2", "4"}, cache.RemoveScores(popular))
+}
+
 func TestMaster_FitCFModel(t *testing.T) {
 	// create mock master
 	m := newMockMaster(t)
@@ -176,16 +395,16 @@ func TestMaster_FitCFModel(t *testing.T) {
 	m.GorseConfig.Master.FitJobs = 4
 	// collect similar
 	items := []data.Item{
-		{"0", time.Now(), []string{"even"}, ""},
-		{"1", time.Now(), []string{"odd"}, ""},
-		{"2", time.Now(), []string{"even"}, ""},
-		{"3", time.Now(), []string{"odd"}, ""},
-		{"4", time.Now(), []string{"even"}, ""},
-		{"5", time.Now(), []string{"odd"}, ""},
-		{"6", time.Now(), []string{"even"}, ""},
-		{"7", time.Now(), []string{"odd"}, ""},
-		{"8", time.Now(), []string{"even"}, ""},
-		{"9", time.Now(), []string{"odd"}, ""},
+		{ItemId: "0", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "1", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "2", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "3", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "4", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "5", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "6", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "7", Timestamp: time.Now(), Labels: []string{"odd"}},
+		{ItemId: "8", Timestamp: time.Now(), Labels: []string{"even"}},
+		{ItemId: "9", Timestamp: time.Now(), Labels: []string{"odd"}},
 	}
 	feedbacks := make([]data.Feedback, 0)
 	for i := 0; i < 10; i++ {
@@ -205,7 +424,7 @@ func TestMaster_FitCFModel(t *testing.T) {
 	assert.Nil(t, err)
 	err = m.DataClient.BatchInsertFeedback(feedbacks, true, true)
 	assert.Nil(t, err)
-	dataset, _, _, err := ranking.LoadDataFromDatabase(m.DataClient, []string{"FeedbackType"}, 0, 0)
+	dataset, _, _, err := ranking.LoadDataFromDatabase(m.DataClient, []string{"FeedbackType"}, nil, nil, 0, 0)
 	assert.Nil(t, err)
 	// similar items (common users)
 	m.similar(items, dataset, model.SimilarityDot)
@@ -213,3 +432,224 @@ func TestMaster_FitCFModel(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []string{"8", "7", "6"}, cache.RemoveScores(similar))
 }
+
+func TestMaster_SimilarSources(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.FitJobs = 4
+	// item i is liked by user 0 ~ i, item 10 is a cold item
+	items := make([]data.Item, 0)
+	dataset := ranking.NewMapIndexDataset()
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			dataset.AddFeedback(strconv.Itoa(j), strconv.Itoa(i), true)
+		}
+	}
+	dataset.AddItem("10")
+	for i := 0; i <= 10; i++ {
+		label := "even"
+		if i%2 == 1 {
+			label = "odd"
+		}
+		items = append(items, data.Item{ItemId: strconv.Itoa(i), Labels: []string{label}})
+	}
+
+	// cold items have no neighbors from feedback
+	m.similar(items, dataset, model.SimilarityDot)
+	similar, err := m.CacheClient.GetScores(cache.SimilarItems, "10", 0, 100)
+	assert.Nil(t, err)
+	assert.Empty(t, similar)
+
+	// embedding neighbors fallback to feedback neighbors without factor model
+	m.GorseConfig.Recommend.NeighborType = config.NeighborTypeEmbedding
+	m.similar(items, dataset, model.SimilarityDot)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "9", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"8", "7", "6"}, cache.RemoveScores(similar))
+
+	// embedding neighbors: factors of even items and odd items are orthogonal
+	bpr := ranking.NewBPR(nil)
+	bpr.UserIndex = dataset.UserIndex
+	bpr.ItemIndex = dataset.ItemIndex
+	bpr.UserFactor = make([][]float32, dataset.UserCount())
+	bpr.ItemFactor = make([][]float32, dataset.ItemCount())
+	for i := range bpr.ItemFactor {
+		if i%2 == 0 {
+			bpr.ItemFactor[i] = []float32{2, 0}
+		} else {
+			bpr.ItemFactor[i] = []float32{0, 2}
+		}
+	}
+	m.rankingModel = bpr
+	m.similar(items, dataset, model.SimilarityDot)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "9", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(similar))
+	for _, item := range similar {
+		id, _ := strconv.Atoi(item.ItemId)
+		assert.Equal(t, 1, id%2)
+		assert.Equal(t, float32(1), item.Score)
+	}
+
+	// label neighbors
+	m.GorseConfig.Recommend.NeighborType = config.NeighborTypeLabel
+	m.similar(items, dataset, model.SimilarityDot)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "10", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(similar))
+	for _, item := range similar {
+		id, _ := strconv.Atoi(item.ItemId)
+		assert.Equal(t, 0, id%2)
+		assert.Equal(t, float32(1), item.Score)
+	}
+
+	// hybrid neighbors
+	m.GorseConfig.Recommend.NeighborType = config.NeighborTypeHybrid
+	m.GorseConfig.Recommend.FeedbackWeight = 1
+	m.GorseConfig.Recommend.LabelWeight = 1
+	m.similar(items, dataset, model.SimilarityDot)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "9", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"7", "5", "3"}, cache.RemoveScores(similar))
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "10", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(similar))
+}
+
+func TestMaster_SimilarIncremental(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.FitJobs = 4
+	m.GorseConfig.Recommend.FullNeighborPeriod = 60
+	// item i is liked by user 0 ~ i
+	dataset := ranking.NewMapIndexDataset()
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			dataset.AddFeedback(strconv.Itoa(j), strconv.Itoa(i), true)
+		}
+	}
+	stale := []cache.ScoredItem{{ItemId: "stale", Score: 1}}
+	err := m.CacheClient.SetScores(cache.SimilarItems, "0", stale)
+	assert.Nil(t, err)
+
+	// update neighbors of all items if there is no snapshot
+	lastFullUpdateTime := time.Now().Add(-30 * time.Minute).Format(time.RFC3339)
+	err = m.CacheClient.SetString(cache.GlobalMeta, cache.LastFullUpdateNeighborTime, lastFullUpdateTime)
+	assert.Nil(t, err)
+	m.similarIncremental(nil, dataset, model.SimilarityDot)
+	similar, err := m.CacheClient.GetScores(cache.SimilarItems, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.NotEqual(t, stale, similar)
+	lastFullUpdateTime, err = m.CacheClient.GetString(cache.GlobalMeta, cache.LastFullUpdateNeighborTime)
+	assert.Nil(t, err)
+
+	// update neighbors of changed items only, user 10 likes item 8 and 9 (backfilled)
+	for _, itemId := range []string{"8", "9"} {
+		dataset.AddFeedback("10", itemId, true)
+	}
+	err = m.CacheClient.SetScores(cache.SimilarItems, "0", stale)
+	assert.Nil(t, err)
+	err = m.CacheClient.SetScores(cache.SimilarItems, "8", stale)
+	assert.Nil(t, err)
+	m.similarIncremental(nil, dataset, model.SimilarityDot)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, stale, similar)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "8", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"9", "7", "6"}, cache.RemoveScores(similar))
+	fullUpdateTime, err := m.CacheClient.GetString(cache.GlobalMeta, cache.LastFullUpdateNeighborTime)
+	assert.Nil(t, err)
+	assert.Equal(t, lastFullUpdateTime, fullUpdateTime)
+
+	// update neighbors of all items if the similarity doesn't decompose
+	m.similarIncremental(nil, dataset, model.SimilarityCosine)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.NotEqual(t, stale, similar)
+	err = m.CacheClient.SetScores(cache.SimilarItems, "0", stale)
+	assert.Nil(t, err)
+	m.GorseConfig.Recommend.NeighborType = config.NeighborTypeLabel
+	m.similarIncremental(nil, dataset, model.SimilarityDot)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.NotEqual(t, stale, similar)
+	m.GorseConfig.Recommend.NeighborType = config.NeighborTypeFeedback
+
+	// update neighbors of all items after full neighbor period
+	m.similarIncremental(nil, dataset, model.SimilarityDot)
+	err = m.CacheClient.SetScores(cache.SimilarItems, "0", stale)
+	assert.Nil(t, err)
+	err = m.CacheClient.SetString(cache.GlobalMeta, cache.LastFullUpdateNeighborTime, time.Now().Add(-2*time.Hour).Format(time.RFC3339))
+	assert.Nil(t, err)
+	m.similarIncremental(nil, dataset, model.SimilarityDot)
+	similar, err = m.CacheClient.GetScores(cache.SimilarItems, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(similar))
+	assert.NotEqual(t, stale, similar)
+}
+
+func TestMaster_SimilarUsers(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.FitJobs = 4
+	// user i likes item i ~ 9
+	dataset := ranking.NewMapIndexDataset()
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			dataset.AddFeedback(strconv.Itoa(j), strconv.Itoa(i), true)
+		}
+	}
+	// similar users (common items)
+	m.GorseConfig.Recommend.UserNeighborPeriod = 60
+	assert.True(t, m.needUpdateUserNeighbors())
+	m.similarUsers(dataset, model.SimilarityDot)
+	assert.False(t, m.needUpdateUserNeighbors())
+	similar, err := m.CacheClient.GetScores(cache.SimilarUsers, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: 9}, {ItemId: "2", Score: 8}, {ItemId: "3", Score: 7}}, similar)
+	similar, err = m.CacheClient.GetScores(cache.SimilarUsers, "9", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(similar))
+	for _, user := range similar {
+		assert.Equal(t, float32(1), user.Score)
+	}
+}
+
+func TestMaster_InsertLearningCurve(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close()
+	// empty learning curves are ignored
+	m.insertLearningCurve(RankingLearningCurve, nil, &ranking.LearningCurve{})
+	measurements, err := m.DataClient.GetMeasurements(RankingLearningCurve, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, measurements)
+	// insert learning curve
+	curve := &ranking.LearningCurve{}
+	curve.AddScore(0, ranking.Score{NDCG: 0.1})
+	for epoch := 1; epoch <= 10; epoch++ {
+		curve.AddLoss(epoch, 1/float32(epoch))
+	}
+	curve.AddScore(10, ranking.Score{NDCG: 0.3})
+	m.insertLearningCurve(RankingLearningCurve, curve.Epochs, curve)
+	measurements, err = m.DataClient.GetMeasurements(RankingLearningCurve, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(measurements))
+	assert.Equal(t, float32(10), measurements[0].Value)
+	var decoded ranking.LearningCurve
+	err = json.Unmarshal([]byte(measurements[0].Comment), &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, *curve, decoded)
+}
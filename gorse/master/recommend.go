@@ -15,17 +15,24 @@
 package master
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/chewxy/math32"
 	"github.com/scylladb/go-set"
+	"github.com/scylladb/go-set/iset"
 	"github.com/scylladb/go-set/strset"
 	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/floats"
 	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"go.uber.org/zap"
+	"hash/fnv"
+	"math"
+	"reflect"
 	"sort"
 	"time"
 )
@@ -36,11 +43,17 @@ const (
 	RankingTop10Recall    = "Recall@10"
 	ClickPrecision        = "Precision"
 	ClickThroughRate      = "ClickThroughRate"
+	RankingLearningCurve  = "RankingLearningCurve"
+	ClickLearningCurve    = "ClickLearningCurve"
 	ActiveUsersYesterday  = "ActiveUsersYesterday"
 	ActiveUsersMonthly    = "ActiveUsersMonthly"
 )
 
-// popItem updates popular items for the database.
+// numIndexIter is the number of k-means iterations to build vector index for embedding neighbors.
+const numIndexIter = 10
+
+// popItem updates popular items for the database. Items to be published are kept since they are filtered while
+// serving until published.
 func (m *Master) popItem(items []data.Item, feedback []data.Feedback) {
 	base.Logger().Info("collect popular items", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
 	// create item mapping
@@ -49,7 +62,8 @@ func (m *Master) popItem(items []data.Item, feedback []data.Feedback) {
 		itemMap[item.ItemId] = item
 	}
 	// count feedback
-	timeWindowLimit := time.Now().AddDate(0, 0, -m.GorseConfig.Recommend.PopularWindow)
+	now := time.Now()
+	timeWindowLimit := now.AddDate(0, 0, -m.GorseConfig.Recommend.PopularWindow)
 	count := make(map[string]int)
 	for _, fb := range feedback {
 		if fb.Timestamp.After(timeWindowLimit) {
@@ -60,8 +74,11 @@ func (m *Master) popItem(items []data.Item, feedback []data.Feedback) {
 	popItems := make(map[string]*base.TopKStringFilter)
 	popItems[""] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
 	for itemId, f := range count {
-		popItems[""].Push(itemId, float32(f))
 		item := itemMap[itemId]
+		if item.IsHidden || item.IsExpired(now) {
+			continue
+		}
+		popItems[""].Push(itemId, float32(f))
 		for _, label := range item.Labels {
 			if _, exists := popItems[label]; !exists {
 				popItems[label] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
@@ -72,7 +89,7 @@ func (m *Master) popItem(items []data.Item, feedback []data.Feedback) {
 	// write back
 	for label, topItems := range popItems {
 		result, scores := topItems.PopAll()
-		if err := m.CacheClient.SetScores(cache.PopularItems, label, cache.CreateScoredItems(result, scores)); err != nil {
+		if err := m.CacheClient.SetSorted(cache.PopularItems, label, cache.CreateScoredItems(result, scores)); err != nil {
 			base.Logger().Error("failed to cache popular items", zap.Error(err))
 		}
 	}
@@ -81,27 +98,178 @@ func (m *Master) popItem(items []data.Item, feedback []data.Feedback) {
 	}
 }
 
-// latest updates latest items.
+// trending updates trending items for the database. Each feedback contributes its weight decayed by its age. Feedback
+// types not weighted in trending scores have weight 1.
+func (m *Master) trending(items []data.Item, feedback []data.Feedback) {
+	base.Logger().Info("collect trending items",
+		zap.Int("n_cache", m.GorseConfig.Database.CacheSize),
+		zap.String("decay", m.GorseConfig.Recommend.TrendingDecay))
+	// create item mapping
+	itemMap := make(map[string]data.Item)
+	for _, item := range items {
+		itemMap[item.ItemId] = item
+	}
+	// sum decayed weights of feedback
+	now := time.Now()
+	scores := make(map[string]float32)
+	for _, fb := range feedback {
+		days := float32(now.Sub(fb.Timestamp).Hours() / 24)
+		if days < 0 {
+			days = 0
+		}
+		weight, exist := m.GorseConfig.Recommend.TrendingWeights[fb.FeedbackType]
+		if !exist {
+			weight = 1
+		}
+		scores[fb.ItemId] += weight * m.decay(days)
+	}
+	// collect trending items
+	trendingItems := make(map[string]*base.TopKStringFilter)
+	trendingItems[""] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
+	for itemId, score := range scores {
+		item := itemMap[itemId]
+		if item.IsHidden || item.IsExpired(now) {
+			continue
+		}
+		trendingItems[""].Push(itemId, score)
+		for _, label := range item.Labels {
+			if _, exists := trendingItems[label]; !exists {
+				trendingItems[label] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
+			}
+			trendingItems[label].Push(itemId, score)
+		}
+	}
+	// write back
+	for label, topItems := range trendingItems {
+		result, scores := topItems.PopAll()
+		if err := m.CacheClient.SetSorted(cache.TrendingItems, label, cache.CreateScoredItems(result, scores)); err != nil {
+			base.Logger().Error("failed to cache trending items", zap.Error(err))
+		}
+	}
+	if err := m.CacheClient.SetString(cache.GlobalMeta, cache.LastUpdateTrendingTime, base.Now()); err != nil {
+		base.Logger().Error("failed to cache trending items", zap.Error(err))
+	}
+}
+
+// decay returns the weight of feedback given its age in days.
+func (m *Master) decay(days float32) float32 {
+	switch m.GorseConfig.Recommend.TrendingDecay {
+	case config.TrendingDecayExponential:
+		return math32.Exp(-m.GorseConfig.Recommend.TrendingDecayRate * days)
+	default:
+		if m.GorseConfig.Recommend.TrendingHalfLife <= 0 {
+			return 1
+		}
+		return math32.Pow(0.5, days/m.GorseConfig.Recommend.TrendingHalfLife)
+	}
+}
+
+// minTrendingDecay is the min weight of feedback decayed by its age, older feedback isn't counted in trending items.
+const minTrendingDecay = 1e-3
+
+// trendingTimeLimit returns the time of feedback whose weight is decayed to the min trending decay. Feedback before
+// the time limit is negligible in trending scores. Nil is returned if feedback is never decayed.
+func (m *Master) trendingTimeLimit() *time.Time {
+	var days float32
+	switch m.GorseConfig.Recommend.TrendingDecay {
+	case config.TrendingDecayExponential:
+		if m.GorseConfig.Recommend.TrendingDecayRate <= 0 {
+			return nil
+		}
+		days = -math32.Log(minTrendingDecay) / m.GorseConfig.Recommend.TrendingDecayRate
+	default:
+		if m.GorseConfig.Recommend.TrendingHalfLife <= 0 {
+			return nil
+		}
+		days = math32.Log2(1/minTrendingDecay) * m.GorseConfig.Recommend.TrendingHalfLife
+	}
+	timeLimit := time.Now().Add(-time.Duration(float64(days) * float64(24*time.Hour)))
+	return &timeLimit
+}
+
+// hidden updates hidden items and scheduled items in the cache. Items to be published and items to be expired are
+// sorted by times, so they are checked whether they are available while serving. Published items are pruned and
+// expired items are moved to hidden items. Sets are updated by adding and removing members instead of being
+// rewritten, so they are never empty while being served.
+func (m *Master) hidden(items []data.Item) {
+	now := time.Now()
+	hiddenItems := strset.New()
+	unpublishedItems := make(map[string]float64)
+	expiringItems := make(map[string]float64)
+	for _, item := range items {
+		if item.IsHidden || item.IsExpired(now) {
+			hiddenItems.Add(item.ItemId)
+		}
+		if item.PublishAt != nil && now.Before(*item.PublishAt) {
+			unpublishedItems[item.ItemId] = cache.TimeScore(*item.PublishAt)
+		}
+		if item.ExpireAt != nil && !item.IsExpired(now) {
+			expiringItems[item.ItemId] = cache.TimeScore(*item.ExpireAt)
+		}
+	}
+	base.Logger().Info("collect hidden items",
+		zap.Int("n_hidden", hiddenItems.Size()),
+		zap.Int("n_unpublished", len(unpublishedItems)),
+		zap.Int("n_expiring", len(expiringItems)))
+	// update hidden items
+	if cachedItems, err := m.CacheClient.GetSet(cache.HiddenItems, ""); err != nil {
+		base.Logger().Error("failed to load hidden items", zap.Error(err))
+	} else if err = m.CacheClient.AddSet(cache.HiddenItems, "", hiddenItems.List()...); err != nil {
+		base.Logger().Error("failed to cache hidden items", zap.Error(err))
+	} else if err = m.CacheClient.RemSet(cache.HiddenItems, "",
+		strset.Difference(strset.New(cachedItems...), hiddenItems).List()...); err != nil {
+		base.Logger().Error("failed to cache hidden items", zap.Error(err))
+	}
+	// update scheduled items
+	for prefix, scores := range map[string]map[string]float64{
+		cache.UnpublishedItems: unpublishedItems,
+		cache.ExpiringItems:    expiringItems,
+	} {
+		cachedItems, err := m.CacheClient.GetSorted(prefix, "", math.Inf(-1), math.Inf(1))
+		if err != nil {
+			base.Logger().Error("failed to load scheduled items", zap.String("prefix", prefix), zap.Error(err))
+			continue
+		}
+		if err = m.CacheClient.AddSorted(prefix, "", scores); err != nil {
+			base.Logger().Error("failed to cache scheduled items", zap.String("prefix", prefix), zap.Error(err))
+			continue
+		}
+		var removedItems []string
+		for _, itemId := range cachedItems {
+			if _, exist := scores[itemId]; !exist {
+				removedItems = append(removedItems, itemId)
+			}
+		}
+		if err = m.CacheClient.RemSorted(prefix, "", removedItems...); err != nil {
+			base.Logger().Error("failed to cache scheduled items", zap.String("prefix", prefix), zap.Error(err))
+		}
+	}
+}
+
+// latest updates latest items. Items are sorted by publish times and expired items are skipped. Items to be
+// published are kept since they are filtered while serving until published.
 func (m *Master) latest(items []data.Item) {
 	base.Logger().Info("collect latest items", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
 	var err error
 	latestItems := make(map[string]*base.TopKStringFilter)
 	latestItems[""] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
 	// find latest items
+	now := time.Now()
 	for _, item := range items {
-		if !item.Timestamp.IsZero() {
-			latestItems[""].Push(item.ItemId, float32(item.Timestamp.Unix()))
+		publishTime := item.PublishTime()
+		if !publishTime.IsZero() && !item.IsHidden && !item.IsExpired(now) {
+			latestItems[""].Push(item.ItemId, float32(publishTime.Unix()))
 			for _, label := range item.Labels {
 				if _, exist := latestItems[label]; !exist {
 					latestItems[label] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
 				}
-				latestItems[label].Push(item.ItemId, float32(item.Timestamp.Unix()))
+				latestItems[label].Push(item.ItemId, float32(publishTime.Unix()))
 			}
 		}
 	}
 	for label, topItems := range latestItems {
 		result, scores := topItems.PopAll()
-		if err = m.CacheClient.SetScores(cache.LatestItems, label, cache.CreateScoredItems(result, scores)); err != nil {
+		if err = m.CacheClient.SetSorted(cache.LatestItems, label, cache.CreateScoredItems(result, scores)); err != nil {
 			base.Logger().Error("failed to cache latest items", zap.Error(err))
 		}
 	}
@@ -110,9 +278,226 @@ func (m *Master) latest(items []data.Item) {
 	}
 }
 
-// similar updates neighbors for the database.
+// similar updates neighbors of all items for the database.
 func (m *Master) similar(items []data.Item, dataset *ranking.DataSet, similarity string) {
-	base.Logger().Info("collect similar items", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
+	startTime := time.Now()
+	m.updateSimilar(items, dataset, similarity, base.RangeInt(dataset.ItemCount()), startTime)
+	if err := m.CacheClient.SetString(cache.GlobalMeta, cache.LastFullUpdateNeighborTime, startTime.Format(time.RFC3339)); err != nil {
+		base.Logger().Error("failed to cache similar items", zap.Error(err))
+	}
+}
+
+// similarIncremental updates neighbors of items whose feedback changed since the last update of neighbors and
+// items co-occurring with them. Changes are found by comparing fingerprints of feedback with the snapshot taken at
+// the last update, so backfilled feedback is found as well. Neighbors of all items are updated if there is no
+// snapshot, the last full update is older than the full neighbor period or neighbors aren't based on the dot
+// similarity of feedback, since a change of norms, factors or labels affects neighbors of all items.
+func (m *Master) similarIncremental(items []data.Item, dataset *ranking.DataSet, similarity string) {
+	lastFullUpdateTime, err := m.CacheClient.GetTime(cache.GlobalMeta, cache.LastFullUpdateNeighborTime)
+	if err != nil {
+		base.Logger().Error("failed to read meta", zap.Error(err))
+	}
+	switch m.GorseConfig.Recommend.NeighborType {
+	case config.NeighborTypeEmbedding, config.NeighborTypeLabel, config.NeighborTypeHybrid:
+		m.neighborSnapshot = nil
+		m.similar(items, dataset, similarity)
+		return
+	}
+	fullPeriod := time.Duration(m.GorseConfig.Recommend.FullNeighborPeriod) * time.Minute
+	snapshot := newNeighborSnapshot(items, dataset)
+	lastSnapshot := m.neighborSnapshot
+	m.neighborSnapshot = snapshot
+	if similarity != model.SimilarityDot || lastSnapshot == nil || lastFullUpdateTime.IsZero() ||
+		time.Since(lastFullUpdateTime) >= fullPeriod {
+		m.similar(items, dataset, similarity)
+		return
+	}
+	startTime := time.Now()
+	// collect changed items and items co-occurring with them
+	changedItems := set.NewIntSet()
+	for itemId, fingerprint := range snapshot.items {
+		if lastFingerprint, exist := lastSnapshot.items[itemId]; !exist || lastFingerprint != fingerprint {
+			changedItems.Add(dataset.ItemIndex.ToNumber(itemId))
+		}
+	}
+	for userId, fingerprint := range snapshot.users {
+		if lastFingerprint, exist := lastSnapshot.users[userId]; !exist || lastFingerprint != fingerprint {
+			changedItems.Add(dataset.UserFeedback[dataset.UserIndex.ToNumber(userId)]...)
+		}
+	}
+	// hidden items are removed from or added back to neighbors of items co-occurring with them
+	for _, itemId := range strset.SymmetricDifference(snapshot.hidden, lastSnapshot.hidden).List() {
+		if itemIndex := dataset.ItemIndex.ToNumber(itemId); itemIndex != base.NotId {
+			changedItems.Add(itemIndex)
+			for _, userIndex := range dataset.ItemFeedback[itemIndex] {
+				changedItems.Add(dataset.UserFeedback[userIndex]...)
+			}
+		}
+	}
+	targets := changedItems.List()
+	sort.Ints(targets)
+	m.updateSimilar(items, dataset, similarity, targets, startTime)
+}
+
+// neighborSnapshot holds fingerprints of feedback of items and users by names and hidden items when neighbors of
+// items are updated. A fingerprint is the sum of hashes of names in feedback, which doesn't depend on the order of
+// feedback.
+type neighborSnapshot struct {
+	items  map[string]uint64
+	users  map[string]uint64
+	hidden *strset.Set
+}
+
+// newNeighborSnapshot takes a snapshot of a dataset.
+func newNeighborSnapshot(items []data.Item, dataset *ranking.DataSet) *neighborSnapshot {
+	snapshot := &neighborSnapshot{
+		items:  make(map[string]uint64, dataset.ItemCount()),
+		users:  make(map[string]uint64, dataset.UserCount()),
+		hidden: strset.New(),
+	}
+	for itemIndex, users := range dataset.ItemFeedback {
+		var sum uint64
+		for _, userIndex := range users {
+			sum += fingerprint(dataset.UserIndex.ToName(userIndex))
+		}
+		snapshot.items[dataset.ItemIndex.ToName(itemIndex)] = sum
+	}
+	for userIndex, userItems := range dataset.UserFeedback {
+		var sum uint64
+		for _, itemIndex := range userItems {
+			sum += fingerprint(dataset.ItemIndex.ToName(itemIndex))
+		}
+		snapshot.users[dataset.UserIndex.ToName(userIndex)] = sum
+	}
+	for _, item := range items {
+		if item.IsHidden {
+			snapshot.hidden.Add(item.ItemId)
+		}
+	}
+	return snapshot
+}
+
+// fingerprint returns the FNV-1a hash of a name.
+func fingerprint(name string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// updateSimilar updates neighbors of target items for the database. Similarity between items comes from shared
+// users (feedback), factors in the ranking model (embedding), shared labels (label) or a weighted sum of them (hybrid).
+func (m *Master) updateSimilar(items []data.Item, dataset *ranking.DataSet, similarity string, targets []int, startTime time.Time) {
+	neighborType := m.GorseConfig.Recommend.NeighborType
+	base.Logger().Info("collect similar items",
+		zap.Int("n_cache", m.GorseConfig.Database.CacheSize),
+		zap.String("neighbor_type", neighborType),
+		zap.Int("n_items", len(targets)))
+	// select sources of similarity
+	var feedbackWeight, embeddingWeight, labelWeight float32
+	switch neighborType {
+	case config.NeighborTypeEmbedding:
+		embeddingWeight = 1
+	case config.NeighborTypeLabel:
+		labelWeight = 1
+	case config.NeighborTypeHybrid:
+		feedbackWeight = m.GorseConfig.Recommend.FeedbackWeight
+		embeddingWeight = m.GorseConfig.Recommend.EmbeddingWeight
+		labelWeight = m.GorseConfig.Recommend.LabelWeight
+		similarity = model.SimilarityCosine
+	default:
+		feedbackWeight = 1
+	}
+	var embeddings [][]float32
+	var index ranking.VectorIndex
+	if embeddingWeight > 0 {
+		if embeddings = m.itemEmbeddings(dataset); embeddings == nil {
+			base.Logger().Warn("ranking model is not a fitted matrix factorization model, ignore embedding similarity")
+			embeddingWeight = 0
+			if neighborType == config.NeighborTypeEmbedding {
+				feedbackWeight = 1
+			}
+		} else if m.GorseConfig.Recommend.EnableIndex {
+			index = ranking.NewIVF(embeddings, m.GorseConfig.Recommend.IndexClusters, m.GorseConfig.Recommend.IndexProbes,
+				numIndexIter, m.GorseConfig.Master.FitJobs, 0)
+		} else {
+			index = ranking.NewBruteForceIndex(embeddings)
+		}
+	}
+	var itemLabels, labelItems [][]int
+	if labelWeight > 0 {
+		itemLabels, labelItems = indexItemLabels(items, dataset)
+	}
+	// hidden items are used to compute similarity but never be neighbors
+	hiddenItems := set.NewIntSet()
+	for _, item := range items {
+		if item.IsHidden {
+			if itemIndex := dataset.ItemIndex.ToNumber(item.ItemId); itemIndex != base.NotId {
+				hiddenItems.Add(itemIndex)
+			}
+		}
+	}
+
+	candidates := func(itemIndex int) []int {
+		itemSet := set.NewIntSet()
+		if feedbackWeight > 0 {
+			for _, u := range dataset.ItemFeedback[itemIndex] {
+				itemSet.Add(dataset.UserFeedback[u]...)
+			}
+		}
+		if embeddingWeight > 0 {
+			neighbors, _ := index.Search(embeddings[itemIndex], m.GorseConfig.Database.CacheSize+1)
+			itemSet.Add(neighbors...)
+		}
+		if labelWeight > 0 {
+			for _, label := range itemLabels[itemIndex] {
+				itemSet.Add(labelItems[label]...)
+			}
+		}
+		return itemSet.List()
+	}
+	score := func(i, j int) float32 {
+		var score float32
+		if feedbackWeight > 0 {
+			score += feedbackWeight * feedbackSimilarity(dataset.ItemFeedback[i], dataset.ItemFeedback[j], similarity)
+		}
+		if embeddingWeight > 0 {
+			score += embeddingWeight * floats.Dot(embeddings[i], embeddings[j])
+		}
+		if labelWeight > 0 {
+			score += labelWeight * jaccardInt(itemLabels[i], itemLabels[j])
+		}
+		return score
+	}
+	if err := m.updateNeighbors(itemNeighborView(dataset), targets, candidates, score, hiddenItems); err != nil {
+		base.Logger().Error("failed to cache similar items", zap.Error(err))
+	}
+	if err := m.CacheClient.SetString(cache.GlobalMeta, cache.LastUpdateNeighborTime, startTime.Format(time.RFC3339)); err != nil {
+		base.Logger().Error("failed to cache similar items", zap.Error(err))
+	}
+}
+
+// neighborView is the view of items or users in a dataset to find neighbors.
+type neighborView struct {
+	name     string     // name of objects (items/users)
+	prefix   string     // cache prefix of neighbors
+	index    base.Index // index of objects
+	feedback [][]int    // feedback of each object
+}
+
+// itemNeighborView returns the view of items in a dataset, where feedback of an item are users.
+func itemNeighborView(dataset *ranking.DataSet) neighborView {
+	return neighborView{name: "items", prefix: cache.SimilarItems, index: dataset.ItemIndex, feedback: dataset.ItemFeedback}
+}
+
+// userNeighborView returns the view of users in a dataset, where feedback of a user are items.
+func userNeighborView(dataset *ranking.DataSet) neighborView {
+	return neighborView{name: "users", prefix: cache.SimilarUsers, index: dataset.UserIndex, feedback: dataset.UserFeedback}
+}
+
+// updateNeighbors finds neighbors of target objects among their candidates and saves them to the cache. Feedback
+// of objects are sorted before scoring. Excluded objects are never neighbors.
+func (m *Master) updateNeighbors(view neighborView, targets []int, candidates func(int) []int,
+	score func(int, int) float32, excluded *iset.Set) error {
 	// create progress tracker
 	completed := make(chan []interface{}, 1000)
 	go func() {
@@ -126,57 +511,147 @@ func (m *Master) similar(items []data.Item, dataset *ranking.DataSet, similarity
 				}
 				completedCount++
 			case <-ticker.C:
-				base.Logger().Debug("collect similar items",
-					zap.Int("n_complete_items", completedCount),
-					zap.Int("n_items", dataset.ItemCount()))
+				base.Logger().Debug("collect similar "+view.name,
+					zap.Int("n_complete_"+view.name, completedCount),
+					zap.Int("n_"+view.name, len(targets)))
 			}
 		}
 	}()
+	defer close(completed)
 
 	// pre-ranking
-	for _, feedbacks := range dataset.ItemFeedback {
+	for _, feedbacks := range view.feedback {
 		sort.Ints(feedbacks)
 	}
 
-	if err := base.Parallel(dataset.ItemCount(), m.GorseConfig.Master.FitJobs, func(workerId, jobId int) error {
-		users := dataset.ItemFeedback[jobId]
-		// Collect candidates
-		itemSet := set.NewIntSet()
-		for _, u := range users {
-			itemSet.Add(dataset.UserFeedback[u]...)
-		}
+	return base.Parallel(len(targets), m.GorseConfig.Master.FitJobs, func(workerId, targetId int) error {
+		jobId := targets[targetId]
 		// Ranking
-		nearItems := base.NewTopKFilter(m.GorseConfig.Database.CacheSize)
-		for j := range itemSet.List() {
-			if j != jobId {
-				var score float32
-				score = dotInt(dataset.ItemFeedback[jobId], dataset.ItemFeedback[j])
-				if similarity == model.SimilarityCosine {
-					score /= math32.Sqrt(float32(len(dataset.ItemFeedback[jobId])))
-					score /= math32.Sqrt(float32(len(dataset.ItemFeedback[j])))
-				}
-				nearItems.Push(j, score)
+		neighbors := base.NewTopKFilter(m.GorseConfig.Database.CacheSize)
+		for _, j := range candidates(jobId) {
+			if j != jobId && (excluded == nil || !excluded.Has(j)) {
+				neighbors.Push(j, score(jobId, j))
 			}
 		}
-		elem, scores := nearItems.PopAll()
-		recommends := make([]string, len(elem))
-		for i := range recommends {
-			recommends[i] = dataset.ItemIndex.ToName(elem[i])
+		elem, scores := neighbors.PopAll()
+		names := make([]string, len(elem))
+		for i := range names {
+			names[i] = view.index.ToName(elem[i])
 		}
-		if err := m.CacheClient.SetScores(cache.SimilarItems, dataset.ItemIndex.ToName(jobId), cache.CreateScoredItems(recommends, scores)); err != nil {
+		if err := m.CacheClient.SetScores(view.prefix, view.index.ToName(jobId), cache.CreateScoredItems(names, scores)); err != nil {
 			return err
 		}
 		completed <- nil
 		return nil
-	}); err != nil {
-		base.Logger().Error("failed to cache similar items", zap.Error(err))
+	})
+}
+
+// itemEmbeddings returns normalized factors of items in the dataset. Items unknown to the ranking model get
+// zero vectors. It returns nil if the ranking model is not a fitted matrix factorization model.
+func (m *Master) itemEmbeddings(dataset *ranking.DataSet) [][]float32 {
+	m.rankingModelMutex.RLock()
+	defer m.rankingModelMutex.RUnlock()
+	factorModel, ok := m.rankingModel.(ranking.FactorModel)
+	if !ok || factorModel.Invalid() {
+		return nil
 	}
-	close(completed)
-	if err := m.CacheClient.SetString(cache.GlobalMeta, cache.LastUpdateNeighborTime, base.Now()); err != nil {
-		base.Logger().Error("failed to cache similar items", zap.Error(err))
+	var numFactors int
+	if factorModel.GetItemIndex().Len() > 0 {
+		numFactors = len(factorModel.GetItemFactor(0))
+	}
+	embeddings := make([][]float32, dataset.ItemCount())
+	for i := range embeddings {
+		itemIndex := factorModel.GetItemIndex().ToNumber(dataset.ItemIndex.ToName(i))
+		if itemIndex == base.NotId {
+			embeddings[i] = make([]float32, numFactors)
+			continue
+		}
+		embeddings[i] = append([]float32(nil), factorModel.GetItemFactor(itemIndex)...)
+		if norm := math32.Sqrt(floats.Dot(embeddings[i], embeddings[i])); norm > 0 {
+			floats.MulConst(embeddings[i], 1/norm)
+		}
+	}
+	return embeddings
+}
+
+// indexItemLabels returns sorted labels of each item and items of each label.
+func indexItemLabels(items []data.Item, dataset *ranking.DataSet) (itemLabels, labelItems [][]int) {
+	labelIndex := base.NewMapIndex()
+	itemLabels = make([][]int, dataset.ItemCount())
+	for _, item := range items {
+		itemIndex := dataset.ItemIndex.ToNumber(item.ItemId)
+		if itemIndex == base.NotId {
+			continue
+		}
+		labelSet := set.NewIntSet()
+		for _, label := range item.Labels {
+			labelIndex.Add(label)
+			labelId := labelIndex.ToNumber(label)
+			if !labelSet.Has(labelId) {
+				labelSet.Add(labelId)
+				if labelId >= len(labelItems) {
+					labelItems = append(labelItems, nil)
+				}
+				labelItems[labelId] = append(labelItems[labelId], itemIndex)
+			}
+		}
+		itemLabels[itemIndex] = labelSet.List()
+		sort.Ints(itemLabels[itemIndex])
+	}
+	return
+}
+
+// feedbackSimilarity computes similarity between two sorted lists of users.
+func feedbackSimilarity(a, b []int, similarity string) float32 {
+	score := dotInt(a, b)
+	if similarity == model.SimilarityCosine && score > 0 {
+		score /= math32.Sqrt(float32(len(a)))
+		score /= math32.Sqrt(float32(len(b)))
+	}
+	return score
+}
+
+// jaccardInt computes the Jaccard similarity between two sorted lists of labels.
+func jaccardInt(a, b []int) float32 {
+	intersect := dotInt(a, b)
+	if intersect == 0 {
+		return 0
+	}
+	return intersect / (float32(len(a)+len(b)) - intersect)
+}
+
+// similarUsers updates neighbors of users for the database.
+func (m *Master) similarUsers(dataset *ranking.DataSet, similarity string) {
+	base.Logger().Info("collect similar users", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
+	candidates := func(userIndex int) []int {
+		userSet := set.NewIntSet()
+		for _, i := range dataset.UserFeedback[userIndex] {
+			userSet.Add(dataset.ItemFeedback[i]...)
+		}
+		return userSet.List()
+	}
+	score := func(u, v int) float32 {
+		return feedbackSimilarity(dataset.UserFeedback[u], dataset.UserFeedback[v], similarity)
+	}
+	if err := m.updateNeighbors(userNeighborView(dataset), base.RangeInt(dataset.UserCount()), candidates, score, nil); err != nil {
+		base.Logger().Error("failed to cache similar users", zap.Error(err))
+	}
+	if err := m.CacheClient.SetString(cache.GlobalMeta, cache.LastUpdateUserNeighborTime, base.Now()); err != nil {
+		base.Logger().Error("failed to cache similar users", zap.Error(err))
 	}
 }
 
+// needUpdateUserNeighbors returns true if neighbors of users haven't been updated in the user neighbor period.
+func (m *Master) needUpdateUserNeighbors() bool {
+	lastUpdateTime, err := m.CacheClient.GetTime(cache.GlobalMeta, cache.LastUpdateUserNeighborTime)
+	if err != nil {
+		base.Logger().Error("failed to read meta", zap.Error(err))
+		return true
+	}
+	period := time.Duration(m.GorseConfig.Recommend.UserNeighborPeriod) * time.Minute
+	return lastUpdateTime.IsZero() || time.Since(lastUpdateTime) >= period
+}
+
 func dotString(a, b []string) float32 {
 	i, j, sum := 0, 0, float32(0)
 	for i < len(a) && j < len(b) {
@@ -262,13 +737,24 @@ func (m *Master) fitRankingModelAndNonPersonalized(
 		m.userIndexVersion++
 		m.userIndexMutex.Unlock()
 		// collect similar items
-		m.similar(m.rankingItems, m.rankingFullSet, model.SimilarityDot)
+		if m.GorseConfig.Recommend.EnableIncrementalNeighbor {
+			m.similarIncremental(m.rankingItems, m.rankingFullSet, model.SimilarityDot)
+		} else {
+			m.similar(m.rankingItems, m.rankingFullSet, model.SimilarityDot)
+		}
+		// collect similar users
+		if m.needUpdateUserNeighbors() {
+			m.similarUsers(m.rankingFullSet, model.SimilarityDot)
+		}
 		// collect popular items
 		m.popItem(m.rankingItems, m.rankingFeedbacks)
+		// collect trending items
+		m.trending(m.rankingItems, m.trendingFeedback)
 		// collect latest items
 		m.latest(m.rankingItems)
 		// release dataset
 		m.rankingFeedbacks = nil
+		m.trendingFeedback = nil
 		m.rankingItems = nil
 		m.rankingFullSet = nil
 	}
@@ -278,7 +764,18 @@ func (m *Master) fitRankingModelAndNonPersonalized(
 		base.Logger().Info("nothing changed")
 		return
 	}
-	score := rankingModel.Fit(m.rankingTrainSet, m.rankingTestSet, ranking.NewFitConfig().SetJobs(m.GorseConfig.Master.FitJobs))
+	fitConfig := ranking.NewFitConfig().
+		SetJobs(m.GorseConfig.Master.FitJobs).
+		SetPatience(m.GorseConfig.Recommend.EarlyStoppingPatience)
+	fitConfig.Curve = &ranking.LearningCurve{}
+	// fit a copy since the published model is being served
+	rankingModel = ranking.Clone(rankingModel)
+	score := rankingModel.Fit(m.rankingTrainSet, m.rankingTestSet, fitConfig)
+	if rankingModel.Invalid() {
+		// keep serving the published model if fitting failed, such as too many items for EASE
+		base.Logger().Error("failed to fit ranking model", zap.Any("params", rankingModel.GetParams()))
+		return
+	}
 
 	// update ranking model
 	m.rankingModelMutex.Lock()
@@ -297,6 +794,7 @@ func (m *Master) fitRankingModelAndNonPersonalized(
 	if err := m.DataClient.InsertMeasurement(data.Measurement{Name: RankingTop10Precision, Value: score.Precision, Timestamp: time.Now()}); err != nil {
 		base.Logger().Error("failed to insert measurement", zap.Error(err))
 	}
+	m.insertLearningCurve(RankingLearningCurve, fitConfig.Curve.Epochs, fitConfig.Curve)
 	if err := m.CacheClient.SetString(cache.GlobalMeta, cache.LastFitRankingModelTime, base.Now()); err != nil {
 		base.Logger().Error("failed to write meta", zap.Error(err))
 	}
@@ -447,7 +945,8 @@ func (m *Master) fitClickModel(
 	bestClickModel, bestClickScore := m.clickModelSearcher.GetBestModel()
 	m.clickModelMutex.Lock()
 	if bestClickModel != nil && !bestClickModel.Invalid() &&
-		bestClickModel.GetParams().ToString() != m.clickModel.GetParams().ToString() &&
+		(reflect.TypeOf(bestClickModel) != reflect.TypeOf(m.clickModel) ||
+			bestClickModel.GetParams().ToString() != m.clickModel.GetParams().ToString()) &&
 		bestClickScore.Precision > m.clickScore.Precision {
 		// 1. best click model must have been found.
 		// 2. best click model must be different from current model
@@ -467,7 +966,13 @@ func (m *Master) fitClickModel(
 		base.Logger().Info("nothing changed")
 		return
 	}
-	score := clickModel.Fit(m.clickTrainSet, m.clickTestSet, click.NewFitConfig().SetJobs(m.GorseConfig.Master.FitJobs))
+	fitConfig := click.NewFitConfig().
+		SetJobs(m.GorseConfig.Master.FitJobs).
+		SetPatience(m.GorseConfig.Recommend.EarlyStoppingPatience)
+	fitConfig.Curve = &click.LearningCurve{}
+	// fit a copy since the published model is being served
+	clickModel = click.Clone(clickModel)
+	score := clickModel.Fit(m.clickTrainSet, m.clickTestSet, fitConfig)
 
 	// update match model
 	m.clickModelMutex.Lock()
@@ -480,6 +985,7 @@ func (m *Master) fitClickModel(
 	if err := m.DataClient.InsertMeasurement(data.Measurement{Name: ClickPrecision, Value: score.Precision, Timestamp: time.Now()}); err != nil {
 		base.Logger().Error("failed to insert measurement", zap.Error(err))
 	}
+	m.insertLearningCurve(ClickLearningCurve, fitConfig.Curve.Epochs, fitConfig.Curve)
 
 	// caching model
 	m.clickModelMutex.RLock()
@@ -553,3 +1059,24 @@ func (m *Master) searchClickModel(
 	err = m.clickModelSearcher.Fit(m.clickTrainSet, m.clickTestSet)
 	return
 }
+
+// insertLearningCurve inserts a learning curve as a measurement. The value is the last evaluated epoch and the
+// comment is the learning curve encoded in JSON, which could be plotted by the dashboard.
+func (m *Master) insertLearningCurve(name string, epochs []int, curve interface{}) {
+	if len(epochs) == 0 {
+		return
+	}
+	bytes, err := json.Marshal(curve)
+	if err != nil {
+		base.Logger().Error("failed to marshal learning curve", zap.Error(err))
+		return
+	}
+	if err = m.DataClient.InsertMeasurement(data.Measurement{
+		Name:      name,
+		Value:     float32(epochs[len(epochs)-1]),
+		Timestamp: time.Now(),
+		Comment:   string(bytes),
+	}); err != nil {
+		base.Logger().Error("failed to insert measurement", zap.Error(err))
+	}
+}
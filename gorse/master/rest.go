@@ -16,6 +16,8 @@ package master
 
 import (
 	"bufio"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -30,6 +32,8 @@ import (
 	"github.com/rakyll/statik/fs"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/click"
+	"github.com/zhenghaoz/gorse/model/ranking"
 	"github.com/zhenghaoz/gorse/server"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
@@ -103,6 +107,19 @@ func (m *Master) CreateWebService() {
 		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
 		Writes([]data.Item{}))
+	// Get embeddings
+	ws.Route(ws.GET("/embedding/user/{user-id}").To(m.getUserEmbedding).
+		Doc("Get the latent vector of a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"embedding"}).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("model", "source model of vectors (ranking or click)").DataType("string")).
+		Writes(Embedding{}))
+	ws.Route(ws.GET("/embedding/item/{item-id}").To(m.getItemEmbedding).
+		Doc("Get the latent vector of an item.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"embedding"}).
+		Param(ws.PathParameter("item-id", "identifier of the item").DataType("string")).
+		Param(ws.QueryParameter("model", "source model of vectors (ranking or click)").DataType("string")).
+		Writes(Embedding{}))
 }
 
 // SinglePageAppFileSystem is the file system for single page app.
@@ -128,6 +145,7 @@ func (m *Master) StartHttpServer() {
 	http.Handle("/", http.FileServer(&SinglePageAppFileSystem{statikFS}))
 	http.HandleFunc("/api/bulk/items", m.importExportItems)
 	http.HandleFunc("/api/bulk/feedback", m.importExportFeedback)
+	http.HandleFunc("/api/bulk/item-embeddings", m.exportItemEmbeddings)
 	m.RestServer.StartHttpServer()
 }
 
@@ -326,7 +344,7 @@ func (m *Master) getList(prefix, name string, request *restful.Request, response
 	}
 	end = begin + n - 1
 	// Get the popular list
-	items, err := m.CacheClient.GetScores(prefix, name, begin, end)
+	items, err := cache.GetItemScores(m.CacheClient, prefix, name, begin, end)
 	if err != nil {
 		server.InternalServerError(response, err)
 		return
@@ -357,6 +375,157 @@ func (m *Master) getNeighbors(request *restful.Request, response *restful.Respon
 	m.getList(cache.SimilarItems, itemId, request, response)
 }
 
+const (
+	RankingModelEmbedding = "ranking" // factors of the matrix factorization model
+	ClickModelEmbedding   = "click"   // factors of the factorization machine
+)
+
+// Embedding is the latent vector of a user or an item.
+type Embedding struct {
+	Id     string
+	Vector []float32
+}
+
+// embeddingModel provides latent vectors of users and items in a trained model.
+type embeddingModel struct {
+	userFactor func(userId string) []float32
+	itemFactor func(itemId string) []float32
+	items      []string
+}
+
+// getEmbeddingModel returns latent vectors of the ranking model or the click model. Only matrix factorization
+// models and factorization machines have latent vectors.
+func (m *Master) getEmbeddingModel(name string) (*embeddingModel, error) {
+	switch name {
+	case "", RankingModelEmbedding:
+		m.rankingModelMutex.RLock()
+		rankingModel := m.rankingModel
+		m.rankingModelMutex.RUnlock()
+		factorModel, ok := rankingModel.(ranking.FactorModel)
+		if !ok || rankingModel.Invalid() {
+			return nil, fmt.Errorf("ranking model has no latent vectors")
+		}
+		return &embeddingModel{
+			userFactor: func(userId string) []float32 {
+				if userIndex := factorModel.GetUserIndex().ToNumber(userId); userIndex != base.NotId {
+					return factorModel.GetUserFactor(userIndex)
+				}
+				return nil
+			},
+			itemFactor: func(itemId string) []float32 {
+				if itemIndex := factorModel.GetItemIndex().ToNumber(itemId); itemIndex != base.NotId {
+					return factorModel.GetItemFactor(itemIndex)
+				}
+				return nil
+			},
+			items: factorModel.GetItemIndex().GetNames(),
+		}, nil
+	case ClickModelEmbedding:
+		m.clickModelMutex.RLock()
+		clickModel := m.clickModel
+		m.clickModelMutex.RUnlock()
+		factorModel, ok := clickModel.(click.EmbeddingModel)
+		if !ok || clickModel.Invalid() {
+			return nil, fmt.Errorf("click model has no latent vectors")
+		}
+		return &embeddingModel{
+			userFactor: factorModel.GetUserFactor,
+			itemFactor: factorModel.GetItemFactor,
+			items:      factorModel.GetItems(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown model `%v`", name)
+	}
+}
+
+func (m *Master) getUserEmbedding(request *restful.Request, response *restful.Response) {
+	userId := request.PathParameter("user-id")
+	embeddings, err := m.getEmbeddingModel(request.QueryParameter("model"))
+	if err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	vector := embeddings.userFactor(userId)
+	if vector == nil {
+		server.PageNotFound(response, data.ErrUserNotExist)
+		return
+	}
+	server.Ok(response, Embedding{Id: userId, Vector: vector})
+}
+
+func (m *Master) getItemEmbedding(request *restful.Request, response *restful.Response) {
+	itemId := request.PathParameter("item-id")
+	embeddings, err := m.getEmbeddingModel(request.QueryParameter("model"))
+	if err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	vector := embeddings.itemFactor(itemId)
+	if vector == nil {
+		server.PageNotFound(response, data.ErrItemNotExist)
+		return
+	}
+	server.Ok(response, Embedding{Id: itemId, Vector: vector})
+}
+
+// exportItemEmbeddings exports latent vectors of all items. Vectors are written as JSON lines by default. If the
+// format is binary, vectors are written in little endian:
+//
+//	<number of items: uint32> <dimension: uint32>
+//	<length of item id: uint32> <item id: bytes> <vector: float32 * dimension>
+//	...
+func (m *Master) exportItemEmbeddings(response http.ResponseWriter, request *http.Request) {
+	embeddings, err := m.getEmbeddingModel(request.FormValue("model"))
+	if err != nil {
+		server.BadRequest(restful.NewResponse(response), err)
+		return
+	}
+	writer := bufio.NewWriter(response)
+	switch format := formValue(request, "format", "jsonl"); format {
+	case "jsonl":
+		response.Header().Set("Content-Type", "application/x-ndjson")
+		response.Header().Set("Content-Disposition", "attachment;filename=item_embeddings.jsonl")
+		encoder := json.NewEncoder(writer)
+		for _, itemId := range embeddings.items {
+			if err = encoder.Encode(Embedding{Id: itemId, Vector: embeddings.itemFactor(itemId)}); err != nil {
+				base.Logger().Error("failed to export item embeddings", zap.Error(err))
+				return
+			}
+		}
+	case "binary":
+		response.Header().Set("Content-Type", "application/octet-stream")
+		response.Header().Set("Content-Disposition", "attachment;filename=item_embeddings.bin")
+		var dimension int
+		if len(embeddings.items) > 0 {
+			dimension = len(embeddings.itemFactor(embeddings.items[0]))
+		}
+		if err = binary.Write(writer, binary.LittleEndian, []uint32{uint32(len(embeddings.items)), uint32(dimension)}); err != nil {
+			base.Logger().Error("failed to export item embeddings", zap.Error(err))
+			return
+		}
+		for _, itemId := range embeddings.items {
+			if err = binary.Write(writer, binary.LittleEndian, uint32(len(itemId))); err != nil {
+				base.Logger().Error("failed to export item embeddings", zap.Error(err))
+				return
+			}
+			if _, err = writer.WriteString(itemId); err != nil {
+				base.Logger().Error("failed to export item embeddings", zap.Error(err))
+				return
+			}
+			if err = binary.Write(writer, binary.LittleEndian, embeddings.itemFactor(itemId)); err != nil {
+				base.Logger().Error("failed to export item embeddings", zap.Error(err))
+				return
+			}
+		}
+	default:
+		server.BadRequest(restful.NewResponse(response), fmt.Errorf("unknown format `%v`", format))
+		return
+	}
+	if err = writer.Flush(); err != nil {
+		base.Logger().Error("failed to export item embeddings", zap.Error(err))
+	}
+}
+
 func (m *Master) importExportItems(response http.ResponseWriter, request *http.Request) {
 	switch request.Method {
 	case http.MethodGet:
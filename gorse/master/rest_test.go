@@ -16,11 +16,13 @@ package master
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/emicklei/go-restful/v3"
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/model/ranking"
@@ -84,9 +86,9 @@ func TestMaster_ExportItems(t *testing.T) {
 	defer s.Close(t)
 	// insert items
 	items := []data.Item{
-		{"1", time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC), []string{"a", "b"}, "o,n,e"},
-		{"2", time.Date(2021, 1, 1, 1, 1, 1, 1, time.UTC), []string{"b", "c"}, "t\r\nw\r\no"},
-		{"3", time.Date(2022, 1, 1, 1, 1, 1, 1, time.UTC), []string{"c", "d"}, "\"three\""},
+		{ItemId: "1", Timestamp: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"a", "b"}, Comment: "o,n,e"},
+		{ItemId: "2", Timestamp: time.Date(2021, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"b", "c"}, Comment: "t\r\nw\r\no"},
+		{ItemId: "3", Timestamp: time.Date(2022, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"c", "d"}, Comment: "\"three\""},
 	}
 	err := s.DataClient.BatchInsertItem(items)
 	assert.Nil(t, err)
@@ -127,6 +129,92 @@ func TestMaster_ExportFeedback(t *testing.T) {
 		"share,1,4,0001-01-01 00:00:00 +0000 UTC\r\n", w.Body.String())
 }
 
+func TestMaster_GetEmbedding(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// no factor model
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/embedding/user/0").
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	// create factor model
+	bpr := ranking.NewBPR(nil)
+	bpr.UserIndex = base.NewMapIndex()
+	bpr.UserIndex.Add("0")
+	bpr.ItemIndex = base.NewMapIndex()
+	bpr.ItemIndex.Add("1")
+	bpr.ItemIndex.Add("2")
+	bpr.UserFactor = [][]float32{{1, 2}}
+	bpr.ItemFactor = [][]float32{{3, 4}, {5, 6}}
+	s.rankingModel = bpr
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/embedding/user/0").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, Embedding{Id: "0", Vector: []float32{1, 2}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/embedding/item/2").
+		QueryParams(map[string]string{"model": RankingModelEmbedding}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, Embedding{Id: "2", Vector: []float32{5, 6}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/embedding/item/3").
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/embedding/item/1").
+		QueryParams(map[string]string{"model": ClickModelEmbedding}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	// export as JSON lines
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	w := httptest.NewRecorder()
+	s.exportItemEmbeddings(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, marshal(t, Embedding{Id: "1", Vector: []float32{3, 4}})+"\n"+
+		marshal(t, Embedding{Id: "2", Vector: []float32{5, 6}})+"\n", w.Body.String())
+	// export as binary
+	req = httptest.NewRequest("GET", "https://example.com/?format=binary", nil)
+	w = httptest.NewRecorder()
+	s.exportItemEmbeddings(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	var header [2]uint32
+	err := binary.Read(w.Body, binary.LittleEndian, &header)
+	assert.Nil(t, err)
+	assert.Equal(t, [2]uint32{2, 2}, header)
+	for _, expected := range []Embedding{{"1", []float32{3, 4}}, {"2", []float32{5, 6}}} {
+		var length uint32
+		err = binary.Read(w.Body, binary.LittleEndian, &length)
+		assert.Nil(t, err)
+		itemId := make([]byte, length)
+		_, err = w.Body.Read(itemId)
+		assert.Nil(t, err)
+		vector := make([]float32, header[1])
+		err = binary.Read(w.Body, binary.LittleEndian, vector)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, Embedding{Id: string(itemId), Vector: vector})
+	}
+	assert.Zero(t, w.Body.Len())
+	// unknown format
+	req = httptest.NewRequest("GET", "https://example.com/?format=csv", nil)
+	w = httptest.NewRecorder()
+	s.exportItemEmbeddings(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
 func TestMaster_ImportItems(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -159,9 +247,9 @@ func TestMaster_ImportItems(t *testing.T) {
 	_, items, err := s.DataClient.GetItems("", 100, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, []data.Item{
-		{"1", time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC), []string{"a", "b"}, "o,n,e"},
-		{"2", time.Date(2021, 1, 1, 1, 1, 1, 1, time.UTC), []string{"b", "c"}, "t\r\nw\r\no"},
-		{"3", time.Date(2022, 1, 1, 1, 1, 1, 1, time.UTC), []string{"c", "d"}, "\"three\""},
+		{ItemId: "1", Timestamp: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"a", "b"}, Comment: "o,n,e"},
+		{ItemId: "2", Timestamp: time.Date(2021, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"b", "c"}, Comment: "t\r\nw\r\no"},
+		{ItemId: "3", Timestamp: time.Date(2022, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"c", "d"}, Comment: "\"three\""},
 	}, items)
 }
 
@@ -190,9 +278,9 @@ func TestMaster_ImportItems_DefaultFormat(t *testing.T) {
 	_, items, err := s.DataClient.GetItems("", 100, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, []data.Item{
-		{"1", time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC), []string{"a", "b"}, "one"},
-		{"2", time.Date(2021, 1, 1, 1, 1, 1, 1, time.UTC), []string{"b", "c"}, "two"},
-		{"3", time.Date(2022, 1, 1, 1, 1, 1, 1, time.UTC), []string{"c", "d"}, "three"},
+		{ItemId: "1", Timestamp: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"a", "b"}, Comment: "one"},
+		{ItemId: "2", Timestamp: time.Date(2021, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"b", "c"}, Comment: "two"},
+		{ItemId: "3", Timestamp: time.Date(2022, 1, 1, 1, 1, 1, 1, time.UTC), Labels: []string{"c", "d"}, Comment: "three"},
 	}, items)
 }
 
@@ -371,7 +459,13 @@ func TestServer_List(t *testing.T) {
 			{"3", 97},
 			{"4", 96},
 		}
-		err := s.CacheClient.SetScores(operator.Prefix, operator.Label, itemIds)
+		var err error
+		switch operator.Prefix {
+		case cache.PopularItems, cache.LatestItems, cache.TrendingItems:
+			err = s.CacheClient.SetSorted(operator.Prefix, operator.Label, itemIds)
+		default:
+			err = s.CacheClient.SetScores(operator.Prefix, operator.Label, itemIds)
+		}
 		assert.Nil(t, err)
 		items := make([]data.Item, 0)
 		for _, item := range itemIds {
@@ -37,6 +37,7 @@ type Dataset struct {
 	Labels [][]int
 	Inputs [][]int
 	Target []float32
+	Values []float32 // graded values of samples used as targets in regression (optional)
 }
 
 // UserCount returns the number of users.
@@ -62,6 +63,14 @@ func (dataset *Dataset) Get(i int) ([]int, float32) {
 	return dataset.Inputs[i], dataset.Target[i]
 }
 
+// GetValue returns the i-th sample with its graded value. The target is returned if there are no values.
+func (dataset *Dataset) GetValue(i int) ([]int, float32) {
+	if dataset.Values == nil {
+		return dataset.Get(i)
+	}
+	return dataset.Inputs[i], dataset.Values[i]
+}
+
 // LoadLibFMFile loads libFM format file.
 func LoadLibFMFile(path string) (labels [][]int, targets []float32, maxLabel int, err error) {
 	labels = make([][]int, 0)
@@ -127,8 +136,10 @@ func LoadDataFromBuiltIn(name string) (train, test *Dataset, err error) {
 	return
 }
 
-// LoadDataFromDatabase load dataset from database.
-func LoadDataFromDatabase(database data.Database, clickTypes []string, readType string) (*Dataset, error) {
+// LoadDataFromDatabase load dataset from database. Targets of click feedback are 1 and targets of read feedback
+// are -1. Values of samples are weights of feedback, which are negated for read feedback. Attributes of users and
+// items are encoded as labels and context labels of feedback are appended to inputs.
+func LoadDataFromDatabase(database data.Database, clickTypes []string, readType string, feedbackWeights map[string]float32) (*Dataset, error) {
 	unifiedIndex := NewUnifiedMapIndexBuilder()
 	var err error
 	// pull users
@@ -146,6 +157,7 @@ func LoadDataFromDatabase(database data.Database, clickTypes []string, readType
 			for _, label := range user.Labels {
 				unifiedIndex.AddUserLabel(label)
 			}
+			unifiedIndex.AddUserAttributes(user.Attributes)
 		}
 		if cursor == "" {
 			break
@@ -166,6 +178,27 @@ func LoadDataFromDatabase(database data.Database, clickTypes []string, readType
 			for _, label := range item.Labels {
 				unifiedIndex.AddItemLabel(label)
 			}
+			unifiedIndex.AddItemAttributes(item.Attributes)
+		}
+		if cursor == "" {
+			break
+		}
+	}
+	// pull feedback
+	cursor = ""
+	feedbackTypes := append([]string{readType}, clickTypes...)
+	feedback := make([]data.Feedback, 0)
+	for {
+		var batchFeedback []data.Feedback
+		cursor, batchFeedback, err = database.GetFeedback(cursor, batchSize, nil, feedbackTypes...)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range batchFeedback {
+			feedback = append(feedback, v)
+			for _, label := range v.Context {
+				unifiedIndex.AddCtxLabel(label)
+			}
 		}
 		if cursor == "" {
 			break
@@ -175,6 +208,7 @@ func LoadDataFromDatabase(database data.Database, clickTypes []string, readType
 	dataSet := &Dataset{
 		Index:  unifiedIndex.Build(),
 		Target: make([]float32, 0),
+		Values: make([]float32, 0),
 	}
 	// insert users
 	dataSet.Labels = make([][]int, dataSet.Index.CountItems()+dataSet.Index.CountUsers())
@@ -184,6 +218,7 @@ func LoadDataFromDatabase(database data.Database, clickTypes []string, readType
 		for i := range user.Labels {
 			dataSet.Labels[userId][i] = dataSet.Index.EncodeUserLabel(user.Labels[i])
 		}
+		dataSet.Labels[userId] = append(dataSet.Labels[userId], dataSet.Index.EncodeUserAttributes(user.Attributes)...)
 	}
 	// insert items
 	for _, item := range items {
@@ -199,49 +234,43 @@ func LoadDataFromDatabase(database data.Database, clickTypes []string, readType
 					zap.String("label", label))
 			}
 		}
+		dataSet.Labels[itemIndex] = append(dataSet.Labels[itemIndex], dataSet.Index.EncodeItemAttributes(item.Attributes)...)
 	}
 	// insert feedback
-	cursor = ""
-	feedbackTypes := append([]string{readType}, clickTypes...)
 	positiveSet := make([]i32set.Set, len(users))
-	for {
-		var batchFeedback []data.Feedback
-		cursor, batchFeedback, err = database.GetFeedback(cursor, batchSize, nil, feedbackTypes...)
-		if err != nil {
-			return nil, err
+	for _, v := range feedback {
+		userId := dataSet.Index.EncodeUser(v.UserId)
+		if userId == base.NotId {
+			base.Logger().Warn("user not found", zap.String("user_id", v.UserId))
+			continue
 		}
-		for _, v := range batchFeedback {
-			userId := dataSet.Index.EncodeUser(v.UserId)
-			if userId == base.NotId {
-				base.Logger().Warn("user not found", zap.String("user_id", v.UserId))
-				continue
-			}
-			itemId := dataSet.Index.EncodeItem(v.ItemId)
-			if itemId == base.NotId {
-				base.Logger().Warn("item not found", zap.String("item_id", v.ItemId))
-				continue
-			}
-			if positiveSet[userId].IsEmpty() {
-				positiveSet[userId].Clear()
+		itemId := dataSet.Index.EncodeItem(v.ItemId)
+		if itemId == base.NotId {
+			base.Logger().Warn("item not found", zap.String("item_id", v.ItemId))
+			continue
+		}
+		if positiveSet[userId].IsEmpty() {
+			positiveSet[userId].Clear()
+		}
+		if !positiveSet[userId].Has(int32(itemId)) {
+			// build input vector
+			input := []int{userId, itemId}
+			input = append(input, dataSet.Labels[userId]...)
+			input = append(input, dataSet.Labels[itemId]...)
+			for _, label := range v.Context {
+				input = append(input, dataSet.Index.EncodeContextLabel(label))
 			}
-			if !positiveSet[userId].Has(int32(itemId)) {
-				// build input vector
-				input := []int{userId, itemId}
-				input = append(input, dataSet.Labels[userId]...)
-				input = append(input, dataSet.Labels[itemId]...)
-				dataSet.Inputs = append(dataSet.Inputs, input)
-				// positive or negative
-				if v.FeedbackType == readType {
-					dataSet.Target = append(dataSet.Target, -1)
-				} else {
-					positiveSet[userId].Add(int32(itemId))
-					dataSet.Target = append(dataSet.Target, 1)
-				}
+			dataSet.Inputs = append(dataSet.Inputs, input)
+			// positive or negative
+			if v.FeedbackType == readType {
+				dataSet.Target = append(dataSet.Target, -1)
+				dataSet.Values = append(dataSet.Values, -v.Weight(feedbackWeights))
+			} else {
+				positiveSet[userId].Add(int32(itemId))
+				dataSet.Target = append(dataSet.Target, 1)
+				dataSet.Values = append(dataSet.Values, v.Weight(feedbackWeights))
 			}
 		}
-		if cursor == "" {
-			break
-		}
 	}
 	return dataSet, nil
 }
@@ -266,10 +295,16 @@ func (dataset *Dataset) Split(ratio float32, seed int64) (*Dataset, *Dataset) {
 			// add samples into test set
 			testSet.Inputs = append(testSet.Inputs, dataset.Inputs[i])
 			testSet.Target = append(testSet.Target, dataset.Target[i])
+			if dataset.Values != nil {
+				testSet.Values = append(testSet.Values, dataset.Values[i])
+			}
 		} else {
 			// add samples into train set
 			trainSet.Inputs = append(trainSet.Inputs, dataset.Inputs[i])
 			trainSet.Target = append(trainSet.Target, dataset.Target[i])
+			if dataset.Values != nil {
+				trainSet.Values = append(trainSet.Values, dataset.Values[i])
+			}
 		}
 	}
 	return trainSet, testSet
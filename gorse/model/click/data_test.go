@@ -92,17 +92,38 @@ func TestLoadDataFromDatabase(t *testing.T) {
 						ItemId:       fmt.Sprintf("item%v", j),
 						FeedbackType: "click",
 					},
+					Context: []string{fmt.Sprintf("ctx_label%v", j%2)},
 				}, false, false)
 				assert.Nil(t, err)
 			}
 		}
 	}
 	// load data
-	dataset, err := LoadDataFromDatabase(database.Database, []string{"click"}, "read")
+	dataset, err := LoadDataFromDatabase(database.Database, []string{"click"}, "read", map[string]float32{"click": 2, "read": 0.5})
 	assert.Nil(t, err)
 	assert.Equal(t, numUsers*numItems, dataset.Count())
+	assert.Equal(t, numUsers*numItems, len(dataset.Values))
+	for i := 0; i < dataset.Count(); i++ {
+		_, target := dataset.Get(i)
+		_, value := dataset.GetValue(i)
+		// values of read feedback are negative
+		if target > 0 {
+			assert.Equal(t, float32(2), value)
+		} else {
+			assert.Equal(t, float32(-0.5), value)
+		}
+	}
 	assert.Equal(t, numUsers, dataset.UserCount())
 	assert.Equal(t, numItems, dataset.ItemCount())
+	assert.Equal(t, 2, dataset.Index.CountContextLabels())
+	for i := 0; i < dataset.Count(); i++ {
+		input, target := dataset.Get(i)
+		// inputs of click feedback end with context labels
+		if target > 0 {
+			itemIndex := input[1] - numUsers
+			assert.Equal(t, dataset.Index.EncodeContextLabel(fmt.Sprintf("ctx_label%v", itemIndex%2)), input[len(input)-1])
+		}
+	}
 	// split
 	train, test := dataset.Split(0.2, 0)
 	assert.Equal(t, numUsers, train.UserCount())
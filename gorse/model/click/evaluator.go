@@ -19,12 +19,12 @@ import (
 	"github.com/chewxy/math32"
 )
 
-// EvaluateRegression evaluates factorization machines in regression task.
+// EvaluateRegression evaluates factorization machines in regression task. Graded values are used as targets if exist.
 func EvaluateRegression(estimator FactorizationMachine, testSet *Dataset) Score {
 	sum := float32(0)
 	// For all UserFeedback
 	for i := 0; i < testSet.Count(); i++ {
-		labels, target := testSet.Get(i)
+		labels, target := testSet.GetValue(i)
 		prediction := estimator.InternalPredict(labels)
 		sum += (target - prediction) * (target - prediction)
 	}
@@ -55,6 +55,7 @@ func EvaluateClassification(estimator FactorizationMachine, testSet *Dataset) Sc
 type SnapshotManger struct {
 	BestWeights []interface{}
 	BestScore   Score
+	numStale    int // number of snapshots after the best snapshot
 }
 
 // AddSnapshot adds a copied snapshot.
@@ -66,5 +67,14 @@ func (sm *SnapshotManger) AddSnapshot(score Score, weights ...interface{}) {
 		} else {
 			sm.BestWeights = temp.([]interface{})
 		}
+		sm.numStale = 0
+	} else {
+		sm.numStale++
 	}
 }
+
+// EarlyStop returns true if the best score hasn't been improved for the last patience snapshots. Early stopping
+// is disabled if patience is zero.
+func (sm *SnapshotManger) EarlyStop(patience int) bool {
+	return patience > 0 && sm.numStale >= patience
+}
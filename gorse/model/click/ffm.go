@@ -0,0 +1,321 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package click
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chewxy/math32"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/floats"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"go.uber.org/zap"
+)
+
+// ffmCrossBits is the number of bits of hashed cross features.
+const ffmCrossBits = 20
+
+// crossHash hashes the cross feature of a pair of features into [0, 2^ffmCrossBits).
+func crossHash(i, j int) int {
+	return int((uint64(i)<<32 | uint64(j)) * 0x9E3779B97F4A7C15 >> (64 - ffmCrossBits))
+}
+
+// FFM is the field-aware factorization machine [1]. Each feature has a latent factor for each field and the
+// interaction between feature i and feature j is estimated by:
+//
+//   <v_{i,f_j}, v_{j,f_i}>
+//
+// where f_i is the field of feature i. Fields are users, items, user labels, item labels and context labels
+// tracked by the unified index. Linear weights of cross features between features from different fields are
+// learned if cross features are used, which are hashed into 2^20 buckets.
+//
+// Hyper-parameters:
+//	 Reg 		- The regularization parameter of the cost function that is
+// 				  optimized. Default is 0.
+//	 Lr 		- The learning rate of SGD. Default is 0.01.
+//	 NFactors	- The number of latent factors for each field. Default is 8.
+//	 NEpochs	- The number of iteration of the SGD procedure. Default is 200.
+//	 InitMean	- The mean of initial random latent factors. Default is 0.
+//	 InitStdDev	- The standard deviation of initial random latent factors. Default is 0.01.
+//	 UseFeature	- Use features other than users and items. Default is true.
+//	 UseCross	- Use linear cross features. Default is false.
+//
+// [1] Juan, Yuchin, et al. "Field-aware factorization machines for CTR prediction." Proceedings of the 10th ACM
+// conference on recommender systems. 2016.
+type FFM struct {
+	BaseFactorizationMachine
+	// Model parameters
+	V         [][][]float32 // V[i][f] is the latent factor of feature i for field f
+	W         []float32
+	C         []float32 // weights of hashed cross features
+	B         float32
+	MinTarget float32
+	MaxTarget float32
+	Task      FMTask
+	// Hyper parameters
+	nFactors   int
+	nEpochs    int
+	lr         float32
+	reg        float32
+	initMean   float32
+	initStdDev float32
+	// Special options
+	useFeature bool
+	useCross   bool
+}
+
+func (ffm *FFM) GetParamsGrid() model.ParamsGrid {
+	return model.ParamsGrid{
+		model.NFactors:   []interface{}{4, 8, 16, 32},
+		model.Lr:         []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.Reg:        []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.InitMean:   []interface{}{0},
+		model.InitStdDev: []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.UseCross:   []interface{}{true, false},
+	}
+}
+
+func (ffm *FFM) GetParamsSpace() model.ParamsSpace {
+	return model.ParamsSpace{
+		model.NFactors:   model.NewChoices(4, 8, 16, 32),
+		model.Lr:         model.NewLogRange(0.001, 0.1),
+		model.Reg:        model.NewLogRange(0.001, 0.1),
+		model.InitMean:   model.NewChoices(0),
+		model.InitStdDev: model.NewLogRange(0.001, 0.1),
+		model.UseCross:   model.NewChoices(true, false),
+	}
+}
+
+// NewFFM creates a field-aware factorization machine.
+func NewFFM(task FMTask, params model.Params) *FFM {
+	ffm := new(FFM)
+	ffm.Task = task
+	ffm.SetParams(params)
+	return ffm
+}
+
+func (ffm *FFM) SetParams(params model.Params) {
+	ffm.BaseFactorizationMachine.SetParams(params)
+	// Setup hyper-parameters
+	ffm.nFactors = ffm.Params.GetInt(model.NFactors, 8)
+	ffm.nEpochs = ffm.Params.GetInt(model.NEpochs, 200)
+	ffm.lr = ffm.Params.GetFloat32(model.Lr, 0.01)
+	ffm.reg = ffm.Params.GetFloat32(model.Reg, 0.0)
+	ffm.initMean = ffm.Params.GetFloat32(model.InitMean, 0)
+	ffm.initStdDev = ffm.Params.GetFloat32(model.InitStdDev, 0.01)
+	ffm.useFeature = ffm.Params.GetBool(model.UseFeature, true)
+	ffm.useCross = ffm.Params.GetBool(model.UseCross, false)
+}
+
+// Predict the click-through-rate of a item with labels and attributes for a user in a context. Unknown labels
+// are ignored.
+func (ffm *FFM) Predict(userId, itemId string, itemLabels []string, itemAttributes data.Attributes, ctxLabels []string) float32 {
+	return ffm.InternalPredict(encodeInput(ffm.Index, userId, itemId, itemLabels, itemAttributes, ctxLabels))
+}
+
+// GetUserFactor returns the latent factor of a user for the field of items. Nil is returned if the user doesn't exist.
+func (ffm *FFM) GetUserFactor(userId string) []float32 {
+	if userIndex := ffm.Index.EncodeUser(userId); userIndex != base.NotId {
+		return ffm.V[userIndex][ItemField]
+	}
+	return nil
+}
+
+// GetItemFactor returns the latent factor of an item for the field of users. Nil is returned if the item doesn't
+// exist.
+func (ffm *FFM) GetItemFactor(itemId string) []float32 {
+	if itemIndex := ffm.Index.EncodeItem(itemId); itemIndex != base.NotId {
+		return ffm.V[itemIndex][UserField]
+	}
+	return nil
+}
+
+func (ffm *FFM) internalPredict(x []int) float32 {
+	if !ffm.useFeature {
+		// The input vector must be formatted as [user_id, item_id, ...]
+		x = x[:2]
+	}
+	// w_0
+	pred := ffm.B
+	// \sum^n_{i=1} w_i x_i
+	for _, i := range x {
+		pred += ffm.W[i]
+	}
+	// \sum^n_{i=1}\sum^n_{j=i+1} <v_{i,f_j},v_{j,f_i}> x_i x_j
+	for a, i := range x {
+		fieldI := ffm.Index.GetField(i)
+		for _, j := range x[a+1:] {
+			fieldJ := ffm.Index.GetField(j)
+			pred += floats.Dot(ffm.V[i][fieldJ], ffm.V[j][fieldI])
+			if ffm.useCross && fieldI != fieldJ {
+				pred += ffm.C[crossHash(i, j)]
+			}
+		}
+	}
+	return pred
+}
+
+func (ffm *FFM) InternalPredict(x []int) float32 {
+	pred := ffm.internalPredict(x)
+	if ffm.Task == FMRegression {
+		if pred < ffm.MinTarget {
+			pred = ffm.MinTarget
+		} else if pred > ffm.MaxTarget {
+			pred = ffm.MaxTarget
+		}
+	}
+	return pred
+}
+
+func (ffm *FFM) Fit(trainSet, testSet *Dataset, config *FitConfig) Score {
+	config = config.LoadDefaultIfNil()
+	base.Logger().Info("fit FFM",
+		zap.Int("train_size", trainSet.Count()),
+		zap.Int("test_size", testSet.Count()),
+		zap.String("task", string(ffm.Task)),
+		zap.Any("params", ffm.GetParams()),
+		zap.Any("config", config))
+	ffm.Init(trainSet)
+	vGrad := base.NewMatrix32(config.Jobs, ffm.nFactors)
+
+	snapshots := SnapshotManger{}
+	evalStart := time.Now()
+	score := evaluate(ffm, ffm.Task, testSet)
+	evalTime := time.Since(evalStart)
+	base.Logger().Debug(fmt.Sprintf("fit ffm %v/%v", 0, ffm.nEpochs),
+		zap.String("eval_time", evalTime.String()),
+		zap.Float32(score.GetName(), score.GetValue()))
+	snapshots.AddSnapshot(score, ffm.V, ffm.W, ffm.C, ffm.B)
+	config.Curve.AddScore(0, score)
+
+	for epoch := 1; epoch <= ffm.nEpochs; epoch++ {
+		for i := 0; i < trainSet.Count(); i++ {
+			_, target := sample(ffm.Task, trainSet, i)
+			ffm.MinTarget = math32.Min(ffm.MinTarget, target)
+			ffm.MaxTarget = math32.Max(ffm.MaxTarget, target)
+		}
+		fitStart := time.Now()
+		cost := float32(0)
+		_ = base.BatchParallel(trainSet.Count(), config.Jobs, 128, func(workerId, beginJobId, endJobId int) error {
+			for i := beginJobId; i < endJobId; i++ {
+				labels, target := sample(ffm.Task, trainSet, i)
+				if !ffm.useFeature {
+					// The input vector must be formatted as [user_id, item_id, ...]
+					labels = labels[:2]
+				}
+				prediction := ffm.internalPredict(labels)
+				var grad float32
+				switch ffm.Task {
+				case FMRegression:
+					grad = prediction - target
+					cost += grad * grad / 2
+				case FMClassification:
+					grad = -target * (1 - 1/(1+math32.Exp(-target*prediction)))
+					cost += (1 + target) * math32.Log(1+math32.Exp(-prediction)) / 2
+					cost += (1 - target) * math32.Log(1+math32.Exp(prediction)) / 2
+				default:
+					base.Logger().Fatal("unknown task", zap.String("task", string(ffm.Task)))
+				}
+				// Update w_0
+				ffm.B -= ffm.lr * grad
+				for a, i := range labels {
+					// Update w_i
+					ffm.W[i] -= ffm.lr * grad
+					fieldI := ffm.Index.GetField(i)
+					for _, j := range labels[a+1:] {
+						fieldJ := ffm.Index.GetField(j)
+						// Update v_{i,f_j} and v_{j,f_i}
+						floats.MulConstTo(ffm.V[j][fieldI], grad, vGrad[workerId])
+						floats.MulConstAddTo(ffm.V[i][fieldJ], ffm.reg, vGrad[workerId])
+						floats.MulConst(ffm.V[j][fieldI], 1-ffm.lr*ffm.reg)
+						floats.MulConstAddTo(ffm.V[i][fieldJ], -ffm.lr*grad, ffm.V[j][fieldI])
+						floats.MulConstAddTo(vGrad[workerId], -ffm.lr, ffm.V[i][fieldJ])
+						// Update c_{ij}
+						if ffm.useCross && fieldI != fieldJ {
+							ffm.C[crossHash(i, j)] -= ffm.lr * grad
+						}
+					}
+				}
+			}
+			return nil
+		})
+		fitTime := time.Since(fitStart)
+		config.Curve.AddLoss(epoch, cost)
+		// Cross validation
+		if epoch%config.Verbose == 0 || epoch == ffm.nEpochs {
+			evalStart := time.Now()
+			score := evaluate(ffm, ffm.Task, testSet)
+			evalTime := time.Since(evalStart)
+			base.Logger().Debug(fmt.Sprintf("fit ffm %v/%v", epoch, ffm.nEpochs),
+				zap.String("fit_time", fitTime.String()),
+				zap.String("eval_time", evalTime.String()),
+				zap.Float32("loss", cost),
+				zap.Float32(score.GetName(), score.GetValue()))
+			// check NaN
+			if math32.IsNaN(cost) || math32.IsNaN(score.GetValue()) {
+				base.Logger().Warn("model diverged", zap.Float32("lr", ffm.lr))
+				break
+			}
+			snapshots.AddSnapshot(score, ffm.V, ffm.W, ffm.C, ffm.B)
+			config.Curve.AddScore(epoch, score)
+			if snapshots.EarlyStop(config.Patience) {
+				base.Logger().Info(fmt.Sprintf("early stop ffm at %v/%v", epoch, ffm.nEpochs))
+				break
+			}
+		}
+	}
+	// restore best snapshot
+	ffm.V = snapshots.BestWeights[0].([][][]float32)
+	ffm.W = snapshots.BestWeights[1].([]float32)
+	ffm.C = snapshots.BestWeights[2].([]float32)
+	ffm.B = snapshots.BestWeights[3].(float32)
+	base.Logger().Info("fit ffm complete",
+		zap.Float32(snapshots.BestScore.GetName(), snapshots.BestScore.GetValue()))
+	return snapshots.BestScore
+}
+
+func (ffm *FFM) Clear() {
+	ffm.B = 0.0
+	ffm.V = nil
+	ffm.W = nil
+	ffm.C = nil
+	ffm.Index = nil
+}
+
+func (ffm *FFM) Invalid() bool {
+	return ffm == nil ||
+		ffm.V == nil ||
+		ffm.W == nil ||
+		ffm.Index == nil
+}
+
+func (ffm *FFM) Init(trainSet *Dataset) {
+	ffm.V = make([][][]float32, trainSet.Index.Len())
+	for i := range ffm.V {
+		ffm.V[i] = ffm.GetRandomGenerator().NormalMatrix(trainSet.Index.CountFields(), ffm.nFactors, ffm.initMean, ffm.initStdDev)
+	}
+	ffm.W = make([]float32, trainSet.Index.Len())
+	if ffm.useCross {
+		ffm.C = make([]float32, 1<<ffmCrossBits)
+	} else {
+		ffm.C = nil
+	}
+	ffm.B = 0
+	ffm.MinTarget = math32.Inf(1)
+	ffm.MaxTarget = math32.Inf(-1)
+	ffm.BaseFactorizationMachine.Init(trainSet)
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package click
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/storage/data"
+)
+
+// newLabeledDataset creates a dataset where users click items if labels of users and items match.
+func newLabeledDataset(numUsers, numItems, numLabels int) *Dataset {
+	builder := NewUnifiedMapIndexBuilder()
+	for i := 0; i < numUsers; i++ {
+		builder.AddUser(fmt.Sprintf("user%v", i))
+	}
+	for i := 0; i < numItems; i++ {
+		builder.AddItem(fmt.Sprintf("item%v", i))
+	}
+	for i := 0; i < numLabels; i++ {
+		builder.AddUserLabel(fmt.Sprintf("label%v", i))
+		builder.AddItemLabel(fmt.Sprintf("label%v", i))
+	}
+	dataset := &Dataset{Index: builder.Build()}
+	for i := 0; i < numUsers; i++ {
+		userIndex := dataset.Index.EncodeUser(fmt.Sprintf("user%v", i))
+		userLabelIndex := dataset.Index.EncodeUserLabel(fmt.Sprintf("label%v", i%numLabels))
+		for j := 0; j < numItems; j++ {
+			itemIndex := dataset.Index.EncodeItem(fmt.Sprintf("item%v", j))
+			itemLabelIndex := dataset.Index.EncodeItemLabel(fmt.Sprintf("label%v", j%numLabels))
+			dataset.Inputs = append(dataset.Inputs, []int{userIndex, itemIndex, userLabelIndex, itemLabelIndex})
+			if i%numLabels == j%numLabels {
+				dataset.Target = append(dataset.Target, 1)
+			} else {
+				dataset.Target = append(dataset.Target, -1)
+			}
+		}
+	}
+	return dataset
+}
+
+func TestFFM_Classification(t *testing.T) {
+	train, test := newLabeledDataset(20, 20, 3).Split(0.2, 0)
+	for _, useCross := range []bool{false, true} {
+		m := NewFFM(FMClassification, model.Params{
+			model.NFactors: 4,
+			model.NEpochs:  20,
+			model.Lr:       0.05,
+			model.UseCross: useCross,
+		})
+		score := m.Fit(train, test, fitConfig)
+		assert.Greater(t, score.Precision, float32(0.9))
+		index := train.Index
+		assert.Greater(t, m.InternalPredict([]int{index.EncodeUser("user0"), index.EncodeItem("item3"),
+			index.EncodeUserLabel("label0"), index.EncodeItemLabel("label0")}), float32(0))
+		assert.Less(t, m.InternalPredict([]int{index.EncodeUser("user0"), index.EncodeItem("item4"),
+			index.EncodeUserLabel("label0"), index.EncodeItemLabel("label1")}), float32(0))
+		// test encode and decode
+		buf, err := EncodeModel(m)
+		assert.NoError(t, err)
+		decoded, err := DecodeModel(buf)
+		assert.NoError(t, err)
+		assert.IsType(t, &FFM{}, decoded)
+		assert.Equal(t, m.Predict("user0", "item3", []string{"label0"}, data.Attributes{}, nil),
+			decoded.Predict("user0", "item3", []string{"label0"}, data.Attributes{}, nil))
+		// test clear
+		m.Clear()
+		assert.True(t, m.Invalid())
+	}
+}
+
+func TestFFM_Regression(t *testing.T) {
+	train, test := newLabeledDataset(20, 20, 3).Split(0.2, 0)
+	m := NewFFM(FMRegression, model.Params{
+		model.NFactors: 4,
+		model.NEpochs:  20,
+		model.Lr:       0.05,
+	})
+	score := m.Fit(train, test, fitConfig)
+	assert.Less(t, score.RMSE, float32(0.5))
+}
+
+func TestFFM_Embedding(t *testing.T) {
+	train, test := newLabeledDataset(20, 20, 3).Split(0.2, 0)
+	var m EmbeddingModel = NewFFM(FMClassification, model.Params{model.NFactors: 4, model.NEpochs: 5})
+	m.Fit(train, test, fitConfig)
+	assert.Len(t, m.GetUserFactor("user0"), 4)
+	assert.Len(t, m.GetItemFactor("item0"), 4)
+	assert.Nil(t, m.GetUserFactor("unknown"))
+	assert.Nil(t, m.GetItemFactor("unknown"))
+	assert.Len(t, m.GetItems(), 20)
+}
+
+func TestEncodeModel(t *testing.T) {
+	train, test := newLabeledDataset(20, 20, 3).Split(0.2, 0)
+	m := NewFM(FMClassification, model.Params{model.NFactors: 4, model.NEpochs: 5})
+	m.Fit(train, test, fitConfig)
+	buf, err := EncodeModel(m)
+	assert.NoError(t, err)
+	decoded, err := DecodeModel(buf)
+	assert.NoError(t, err)
+	assert.IsType(t, &FM{}, decoded)
+	assert.Equal(t, m.GetParams(), decoded.GetParams())
+	assert.Equal(t, m.Predict("user0", "item3", []string{"label0"}, data.Attributes{}, nil),
+		decoded.Predict("user0", "item3", []string{"label0"}, data.Attributes{}, nil))
+	// decode a model encoded as a concrete factorization machine
+	buf2 := bytes.NewBuffer(nil)
+	err = gob.NewEncoder(buf2).Encode(m)
+	assert.NoError(t, err)
+	decoded, err = DecodeModel(buf2.Bytes())
+	assert.NoError(t, err)
+	assert.IsType(t, &FM{}, decoded)
+	assert.Equal(t, m.GetParams(), decoded.GetParams())
+	assert.Equal(t, m.Predict("user0", "item3", []string{"label0"}, data.Attributes{}, nil),
+		decoded.Predict("user0", "item3", []string{"label0"}, data.Attributes{}, nil))
+}
+
+func TestFFM_EarlyStop(t *testing.T) {
+	train, test := newLabeledDataset(20, 20, 3).Split(0.2, 0)
+	// scores never improve if the learning rate is zero
+	m := NewFFM(FMClassification, model.Params{model.NFactors: 4, model.NEpochs: 20, model.Lr: 0})
+	config := &FitConfig{Jobs: 1, Verbose: 1, Patience: 1, Curve: &LearningCurve{}}
+	m.Fit(train, test, config)
+	assert.Equal(t, []int{1}, config.Curve.Epochs)
+	assert.Greater(t, config.Curve.Losses[0], float32(0))
+	assert.Equal(t, []int{0, 1}, config.Curve.EvalEpochs)
+	assert.Equal(t, 2, len(config.Curve.Scores))
+}
@@ -26,9 +26,15 @@ import (
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/floats"
 	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/storage/data"
 	"go.uber.org/zap"
 )
 
+func init() {
+	gob.Register(&FM{})
+	gob.Register(&FFM{})
+}
+
 type Score struct {
 	Task      FMTask
 	RMSE      float32
@@ -76,9 +82,37 @@ func (score Score) BetterThan(s Score) bool {
 	}
 }
 
+// LearningCurve records training losses of every epoch and scores of evaluated epochs during fitting. Models are
+// evaluated every Verbose epochs, so there are fewer scores than losses.
+type LearningCurve struct {
+	Epochs     []int     // epochs with training losses
+	Losses     []float32 // training losses
+	EvalEpochs []int     // evaluated epochs
+	Scores     []Score   // scores of evaluated epochs
+}
+
+// AddLoss appends the training loss of an epoch to the learning curve. Nothing happens if the learning curve is nil.
+func (curve *LearningCurve) AddLoss(epoch int, loss float32) {
+	if curve != nil {
+		curve.Epochs = append(curve.Epochs, epoch)
+		curve.Losses = append(curve.Losses, loss)
+	}
+}
+
+// AddScore appends the score of an evaluated epoch to the learning curve. Nothing happens if the learning curve
+// is nil.
+func (curve *LearningCurve) AddScore(epoch int, score Score) {
+	if curve != nil {
+		curve.EvalEpochs = append(curve.EvalEpochs, epoch)
+		curve.Scores = append(curve.Scores, score)
+	}
+}
+
 type FitConfig struct {
-	Jobs    int
-	Verbose int
+	Jobs     int
+	Verbose  int            // evaluate every Verbose epochs, where early stopping is checked
+	Patience int            // stop fitting if scores aren't improved for Patience evaluations (0 means disabled)
+	Curve    *LearningCurve // learning curve recorded during fitting (optional)
 }
 
 func NewFitConfig() *FitConfig {
@@ -93,6 +127,11 @@ func (config *FitConfig) SetJobs(nJobs int) *FitConfig {
 	return config
 }
 
+func (config *FitConfig) SetPatience(patience int) *FitConfig {
+	config.Patience = patience
+	return config
+}
+
 func (config *FitConfig) LoadDefaultIfNil() *FitConfig {
 	if config == nil {
 		return NewFitConfig()
@@ -102,16 +141,33 @@ func (config *FitConfig) LoadDefaultIfNil() *FitConfig {
 
 type FactorizationMachine interface {
 	model.Model
-	Predict(userId, itemId string, itemLabels []string) float32
+	Predict(userId, itemId string, itemLabels []string, itemAttributes data.Attributes, ctxLabels []string) float32
 	InternalPredict(x []int) float32
 	Fit(trainSet *Dataset, testSet *Dataset, config *FitConfig) Score
 }
 
+// EmbeddingModel is a factorization machine providing latent factors of users and items. The interaction between
+// a user and an item is the dot product of their factors.
+type EmbeddingModel interface {
+	FactorizationMachine
+	// GetUserFactor returns the latent factor of a user. Nil is returned if the user doesn't exist.
+	GetUserFactor(userId string) []float32
+	// GetItemFactor returns the latent factor of an item. Nil is returned if the item doesn't exist.
+	GetItemFactor(itemId string) []float32
+	// GetItems returns items in the model.
+	GetItems() []string
+}
+
 type BaseFactorizationMachine struct {
 	model.BaseModel
 	Index UnifiedIndex
 }
 
+// GetItems returns items in the index of the model.
+func (b *BaseFactorizationMachine) GetItems() []string {
+	return b.Index.GetItems()
+}
+
 func (b *BaseFactorizationMachine) Init(trainSet *Dataset) {
 	b.Index = trainSet.Index
 }
@@ -153,6 +209,16 @@ func (fm *FM) GetParamsGrid() model.ParamsGrid {
 	}
 }
 
+func (fm *FM) GetParamsSpace() model.ParamsSpace {
+	return model.ParamsSpace{
+		model.NFactors:   model.NewChoices(8, 16, 32, 64, 128),
+		model.Lr:         model.NewLogRange(0.001, 0.1),
+		model.Reg:        model.NewLogRange(0.001, 0.1),
+		model.InitMean:   model.NewChoices(0),
+		model.InitStdDev: model.NewLogRange(0.001, 0.1),
+	}
+}
+
 func NewFM(task FMTask, params model.Params) *FM {
 	fm := new(FM)
 	fm.Task = task
@@ -172,20 +238,50 @@ func (fm *FM) SetParams(params model.Params) {
 	fm.useFeature = fm.Params.GetBool(model.UseFeature, true)
 }
 
-func (fm *FM) Predict(userId, itemId string, itemLabels []string) float32 {
+// Predict the click-through-rate of a item with labels and attributes for a user in a context. Unknown labels
+// are ignored.
+func (fm *FM) Predict(userId, itemId string, itemLabels []string, itemAttributes data.Attributes, ctxLabels []string) float32 {
+	return fm.InternalPredict(encodeInput(fm.Index, userId, itemId, itemLabels, itemAttributes, ctxLabels))
+}
+
+// encodeInput encodes a user, a item with labels and attributes and context labels to a input vector. Unknown
+// labels are ignored.
+func encodeInput(index UnifiedIndex, userId, itemId string, itemLabels []string, itemAttributes data.Attributes, ctxLabels []string) []int {
 	x := make([]int, 0)
-	if userIndex := fm.Index.EncodeUser(userId); userIndex != base.NotId {
+	if userIndex := index.EncodeUser(userId); userIndex != base.NotId {
 		x = append(x, userIndex)
 	}
-	if itemIndex := fm.Index.EncodeItem(itemId); itemIndex != base.NotId {
+	if itemIndex := index.EncodeItem(itemId); itemIndex != base.NotId {
 		x = append(x, itemIndex)
 	}
 	for _, itemLabel := range itemLabels {
-		if itemLabelIndex := fm.Index.EncodeItemLabel(itemLabel); itemLabelIndex != base.NotId {
+		if itemLabelIndex := index.EncodeItemLabel(itemLabel); itemLabelIndex != base.NotId {
 			x = append(x, itemLabelIndex)
 		}
 	}
-	return fm.InternalPredict(x)
+	x = append(x, index.EncodeItemAttributes(itemAttributes)...)
+	for _, ctxLabel := range ctxLabels {
+		if ctxLabelIndex := index.EncodeContextLabel(ctxLabel); ctxLabelIndex != base.NotId {
+			x = append(x, ctxLabelIndex)
+		}
+	}
+	return x
+}
+
+// GetUserFactor returns the latent factor of a user. Nil is returned if the user doesn't exist.
+func (fm *FM) GetUserFactor(userId string) []float32 {
+	if userIndex := fm.Index.EncodeUser(userId); userIndex != base.NotId {
+		return fm.V[userIndex]
+	}
+	return nil
+}
+
+// GetItemFactor returns the latent factor of a item. Nil is returned if the item doesn't exist.
+func (fm *FM) GetItemFactor(itemId string) []float32 {
+	if itemIndex := fm.Index.EncodeItem(itemId); itemIndex != base.NotId {
+		return fm.V[itemIndex]
+	}
+	return nil
 }
 
 func (fm *FM) internalPredict(x []int) float32 {
@@ -228,6 +324,27 @@ func (fm *FM) InternalPredict(x []int) float32 {
 	return pred
 }
 
+// sample returns the i-th sample for training. Graded values are used as targets in regression.
+func sample(task FMTask, dataset *Dataset, i int) ([]int, float32) {
+	if task == FMRegression {
+		return dataset.GetValue(i)
+	}
+	return dataset.Get(i)
+}
+
+// evaluate evaluates a factorization machine by the metric of the task.
+func evaluate(m FactorizationMachine, task FMTask, testSet *Dataset) Score {
+	switch task {
+	case FMRegression:
+		return EvaluateRegression(m, testSet)
+	case FMClassification:
+		return EvaluateClassification(m, testSet)
+	default:
+		base.Logger().Fatal("unknown task", zap.String("task", string(task)))
+	}
+	return Score{}
+}
+
 func (fm *FM) Fit(trainSet, testSet *Dataset, config *FitConfig) Score {
 	config = config.LoadDefaultIfNil()
 	base.Logger().Info("fit FM",
@@ -242,23 +359,17 @@ func (fm *FM) Fit(trainSet, testSet *Dataset, config *FitConfig) Score {
 
 	snapshots := SnapshotManger{}
 	evalStart := time.Now()
-	var score Score
-	switch fm.Task {
-	case FMRegression:
-		score = EvaluateRegression(fm, testSet)
-	case FMClassification:
-		score = EvaluateClassification(fm, testSet)
-	default:
-		base.Logger().Fatal("unknown task", zap.String("task", string(fm.Task)))
-	}
+	score := evaluate(fm, fm.Task, testSet)
 	evalTime := time.Since(evalStart)
 	base.Logger().Debug(fmt.Sprintf("fit fm %v/%v", 0, fm.nEpochs),
 		zap.String("eval_time", evalTime.String()),
 		zap.Float32(score.GetName(), score.GetValue()))
 	snapshots.AddSnapshot(score, fm.V, fm.W, fm.B)
+	config.Curve.AddScore(0, score)
 
 	for epoch := 1; epoch <= fm.nEpochs; epoch++ {
-		for _, target := range trainSet.Target {
+		for i := 0; i < trainSet.Count(); i++ {
+			_, target := sample(fm.Task, trainSet, i)
 			fm.MinTarget = math32.Min(fm.MinTarget, target)
 			fm.MaxTarget = math32.Max(fm.MaxTarget, target)
 		}
@@ -266,7 +377,7 @@ func (fm *FM) Fit(trainSet, testSet *Dataset, config *FitConfig) Score {
 		cost := float32(0)
 		_ = base.BatchParallel(trainSet.Count(), config.Jobs, 128, func(workerId, beginJobId, endJobId int) error {
 			for i := beginJobId; i < endJobId; i++ {
-				labels, target := trainSet.Get(i)
+				labels, target := sample(fm.Task, trainSet, i)
 				if !fm.useFeature {
 					// The input vector must be formatted as [user_id, item_id, ...]
 					labels = labels[:2]
@@ -304,18 +415,11 @@ func (fm *FM) Fit(trainSet, testSet *Dataset, config *FitConfig) Score {
 			return nil
 		})
 		fitTime := time.Since(fitStart)
+		config.Curve.AddLoss(epoch, cost)
 		// Cross validation
 		if epoch%config.Verbose == 0 || epoch == fm.nEpochs {
 			evalStart := time.Now()
-			var score Score
-			switch fm.Task {
-			case FMRegression:
-				score = EvaluateRegression(fm, testSet)
-			case FMClassification:
-				score = EvaluateClassification(fm, testSet)
-			default:
-				base.Logger().Fatal("unknown task", zap.String("task", string(fm.Task)))
-			}
+			score := evaluate(fm, fm.Task, testSet)
 			evalTime := time.Since(evalStart)
 			base.Logger().Debug(fmt.Sprintf("fit fm %v/%v", epoch, fm.nEpochs),
 				zap.String("fit_time", fitTime.String()),
@@ -328,6 +432,11 @@ func (fm *FM) Fit(trainSet, testSet *Dataset, config *FitConfig) Score {
 				break
 			}
 			snapshots.AddSnapshot(score, fm.V, fm.W, fm.B)
+			config.Curve.AddScore(epoch, score)
+			if snapshots.EarlyStop(config.Patience) {
+				base.Logger().Info(fmt.Sprintf("early stop fm at %v/%v", epoch, fm.nEpochs))
+				break
+			}
 		}
 	}
 	// restore best snapshot
@@ -393,11 +502,12 @@ func (fm *FM) Init(trainSet *Dataset) {
 	fm.BaseFactorizationMachine.Init(trainSet)
 }
 
+// EncodeModel encodes a factorization machine with its type.
 func EncodeModel(m FactorizationMachine) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
 	writer := bufio.NewWriter(buf)
 	encoder := gob.NewEncoder(writer)
-	if err := encoder.Encode(m); err != nil {
+	if err := encoder.Encode(&m); err != nil {
 		return nil, err
 	}
 	if err := writer.Flush(); err != nil {
@@ -406,14 +516,21 @@ func EncodeModel(m FactorizationMachine) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// DecodeModel decodes a factorization machine encoded by EncodeModel. Models encoded as concrete factorization
+// machines by earlier versions are decoded as well.
 func DecodeModel(buf []byte) (FactorizationMachine, error) {
-	reader := bytes.NewReader(buf)
-	decoder := gob.NewDecoder(reader)
-	var fm FM
-	if err := decoder.Decode(&fm); err != nil {
-		return nil, err
+	decoder := gob.NewDecoder(bytes.NewReader(buf))
+	var m FactorizationMachine
+	if err := decoder.Decode(&m); err != nil {
+		// fallback to concrete factorization machine
+		fm := new(FM)
+		if legacyErr := gob.NewDecoder(bytes.NewReader(buf)).Decode(fm); legacyErr != nil {
+			return nil, err
+		}
+		m = fm
 	}
-	return &fm, nil
+	m.SetParams(m.GetParams())
+	return m, nil
 }
 
 // Clone a model with deep copy.
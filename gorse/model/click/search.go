@@ -33,6 +33,24 @@ type ParamsSearchResult struct {
 	Params     []model.Params
 }
 
+// evaluate fits the estimator with parameters and records the score. The estimator is cloned as the best model if
+// the score is the best so far.
+func (r *ParamsSearchResult) evaluate(estimator FactorizationMachine, trainSet, testSet *Dataset, params model.Params,
+	fitConfig *FitConfig) Score {
+	estimator.Clear()
+	estimator.SetParams(estimator.GetParams().Overwrite(params))
+	score := estimator.Fit(trainSet, testSet, fitConfig)
+	r.Scores = append(r.Scores, score)
+	r.Params = append(r.Params, params.Copy())
+	if score.BetterThan(r.BestScore) {
+		r.BestScore = score
+		r.BestParams = params.Copy()
+		r.BestIndex = len(r.Params) - 1
+		r.BestModel = Clone(estimator)
+	}
+	return score
+}
+
 // GridSearchCV finds the best parameters for a model.
 func GridSearchCV(estimator FactorizationMachine, trainSet *Dataset, testSet *Dataset, paramGrid model.ParamsGrid,
 	seed int64, fitConfig *FitConfig) ParamsSearchResult {
@@ -56,18 +74,7 @@ func GridSearchCV(estimator FactorizationMachine, trainSet *Dataset, testSet *Da
 			base.Logger().Info(fmt.Sprintf("grid search %v/%v", progress, count),
 				zap.Any("params", params))
 			// Cross validate
-			estimator.Clear()
-			estimator.SetParams(estimator.GetParams().Overwrite(params))
-			score := estimator.Fit(trainSet, testSet, fitConfig)
-			// Create GridSearch result
-			results.Scores = append(results.Scores, score)
-			results.Params = append(results.Params, params.Copy())
-			if len(results.Scores) == 0 || score.BetterThan(results.BestScore) {
-				results.BestScore = score
-				results.BestParams = params.Copy()
-				results.BestIndex = len(results.Params) - 1
-				results.BestModel = Clone(estimator)
-			}
+			results.evaluate(estimator, trainSet, testSet, params, fitConfig)
 		} else {
 			paramName := paramNames[deep]
 			values := paramGrid[paramName]
@@ -104,16 +111,35 @@ func RandomSearchCV(estimator FactorizationMachine, trainSet *Dataset, testSet *
 		// Cross validate
 		base.Logger().Info(fmt.Sprintf("random search %v/%v", i, numTrials),
 			zap.Any("params", params))
-		estimator.Clear()
-		estimator.SetParams(estimator.GetParams().Overwrite(params))
-		score := estimator.Fit(trainSet, testSet, fitConfig)
-		results.Scores = append(results.Scores, score)
-		results.Params = append(results.Params, params.Copy())
-		if len(results.Scores) == 0 || score.BetterThan(results.BestScore) {
-			results.BestScore = score
-			results.BestParams = params.Copy()
-			results.BestIndex = len(results.Params) - 1
-			results.BestModel = Clone(estimator)
+		results.evaluate(estimator, trainSet, testSet, params, fitConfig)
+	}
+	return results
+}
+
+// TPESearchCV searches hyper-parameters by the tree-structured Parzen estimator. Hyper-parameters of each
+// trial are suggested by scores of previous trials.
+func TPESearchCV(estimator FactorizationMachine, trainSet *Dataset, testSet *Dataset, paramSpace model.ParamsSpace,
+	numTrials int, seed int64, fitConfig *FitConfig) ParamsSearchResult {
+	// if the number of combination is less than number of trials, use grid search
+	if paramGrid, ok := paramSpace.ToGrid(); ok && paramGrid.NumCombinations() < numTrials {
+		return GridSearchCV(estimator, trainSet, testSet, paramGrid, seed, fitConfig)
+	}
+	tpe := model.NewTPE(paramSpace, seed)
+	results := ParamsSearchResult{
+		Scores: make([]Score, 0, numTrials),
+		Params: make([]model.Params, 0, numTrials),
+	}
+	for i := 1; i <= numTrials; i++ {
+		params := tpe.Suggest()
+		// Cross validate
+		base.Logger().Info(fmt.Sprintf("tpe search %v/%v", i, numTrials),
+			zap.Any("params", params))
+		score := results.evaluate(estimator, trainSet, testSet, params, fitConfig)
+		// larger scores are better for the estimator
+		if score.Task == FMRegression {
+			tpe.Observe(params, -float64(score.RMSE))
+		} else {
+			tpe.Observe(params, float64(score.Precision))
 		}
 	}
 	return results
@@ -125,6 +151,8 @@ type ModelSearcher struct {
 	numEpochs int
 	numTrials int
 	numJobs   int
+	patience  int
+	useTPE    bool
 	// results
 	bestMutex     sync.Mutex
 	useClickModel bool
@@ -133,11 +161,14 @@ type ModelSearcher struct {
 }
 
 // NewModelSearcher creates a thread-safe personal ranking model searcher.
-func NewModelSearcher(nEpoch, nTrials, nJobs int) *ModelSearcher {
+// Hyper-parameters are searched by the tree-structured Parzen estimator if useTPE is true, otherwise by random.
+func NewModelSearcher(nEpoch, nTrials, nJobs, patience int, useTPE bool) *ModelSearcher {
 	return &ModelSearcher{
 		numTrials: nTrials,
 		numEpochs: nEpoch,
 		numJobs:   nJobs,
+		patience:  patience,
+		useTPE:    useTPE,
 	}
 }
 
@@ -171,12 +202,24 @@ func (searcher *ModelSearcher) Fit(trainSet, valSet *Dataset) error {
 		return nil
 	}
 
-	// Random search
-	fm := NewFM(FMClassification, nil)
-	grid := fm.GetParamsGrid()
-	grid[model.UseFeature] = []interface{}{true, false}
-	r := RandomSearchCV(fm, trainSet, valSet, grid, searcher.numTrials*2, 0,
-		NewFitConfig().SetJobs(searcher.numJobs))
+	// Search hyper-parameters for FM and FFM, which share the budget of trials
+	var r ParamsSearchResult
+	fitConfig := NewFitConfig().SetJobs(searcher.numJobs).SetPatience(searcher.patience)
+	for _, m := range []FactorizationMachine{NewFM(FMClassification, nil), NewFFM(FMClassification, nil)} {
+		var result ParamsSearchResult
+		if searcher.useTPE {
+			space := model.GetParamsSpace(m)
+			space[model.UseFeature] = model.NewChoices(true, false)
+			result = TPESearchCV(m, trainSet, valSet, space, searcher.numTrials, 0, fitConfig)
+		} else {
+			grid := m.GetParamsGrid()
+			grid[model.UseFeature] = []interface{}{true, false}
+			result = RandomSearchCV(m, trainSet, valSet, grid, searcher.numTrials, 0, fitConfig)
+		}
+		if r.BestModel == nil || result.BestScore.BetterThan(r.BestScore) {
+			r = result
+		}
+	}
 	if !r.BestParams[model.UseFeature].(bool) {
 		// If model searcher found it's better to ignore features, just don't use features.
 		searcher.useClickModel = false
@@ -19,6 +19,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/storage/data"
 )
 
 type mockFactorizationMachineForSearch struct {
@@ -46,7 +47,7 @@ func (m *mockFactorizationMachineForSearch) Fit(trainSet, testSet *Dataset, conf
 	return Score{Task: FMClassification, Precision: score}
 }
 
-func (m *mockFactorizationMachineForSearch) Predict(userId, itemId string, labels []string) float32 {
+func (m *mockFactorizationMachineForSearch) Predict(userId, itemId string, labels []string, attributes data.Attributes, ctxLabels []string) float32 {
 	panic("don't call me")
 }
 
@@ -87,3 +88,21 @@ func TestRandomSearchCV(t *testing.T) {
 		model.InitStdDev: 4,
 	}, r.BestParams)
 }
+
+func TestTPESearchCV(t *testing.T) {
+	m := &mockFactorizationMachineForSearch{}
+	space := model.ParamsSpace{
+		model.NFactors:   model.NewIntRange(1, 4),
+		model.InitMean:   model.NewUniformRange(1, 4),
+		model.InitStdDev: model.NewChoices(4),
+	}
+	r := TPESearchCV(m, nil, nil, space, 30, 0, nil)
+	assert.Equal(t, 30, len(r.Scores))
+	assert.Greater(t, r.BestScore.Precision, float32(11))
+	assert.Equal(t, r.Params[r.BestIndex], r.BestParams)
+	assert.Equal(t, 4, r.BestParams[model.NFactors])
+	// use grid search if the number of combination is less than number of trials
+	r = TPESearchCV(m, nil, nil, model.GetParamsSpace(m), 100, 0, nil)
+	assert.Equal(t, 64, len(r.Scores))
+	assert.Equal(t, float32(12), r.BestScore.Precision)
+}
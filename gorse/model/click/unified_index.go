@@ -16,21 +16,42 @@ package click
 
 import (
 	"encoding/gob"
+	"sort"
+	"strconv"
+
 	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/storage/data"
 )
 
+// numAttributeBuckets is the number of buckets for numeric attributes and timestamp attributes.
+const numAttributeBuckets = 10
+
 func init() {
 	gob.Register(&UnifiedMapIndex{})
 }
 
+// Fields of UnifiedMapIndex.
+const (
+	UserField = iota
+	ItemField
+	UserLabelField
+	ItemLabelField
+	ContextField
+	numMapIndexFields
+)
+
 // UnifiedIndex maps users, items and labels into a unified encoding space.
 type UnifiedIndex interface {
 	Len() int
+	CountFields() int
+	GetField(index int) int
 	EncodeUser(userId string) int
 	EncodeItem(itemId string) int
 	EncodeUserLabel(userLabel string) int
 	EncodeItemLabel(itemLabel string) int
 	EncodeContextLabel(ctxLabel string) int
+	EncodeUserAttributes(attrs data.Attributes) []int
+	EncodeItemAttributes(attrs data.Attributes) []int
 	GetUsers() []string
 	GetItems() []string
 	GetUserLabels() []string
@@ -50,6 +71,8 @@ type UnifiedMapIndexBuilder struct {
 	UserLabelIndex base.Index
 	ItemLabelIndex base.Index
 	CtxLabelIndex  base.Index
+	userNumeric    map[string][]float32 // values of numeric attributes of users
+	itemNumeric    map[string][]float32 // values of numeric attributes of items
 }
 
 // NewUnifiedMapIndexBuilder creates a UnifiedMapIndexBuilder.
@@ -60,6 +83,8 @@ func NewUnifiedMapIndexBuilder() *UnifiedMapIndexBuilder {
 		UserLabelIndex: base.NewMapIndex(),
 		ItemLabelIndex: base.NewMapIndex(),
 		CtxLabelIndex:  base.NewMapIndex(),
+		userNumeric:    make(map[string][]float32),
+		itemNumeric:    make(map[string][]float32),
 	}
 }
 
@@ -88,6 +113,28 @@ func (builder *UnifiedMapIndexBuilder) AddCtxLabel(ctxLabel string) {
 	builder.CtxLabelIndex.Add(ctxLabel)
 }
 
+// AddUserAttributes adds attributes of a user into the unified index. Categorical attributes are added as user
+// labels and numeric attributes are collected to be bucketed while building.
+func (builder *UnifiedMapIndexBuilder) AddUserAttributes(attrs data.Attributes) {
+	for name, value := range attrs.Categorical {
+		builder.UserLabelIndex.Add(categoricalLabel(name, value))
+	}
+	for key, value := range numericAttributes(attrs) {
+		builder.userNumeric[key] = append(builder.userNumeric[key], value)
+	}
+}
+
+// AddItemAttributes adds attributes of a item into the unified index. Categorical attributes are added as item
+// labels and numeric attributes are collected to be bucketed while building.
+func (builder *UnifiedMapIndexBuilder) AddItemAttributes(attrs data.Attributes) {
+	for name, value := range attrs.Categorical {
+		builder.ItemLabelIndex.Add(categoricalLabel(name, value))
+	}
+	for key, value := range numericAttributes(attrs) {
+		builder.itemNumeric[key] = append(builder.itemNumeric[key], value)
+	}
+}
+
 // Build UnifiedMapIndex from UnifiedMapIndexBuilder.
 func (builder *UnifiedMapIndexBuilder) Build() UnifiedIndex {
 	return &UnifiedMapIndex{
@@ -96,17 +143,112 @@ func (builder *UnifiedMapIndexBuilder) Build() UnifiedIndex {
 		UserLabelIndex: builder.UserLabelIndex,
 		ItemLabelIndex: builder.ItemLabelIndex,
 		CtxLabelIndex:  builder.CtxLabelIndex,
+		UserBuckets:    buildBuckets(builder.userNumeric, builder.UserLabelIndex),
+		ItemBuckets:    buildBuckets(builder.itemNumeric, builder.ItemLabelIndex),
+	}
+}
+
+// buildBuckets splits values of each numeric attribute into buckets by quantiles. Buckets are added as labels.
+func buildBuckets(numeric map[string][]float32, labelIndex base.Index) map[string][]float32 {
+	buckets := make(map[string][]float32, len(numeric))
+	keys := make([]string, 0, len(numeric))
+	for key := range numeric {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := numeric[key]
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		boundaries := make([]float32, 0, numAttributeBuckets-1)
+		for i := 1; i < numAttributeBuckets; i++ {
+			boundary := values[i*len(values)/numAttributeBuckets]
+			if boundary > values[0] && (len(boundaries) == 0 || boundary > boundaries[len(boundaries)-1]) {
+				boundaries = append(boundaries, boundary)
+			}
+		}
+		buckets[key] = boundaries
+		for i := 0; i <= len(boundaries); i++ {
+			labelIndex.Add(bucketLabel(key, i))
+		}
+	}
+	return buckets
+}
+
+// categoricalLabel returns the label of a categorical attribute. Labels can't contain `|` so that attribute
+// labels never conflict with plain labels.
+func categoricalLabel(name, value string) string {
+	return name + "|" + value
+}
+
+// bucketLabel returns the label of the i-th bucket of a numeric attribute.
+func bucketLabel(key string, i int) string {
+	return key + strconv.Itoa(i)
+}
+
+// numericAttributes returns numeric attributes and timestamp attributes (in seconds) keyed by their names and types.
+func numericAttributes(attrs data.Attributes) map[string]float32 {
+	values := make(map[string]float32, len(attrs.Numeric)+len(attrs.Timestamp))
+	for name, value := range attrs.Numeric {
+		values[name+"|#"] = value
+	}
+	for name, value := range attrs.Timestamp {
+		values[name+"|@"] = float32(value.Unix())
+	}
+	return values
+}
+
+// attributeLabels returns labels of categorical attributes and buckets of numeric attributes.
+func attributeLabels(attrs data.Attributes, buckets map[string][]float32) []string {
+	labels := make([]string, 0, len(attrs.Categorical)+len(attrs.Numeric)+len(attrs.Timestamp))
+	for name, value := range attrs.Categorical {
+		labels = append(labels, categoricalLabel(name, value))
 	}
+	for key, value := range numericAttributes(attrs) {
+		if boundaries, exist := buckets[key]; exist {
+			bucket := sort.Search(len(boundaries), func(i int) bool { return boundaries[i] > value })
+			labels = append(labels, bucketLabel(key, bucket))
+		}
+	}
+	sort.Strings(labels)
+	return labels
 }
 
 // UnifiedMapIndex is the id -> index mapper for factorization machines.
 // The division of id is: | user | item | user label | item label | context label |
+// Attributes are encoded as labels: categorical attributes are encoded as `name|value` and numeric attributes are
+// encoded as buckets `name|#i` (or `name|@i` for timestamp attributes).
 type UnifiedMapIndex struct {
 	UserIndex      base.Index
 	ItemIndex      base.Index
 	UserLabelIndex base.Index
 	ItemLabelIndex base.Index
 	CtxLabelIndex  base.Index
+	UserBuckets    map[string][]float32 // bucket boundaries of numeric attributes of users
+	ItemBuckets    map[string][]float32 // bucket boundaries of numeric attributes of items
+}
+
+// EncodeUserAttributes converts attributes of a user to integers in the encoding space. Unknown attributes
+// are ignored.
+func (unified *UnifiedMapIndex) EncodeUserAttributes(attrs data.Attributes) []int {
+	var indices []int
+	for _, label := range attributeLabels(attrs, unified.UserBuckets) {
+		if index := unified.EncodeUserLabel(label); index != base.NotId {
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
+
+// EncodeItemAttributes converts attributes of a item to integers in the encoding space. Unknown attributes
+// are ignored.
+func (unified *UnifiedMapIndex) EncodeItemAttributes(attrs data.Attributes) []int {
+	var indices []int
+	for _, label := range attributeLabels(attrs, unified.ItemBuckets) {
+		if index := unified.EncodeItemLabel(label); index != base.NotId {
+			indices = append(indices, index)
+		}
+	}
+	return indices
 }
 
 // GetUserLabels returns all user labels.
@@ -146,6 +288,28 @@ func (unified *UnifiedMapIndex) Len() int {
 		unified.CtxLabelIndex.Len()
 }
 
+// CountFields returns the number of fields, which are users, items, user labels, item labels and context labels.
+func (unified *UnifiedMapIndex) CountFields() int {
+	return numMapIndexFields
+}
+
+// GetField returns the field of a integer in the encoding space.
+func (unified *UnifiedMapIndex) GetField(index int) int {
+	if index -= unified.UserIndex.Len(); index < 0 {
+		return UserField
+	}
+	if index -= unified.ItemIndex.Len(); index < 0 {
+		return ItemField
+	}
+	if index -= unified.UserLabelIndex.Len(); index < 0 {
+		return UserLabelField
+	}
+	if index -= unified.ItemLabelIndex.Len(); index < 0 {
+		return ItemLabelField
+	}
+	return ContextField
+}
+
 // EncodeUser converts a user id to a integer in the encoding space.
 func (unified *UnifiedMapIndex) EncodeUser(userId string) int {
 	return unified.UserIndex.ToNumber(userId)
@@ -263,6 +427,16 @@ func (unified *UnifiedDirectIndex) Len() int {
 	return unified.N
 }
 
+// CountFields returns 1 since there are no fields in UnifiedDirectIndex.
+func (unified *UnifiedDirectIndex) CountFields() int {
+	return 1
+}
+
+// GetField returns 0 since there are no fields in UnifiedDirectIndex.
+func (unified *UnifiedDirectIndex) GetField(index int) int {
+	return 0
+}
+
 // EncodeUser is not supported by UnifiedDirectIndex.
 func (unified *UnifiedDirectIndex) EncodeUser(userId string) int {
 	panic("not implemented")
@@ -273,6 +447,16 @@ func (unified *UnifiedDirectIndex) EncodeItem(itemId string) int {
 	panic("not implemented")
 }
 
+// EncodeUserAttributes is not supported by UnifiedDirectIndex.
+func (unified *UnifiedDirectIndex) EncodeUserAttributes(attrs data.Attributes) []int {
+	panic("not implemented")
+}
+
+// EncodeItemAttributes is not supported by UnifiedDirectIndex.
+func (unified *UnifiedDirectIndex) EncodeItemAttributes(attrs data.Attributes) []int {
+	panic("not implemented")
+}
+
 // EncodeContextLabel is not supported by UnifiedDirectIndex.
 func (unified *UnifiedDirectIndex) EncodeContextLabel(label string) int {
 	panic("not implemented")
@@ -16,9 +16,58 @@ package click
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/storage/data"
 	"testing"
+	"time"
 )
 
+func TestUnifiedMapIndex_Attributes(t *testing.T) {
+	// create unified map index
+	builder := NewUnifiedMapIndexBuilder()
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		builder.AddItem(fmt.Sprintf("item%v", i))
+		builder.AddItemAttributes(data.Attributes{
+			Categorical: map[string]string{"brand": fmt.Sprintf("brand%v", i%2)},
+			Numeric:     map[string]float32{"price": float32(i)},
+		})
+	}
+	builder.AddUser("user")
+	builder.AddUserAttributes(data.Attributes{
+		Categorical: map[string]string{"gender": "female"},
+		Timestamp:   map[string]time.Time{"birthday": timestamp},
+	})
+	index := builder.Build()
+	// 2 brands and 10 buckets of prices
+	assert.Equal(t, 12, index.CountItemLabels())
+	// 1 gender and 1 bucket of birthdays
+	assert.Equal(t, 2, index.CountUserLabels())
+	// check encode
+	assert.Equal(t, []int{
+		index.EncodeItemLabel("brand|brand1"),
+		index.EncodeItemLabel("price|#2"),
+	}, index.EncodeItemAttributes(data.Attributes{
+		Categorical: map[string]string{"brand": "brand1"},
+		Numeric:     map[string]float32{"price": 5},
+	}))
+	assert.Equal(t, []int{
+		index.EncodeItemLabel("price|#0"),
+		index.EncodeItemLabel("price|#9"),
+	}, append(index.EncodeItemAttributes(data.Attributes{Numeric: map[string]float32{"price": -1}}),
+		index.EncodeItemAttributes(data.Attributes{Numeric: map[string]float32{"price": 100}})...))
+	assert.Equal(t, []int{
+		index.EncodeUserLabel("birthday|@0"),
+		index.EncodeUserLabel("gender|female"),
+	}, index.EncodeUserAttributes(data.Attributes{
+		Categorical: map[string]string{"gender": "female"},
+		Timestamp:   map[string]time.Time{"birthday": timestamp.Add(time.Hour)},
+	}))
+	// unknown attributes are ignored
+	assert.Empty(t, index.EncodeItemAttributes(data.Attributes{
+		Categorical: map[string]string{"brand": "unknown", "color": "red"},
+	}))
+}
+
 func TestUnifiedMapIndex(t *testing.T) {
 	// create unified map index
 	builder := NewUnifiedMapIndexBuilder()
@@ -77,4 +126,12 @@ func TestUnifiedMapIndex(t *testing.T) {
 		assert.Equal(t, numUsers+numItems+numUserLabels+numItemLabels+i, ctxLabelIndex)
 		assert.Equal(t, fmt.Sprintf("ctx_label%v", i), ctxLabels[i])
 	}
+	// check fields
+	assert.Equal(t, 5, index.CountFields())
+	assert.Equal(t, UserField, index.GetField(index.EncodeUser("user2")))
+	assert.Equal(t, ItemField, index.GetField(index.EncodeItem("item0")))
+	assert.Equal(t, ItemField, index.GetField(index.EncodeItem("item3")))
+	assert.Equal(t, UserLabelField, index.GetField(index.EncodeUserLabel("user_label0")))
+	assert.Equal(t, ItemLabelField, index.GetField(index.EncodeItemLabel("item_label5")))
+	assert.Equal(t, ContextField, index.GetField(index.EncodeContextLabel("ctx_label6")))
 }
@@ -51,3 +51,18 @@ func (model *BaseModel) GetParams() Params {
 func (model *BaseModel) GetRandomGenerator() base.RandomGenerator {
 	return model.rng
 }
+
+// SpaceModel is a model with search ranges of hyper-parameters for model-based search.
+type SpaceModel interface {
+	Model
+	GetParamsSpace() ParamsSpace
+}
+
+// GetParamsSpace returns search ranges of hyper-parameters of a model. Candidates for grid search are used
+// if the model doesn't provide search ranges.
+func GetParamsSpace(m Model) ParamsSpace {
+	if spaceModel, ok := m.(SpaceModel); ok {
+		return spaceModel.GetParamsSpace()
+	}
+	return m.GetParamsGrid().ToSpace()
+}
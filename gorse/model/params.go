@@ -30,6 +30,7 @@ type ParamName string
 const (
 	Lr          ParamName = "Lr"          // learning rate
 	Reg         ParamName = "Reg"         // regularization strength
+	L1Reg       ParamName = "L1Reg"       // L1 regularization strength
 	NEpochs     ParamName = "NEpochs"     // number of epochs
 	NFactors    ParamName = "NFactors"    // number of factors
 	RandomState ParamName = "RandomState" // random state (seed)
@@ -38,6 +39,11 @@ const (
 	Alpha       ParamName = "Alpha"       // weight for negative samples in ALS
 	Similarity  ParamName = "Similarity"
 	UseFeature  ParamName = "UseFeature"
+	UseCross    ParamName = "UseCross" // use linear cross features
+	Window      ParamName = "Window"   // size of context window of sequences
+	MaxItems    ParamName = "MaxItems" // max number of items fitted by dense item-item models
+	// probability of sampling negative items from negative feedback
+	HardNegativeRate ParamName = "HardNegativeRate"
 )
 
 const (
@@ -180,3 +186,63 @@ func (grid ParamsGrid) Fill(_default ParamsGrid) {
 		}
 	}
 }
+
+// ParamRange is the search range of a hyper-parameter. A value is sampled from Choices if Choices exist.
+// Otherwise, a value is sampled from [Low, High] in linear scale or log scale, and rounded to an integer
+// if Integer is true.
+type ParamRange struct {
+	Choices []interface{}
+	Low     float64
+	High    float64
+	Log     bool
+	Integer bool
+}
+
+// NewChoices creates a range of candidate values.
+func NewChoices(values ...interface{}) ParamRange {
+	return ParamRange{Choices: values}
+}
+
+// NewUniformRange creates a continuous range in linear scale.
+func NewUniformRange(low, high float64) ParamRange {
+	return ParamRange{Low: low, High: high}
+}
+
+// NewLogRange creates a continuous range in log scale. Both bounds must be positive.
+func NewLogRange(low, high float64) ParamRange {
+	return ParamRange{Low: low, High: high, Log: true}
+}
+
+// NewIntRange creates a integer range in linear scale.
+func NewIntRange(low, high int) ParamRange {
+	return ParamRange{Low: float64(low), High: float64(high), Integer: true}
+}
+
+// IsContinuous returns true if values are sampled from [Low, High].
+func (r ParamRange) IsContinuous() bool {
+	return len(r.Choices) == 0
+}
+
+// ParamsSpace contains search ranges for model-based search.
+type ParamsSpace map[ParamName]ParamRange
+
+// ToSpace converts candidates of grid search to a search space.
+func (grid ParamsGrid) ToSpace() ParamsSpace {
+	space := make(ParamsSpace, len(grid))
+	for param, values := range grid {
+		space[param] = NewChoices(values...)
+	}
+	return space
+}
+
+// ToGrid converts a search space to candidates of grid search. It fails if there are continuous ranges.
+func (space ParamsSpace) ToGrid() (ParamsGrid, bool) {
+	grid := make(ParamsGrid, len(space))
+	for param, r := range space {
+		if r.IsContinuous() {
+			return nil, false
+		}
+		grid[param] = r.Choices
+	}
+	return grid, true
+}
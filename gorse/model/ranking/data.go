@@ -18,6 +18,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -32,14 +33,18 @@ const batchSize = 1000
 
 // DataSet contains preprocessed data structures for recommendation models.
 type DataSet struct {
-	UserIndex     base.Index
-	ItemIndex     base.Index
-	FeedbackUsers []int
-	FeedbackItems []int
-	UserFeedback  [][]int
-	ItemFeedback  [][]int
-	Negatives     [][]int
-	ItemLabels    [][]int
+	UserIndex           base.Index
+	ItemIndex           base.Index
+	FeedbackUsers       []int
+	FeedbackItems       []int
+	UserFeedback        [][]int
+	ItemFeedback        [][]int
+	UserFeedbackWeights [][]float32 // weights aligned with UserFeedback (nil if all weights are 1)
+	ItemFeedbackWeights [][]float32 // weights aligned with ItemFeedback (nil if all weights are 1)
+	Negatives           [][]int
+	HardNegatives       [][]int // items with negative feedback from users
+	ItemLabels          [][]int
+	UserSequences       [][]int // items of users in chronological order (optional)
 	// statistics
 	NumItemLabels int
 }
@@ -89,6 +94,11 @@ func (dataset *DataSet) AddItem(itemId string) {
 }
 
 func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool) {
+	dataset.AddWeightedFeedback(userId, itemId, 1, insertUserItem)
+}
+
+// AddWeightedFeedback adds a feedback with weight. Weights are stored once any weight isn't 1.
+func (dataset *DataSet) AddWeightedFeedback(userId, itemId string, weight float32, insertUserItem bool) {
 	if insertUserItem {
 		dataset.UserIndex.Add(userId)
 	}
@@ -98,17 +108,65 @@ func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool)
 	userIndex := dataset.UserIndex.ToNumber(userId)
 	itemIndex := dataset.ItemIndex.ToNumber(itemId)
 	if userIndex != base.NotId && itemIndex != base.NotId {
-		dataset.FeedbackUsers = append(dataset.FeedbackUsers, userIndex)
-		dataset.FeedbackItems = append(dataset.FeedbackItems, itemIndex)
-		for itemIndex >= len(dataset.ItemFeedback) {
-			dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int, 0))
+		if weight != 1 && dataset.UserFeedbackWeights == nil {
+			dataset.UserFeedbackWeights = createWeights(dataset.UserFeedback)
+			dataset.ItemFeedbackWeights = createWeights(dataset.ItemFeedback)
 		}
-		dataset.ItemFeedback[itemIndex] = append(dataset.ItemFeedback[itemIndex], userIndex)
-		for userIndex >= len(dataset.UserFeedback) {
-			dataset.UserFeedback = append(dataset.UserFeedback, make([]int, 0))
+		dataset.addIndex(userIndex, itemIndex, weight)
+	}
+}
+
+// addIndex adds a feedback by user index and item index.
+func (dataset *DataSet) addIndex(userIndex, itemIndex int, weight float32) {
+	dataset.FeedbackUsers = append(dataset.FeedbackUsers, userIndex)
+	dataset.FeedbackItems = append(dataset.FeedbackItems, itemIndex)
+	for itemIndex >= len(dataset.ItemFeedback) {
+		dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int, 0))
+	}
+	dataset.ItemFeedback[itemIndex] = append(dataset.ItemFeedback[itemIndex], userIndex)
+	for userIndex >= len(dataset.UserFeedback) {
+		dataset.UserFeedback = append(dataset.UserFeedback, make([]int, 0))
+	}
+	dataset.UserFeedback[userIndex] = append(dataset.UserFeedback[userIndex], itemIndex)
+	if dataset.UserFeedbackWeights != nil {
+		for itemIndex >= len(dataset.ItemFeedbackWeights) {
+			dataset.ItemFeedbackWeights = append(dataset.ItemFeedbackWeights, make([]float32, 0))
+		}
+		dataset.ItemFeedbackWeights[itemIndex] = append(dataset.ItemFeedbackWeights[itemIndex], weight)
+		for userIndex >= len(dataset.UserFeedbackWeights) {
+			dataset.UserFeedbackWeights = append(dataset.UserFeedbackWeights, make([]float32, 0))
 		}
-		dataset.UserFeedback[userIndex] = append(dataset.UserFeedback[userIndex], itemIndex)
+		dataset.UserFeedbackWeights[userIndex] = append(dataset.UserFeedbackWeights[userIndex], weight)
+	}
+}
+
+// UserFeedbackWeight returns the weight of the k-th feedback of a user.
+func (dataset *DataSet) UserFeedbackWeight(userIndex, k int) float32 {
+	if dataset.UserFeedbackWeights == nil {
+		return 1
 	}
+	return dataset.UserFeedbackWeights[userIndex][k]
+}
+
+// ItemFeedbackWeight returns the weight of the k-th feedback of an item.
+func (dataset *DataSet) ItemFeedbackWeight(itemIndex, k int) float32 {
+	if dataset.ItemFeedbackWeights == nil {
+		return 1
+	}
+	return dataset.ItemFeedbackWeights[itemIndex][k]
+}
+
+// AddNegativeFeedback adds an item with negative feedback from a user. Unknown users or items are ignored.
+func (dataset *DataSet) AddNegativeFeedback(userId, itemId string) {
+	userIndex := dataset.UserIndex.ToNumber(userId)
+	itemIndex := dataset.ItemIndex.ToNumber(itemId)
+	if userIndex == base.NotId || itemIndex == base.NotId {
+		return
+	}
+	for userIndex >= len(dataset.HardNegatives) {
+		dataset.HardNegatives = append(dataset.HardNegatives, nil)
+	}
+	dataset.HardNegatives[userIndex] = append(dataset.HardNegatives[userIndex], itemIndex)
 }
 
 func (dataset *DataSet) SetNegatives(userId string, negatives []string) {
@@ -127,6 +185,33 @@ func (dataset *DataSet) SetNegatives(userId string, negatives []string) {
 	}
 }
 
+// SetSequences sets chronologically ordered sequences of users by timestamps of feedback. Feedback of unknown users
+// or items is ignored.
+func (dataset *DataSet) SetSequences(feedback []data.Feedback) {
+	sorted := make([]data.Feedback, len(feedback))
+	copy(sorted, feedback)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	dataset.UserSequences = createSliceOfSlice(dataset.UserCount())
+	for _, v := range sorted {
+		userIndex := dataset.UserIndex.ToNumber(v.UserId)
+		itemIndex := dataset.ItemIndex.ToNumber(v.ItemId)
+		if userIndex != base.NotId && itemIndex != base.NotId {
+			dataset.UserSequences[userIndex] = append(dataset.UserSequences[userIndex], itemIndex)
+		}
+	}
+}
+
+// UserSequence returns items of a user in chronological order. Feedback in insertion order is returned if there
+// are no sequences.
+func (dataset *DataSet) UserSequence(userIndex int) []int {
+	if dataset.UserSequences != nil {
+		return dataset.UserSequences[userIndex]
+	}
+	return dataset.UserFeedback[userIndex]
+}
+
 func (dataset *DataSet) Count() int {
 	return len(dataset.FeedbackUsers)
 }
@@ -149,6 +234,18 @@ func createSliceOfSlice(n int) [][]int {
 	return x
 }
 
+// createWeights creates weights of 1 for feedback.
+func createWeights(feedback [][]int) [][]float32 {
+	weights := make([][]float32, len(feedback))
+	for i := range weights {
+		weights[i] = make([]float32, len(feedback[i]))
+		for j := range weights[i] {
+			weights[i][j] = 1
+		}
+	}
+	return weights
+}
+
 func (dataset *DataSet) NegativeSample(excludeSet *DataSet, numCandidates int) [][]int {
 	if len(dataset.Negatives) == 0 {
 		rng := base.NewRandomGenerator(0)
@@ -169,25 +266,26 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 	trainSet, testSet := new(DataSet), new(DataSet)
 	trainSet.NumItemLabels, testSet.NumItemLabels = dataset.NumItemLabels, dataset.NumItemLabels
 	trainSet.ItemLabels, trainSet.ItemLabels = dataset.ItemLabels, dataset.ItemLabels
+	trainSet.HardNegatives = dataset.HardNegatives
 	trainSet.UserIndex, testSet.UserIndex = dataset.UserIndex, dataset.UserIndex
 	trainSet.ItemIndex, testSet.ItemIndex = dataset.ItemIndex, dataset.ItemIndex
 	trainSet.UserFeedback, testSet.UserFeedback = createSliceOfSlice(dataset.UserCount()), createSliceOfSlice(dataset.UserCount())
 	trainSet.ItemFeedback, testSet.ItemFeedback = createSliceOfSlice(dataset.ItemCount()), createSliceOfSlice(dataset.ItemCount())
+	if dataset.UserFeedbackWeights != nil {
+		trainSet.UserFeedbackWeights, testSet.UserFeedbackWeights = createWeights(trainSet.UserFeedback), createWeights(testSet.UserFeedback)
+		trainSet.ItemFeedbackWeights, testSet.ItemFeedbackWeights = createWeights(trainSet.ItemFeedback), createWeights(testSet.ItemFeedback)
+	}
+	testItems := make(map[int]int)
 	rng := base.NewRandomGenerator(seed)
 	if numTestUsers >= dataset.UserCount() || numTestUsers <= 0 {
 		for userIndex := 0; userIndex < dataset.UserCount(); userIndex++ {
 			if len(dataset.UserFeedback[userIndex]) > 0 {
 				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers = append(testSet.FeedbackUsers, userIndex)
-				testSet.FeedbackItems = append(testSet.FeedbackItems, dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
+				testItems[userIndex] = dataset.UserFeedback[userIndex][k]
+				testSet.addIndex(userIndex, dataset.UserFeedback[userIndex][k], dataset.UserFeedbackWeight(userIndex, k))
 				for i, itemIndex := range dataset.UserFeedback[userIndex] {
 					if i != k {
-						trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-						trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+						trainSet.addIndex(userIndex, itemIndex, dataset.UserFeedbackWeight(userIndex, i))
 					}
 				}
 			}
@@ -197,16 +295,11 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 		for _, userIndex := range testUsers {
 			if len(dataset.UserFeedback[userIndex]) > 0 {
 				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers = append(testSet.FeedbackUsers, userIndex)
-				testSet.FeedbackItems = append(testSet.FeedbackItems, dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
+				testItems[userIndex] = dataset.UserFeedback[userIndex][k]
+				testSet.addIndex(userIndex, dataset.UserFeedback[userIndex][k], dataset.UserFeedbackWeight(userIndex, k))
 				for i, itemIndex := range dataset.UserFeedback[userIndex] {
 					if i != k {
-						trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-						trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+						trainSet.addIndex(userIndex, itemIndex, dataset.UserFeedbackWeight(userIndex, i))
 					}
 				}
 			}
@@ -214,11 +307,20 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 		testUserSet := set.NewIntSet(testUsers...)
 		for userIndex := 0; userIndex < dataset.UserCount(); userIndex++ {
 			if !testUserSet.Has(userIndex) {
-				for _, itemIndex := range dataset.UserFeedback[userIndex] {
-					trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-					trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-					trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-					trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+				for i, itemIndex := range dataset.UserFeedback[userIndex] {
+					trainSet.addIndex(userIndex, itemIndex, dataset.UserFeedbackWeight(userIndex, i))
+				}
+			}
+		}
+	}
+	// remove test items from sequences
+	if dataset.UserSequences != nil {
+		trainSet.UserSequences = createSliceOfSlice(dataset.UserCount())
+		for userIndex, sequence := range dataset.UserSequences {
+			testItem, isTestUser := testItems[userIndex]
+			for _, itemIndex := range sequence {
+				if !isTestUser || itemIndex != testItem {
+					trainSet.UserSequences[userIndex] = append(trainSet.UserSequences[userIndex], itemIndex)
 				}
 			}
 		}
@@ -269,8 +371,8 @@ func LoadDataFromCSV(fileName, sep string, hasHeader bool) *DataSet {
 	return dataset
 }
 
-// LoadDataFromDatabase loads dataset from data store.
-func LoadDataFromDatabase(database data.Database, feedbackTypes []string, itemTTL, positiveFeedbackTTL uint) (*DataSet, []data.Item, []data.Feedback, error) {
+// LoadDataFromDatabase loads dataset from data store. Feedback of negative feedback types is loaded as hard negatives.
+func LoadDataFromDatabase(database data.Database, feedbackTypes, negativeFeedbackTypes []string, feedbackWeights map[string]float32, itemTTL, positiveFeedbackTTL uint) (*DataSet, []data.Item, []data.Feedback, error) {
 	// setup time limit
 	var itemTimeLimit, feedbackTimeLimit *time.Time
 	if itemTTL > 0 {
@@ -333,13 +435,28 @@ func LoadDataFromDatabase(database data.Database, feedbackTypes []string, itemTT
 			return nil, nil, nil, err
 		}
 		for _, v := range feedback {
-			dataset.AddFeedback(v.UserId, v.ItemId, false)
+			dataset.AddWeightedFeedback(v.UserId, v.ItemId, v.Weight(feedbackWeights), false)
 			allFeedback = append(allFeedback, v)
 		}
 		if cursor == "" {
 			break
 		}
 	}
+	dataset.SetSequences(allFeedback)
+	// pull negative feedback
+	for len(negativeFeedbackTypes) > 0 {
+		var feedback []data.Feedback
+		cursor, feedback, err = database.GetFeedback(cursor, batchSize, feedbackTimeLimit, negativeFeedbackTypes...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, v := range feedback {
+			dataset.AddNegativeFeedback(v.UserId, v.ItemId)
+		}
+		if cursor == "" {
+			break
+		}
+	}
 	return dataset, allItems, allFeedback, nil
 }
 
@@ -20,6 +20,7 @@ import (
 	"github.com/zhenghaoz/gorse/storage/data"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNewMapIndexDataset(t *testing.T) {
@@ -98,10 +99,21 @@ func TestLoadDataFromDatabase(t *testing.T) {
 			assert.Nil(t, err)
 		}
 	}
+	err := database.InsertFeedback(data.Feedback{
+		FeedbackKey: data.FeedbackKey{
+			UserId:       "user0",
+			ItemId:       "item0",
+			FeedbackType: "NegativeFeedbackType",
+		},
+	}, false, false)
+	assert.Nil(t, err)
 	// load data
-	dataset, _, _, err := LoadDataFromDatabase(database.Database, []string{"FeedbackType"}, 0, 0)
+	dataset, _, _, err := LoadDataFromDatabase(database.Database, []string{"FeedbackType"}, []string{"NegativeFeedbackType"}, nil, 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 9, dataset.Count())
+	assert.Nil(t, dataset.UserFeedbackWeights)
+	assert.Nil(t, dataset.ItemFeedbackWeights)
+	assert.Equal(t, [][]int{{dataset.ItemIndex.ToNumber("item0")}}, dataset.HardNegatives)
 	// split
 	train, test := dataset.Split(0, 0)
 	assert.Equal(t, numUsers, train.UserCount())
@@ -110,6 +122,7 @@ func TestLoadDataFromDatabase(t *testing.T) {
 	assert.Equal(t, numUsers, test.UserCount())
 	assert.Equal(t, numItems, test.ItemCount())
 	assert.Equal(t, numUsers, test.Count())
+	assert.Equal(t, dataset.HardNegatives, train.HardNegatives)
 	// part split
 	train2, test2 := dataset.Split(2, 0)
 	assert.Equal(t, numUsers, train2.UserCount())
@@ -119,3 +132,72 @@ func TestLoadDataFromDatabase(t *testing.T) {
 	assert.Equal(t, numItems, test2.ItemCount())
 	assert.Equal(t, 2, test2.Count())
 }
+
+func TestDataSet_AddWeightedFeedback(t *testing.T) {
+	dataset := NewMapIndexDataset()
+	dataset.AddFeedback("0", "0", true)
+	dataset.AddWeightedFeedback("0", "1", 2, true)
+	dataset.AddWeightedFeedback("1", "1", 3, true)
+	dataset.AddFeedback("1", "0", true)
+	assert.Equal(t, [][]float32{{1, 2}, {3, 1}}, dataset.UserFeedbackWeights)
+	assert.Equal(t, [][]float32{{1, 1}, {2, 3}}, dataset.ItemFeedbackWeights)
+	assert.Equal(t, float32(2), dataset.UserFeedbackWeight(0, 1))
+	assert.Equal(t, float32(3), dataset.ItemFeedbackWeight(1, 1))
+	// split
+	expected := [][]float32{{1, 2}, {1, 3}} // weights[user][item]
+	train, test := dataset.Split(0, 0)
+	for _, subset := range []*DataSet{train, test} {
+		for userIndex, items := range subset.UserFeedback {
+			for k, itemIndex := range items {
+				assert.Equal(t, expected[userIndex][itemIndex], subset.UserFeedbackWeight(userIndex, k))
+			}
+		}
+		for itemIndex, users := range subset.ItemFeedback {
+			for k, userIndex := range users {
+				assert.Equal(t, expected[userIndex][itemIndex], subset.ItemFeedbackWeight(itemIndex, k))
+			}
+		}
+	}
+	// unweighted
+	dataset = NewMapIndexDataset()
+	dataset.AddFeedback("0", "0", true)
+	assert.Nil(t, dataset.UserFeedbackWeights)
+	assert.Equal(t, float32(1), dataset.UserFeedbackWeight(0, 0))
+}
+
+func TestDataSet_SetSequences(t *testing.T) {
+	dataset := NewMapIndexDataset()
+	dataset.AddFeedback("0", "0", true)
+	dataset.AddFeedback("0", "1", true)
+	dataset.AddFeedback("0", "2", true)
+	dataset.AddFeedback("1", "2", true)
+	// sequences are nil by default
+	assert.Nil(t, dataset.UserSequences)
+	assert.Equal(t, dataset.UserFeedback[0], dataset.UserSequence(0))
+	// sort by timestamps
+	now := time.Now()
+	dataset.SetSequences([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{UserId: "0", ItemId: "0"}, Timestamp: now.Add(time.Hour)},
+		{FeedbackKey: data.FeedbackKey{UserId: "0", ItemId: "1"}, Timestamp: now.Add(-time.Hour)},
+		{FeedbackKey: data.FeedbackKey{UserId: "0", ItemId: "2"}, Timestamp: now},
+		{FeedbackKey: data.FeedbackKey{UserId: "1", ItemId: "2"}, Timestamp: now},
+		{FeedbackKey: data.FeedbackKey{UserId: "1", ItemId: "unknown"}, Timestamp: now},
+		{FeedbackKey: data.FeedbackKey{UserId: "unknown", ItemId: "2"}, Timestamp: now},
+	})
+	assert.Equal(t, []int{1, 2, 0}, dataset.UserSequence(0))
+	assert.Equal(t, []int{2}, dataset.UserSequence(1))
+	assert.Equal(t, []int{2, 0}, RecentItems(dataset.UserSequence(0), 2))
+	// remove test items from sequences
+	train, test := dataset.Split(0, 0)
+	for userIndex := range dataset.UserSequences {
+		expected := make([]int, 0)
+		for _, itemIndex := range dataset.UserSequence(userIndex) {
+			if itemIndex != test.UserFeedback[userIndex][0] {
+				expected = append(expected, itemIndex)
+			}
+		}
+		assert.ElementsMatch(t, train.UserFeedback[userIndex], expected)
+		assert.Equal(t, expected, append([]int{}, train.UserSequence(userIndex)...))
+	}
+	assert.Nil(t, test.UserSequences)
+}
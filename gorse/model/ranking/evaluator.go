@@ -50,7 +50,11 @@ func Evaluate(estimator model.Model, testSet, trainSet *DataSet, topK, numCandid
 			candidates = append(candidates, testSet.UserFeedback[userIndex]...)
 			candidates = append(candidates, negativeSample...)
 			// Find top-n ItemFeedback in predictions
-			rankList, _ := Rank(estimator, userIndex, trainSet.UserFeedback[userIndex], candidates, topK)
+			userProfile := trainSet.UserFeedback[userIndex]
+			if sequentialModel, ok := estimator.(SequentialModel); ok {
+				userProfile = RecentItems(trainSet.UserSequence(userIndex), sequentialModel.SequenceLength())
+			}
+			rankList, _ := Rank(estimator, userIndex, userProfile, candidates, topK)
 			partCount[workerId]++
 			for i, metric := range scorers {
 				partSum[workerId][i] += metric(targetSet, rankList)
@@ -162,7 +166,7 @@ func Rank(model model.Model, userId int, userProfile, candidates []int, topN int
 		switch model := model.(type) {
 		case MatrixFactorization:
 			itemsHeap.Push(itemId, model.InternalPredict(userId, itemId))
-		case *KNN:
+		case ItemBasedModel:
 			itemsHeap.Push(itemId, model.InternalPredict(userProfile, itemId))
 		default:
 			panic("unknown model")
@@ -176,10 +180,42 @@ func Rank(model model.Model, userId int, userProfile, candidates []int, topN int
 	return recommends, scores
 }
 
+// EvaluateIndex evaluates the recall of a vector index over item factors compared to brute force search.
+// Factors of users are used as queries and at most numQueries users are evenly selected.
+func EvaluateIndex(m FactorModel, index VectorIndex, topK, numQueries int) float32 {
+	numUsers := m.GetUserIndex().Len()
+	if numUsers == 0 || numQueries <= 0 {
+		return 0
+	}
+	step := numUsers / numQueries
+	if step < 1 {
+		step = 1
+	}
+	bruteForce := NewBruteForceIndex(ItemFactors(m))
+	var hit, total float32
+	for userIndex := 0; userIndex < numUsers; userIndex += step {
+		userFactor := m.GetUserFactor(userIndex)
+		expected, _ := bruteForce.Search(userFactor, topK)
+		actual, _ := index.Search(userFactor, topK)
+		targetSet := set.NewIntSet(expected...)
+		for _, itemIndex := range actual {
+			if targetSet.Has(itemIndex) {
+				hit++
+			}
+		}
+		total += float32(len(expected))
+	}
+	if total == 0 {
+		return 0
+	}
+	return hit / total
+}
+
 // SnapshotManger manages the best snapshot.
 type SnapshotManger struct {
 	BestWeights []interface{}
 	BestScore   Score
+	numStale    int // number of snapshots after the best snapshot
 }
 
 // AddSnapshot adds a copied snapshot.
@@ -191,6 +227,9 @@ func (sm *SnapshotManger) AddSnapshot(score Score, weights ...interface{}) {
 		} else {
 			sm.BestWeights = temp.([]interface{})
 		}
+		sm.numStale = 0
+	} else {
+		sm.numStale++
 	}
 }
 
@@ -202,5 +241,14 @@ func (sm *SnapshotManger) AddSnapshotNoCopy(score Score, weights ...interface{})
 		for i := range weights {
 			sm.BestWeights[i] = weights[i]
 		}
+		sm.numStale = 0
+	} else {
+		sm.numStale++
 	}
 }
+
+// EarlyStop returns true if the best score hasn't been improved for the last patience snapshots. Early stopping
+// is disabled if patience is zero.
+func (sm *SnapshotManger) EarlyStop(patience int) bool {
+	return patience > 0 && sm.numStale >= patience
+}
@@ -161,3 +161,17 @@ func TestSnapshotManger_AddSnapshot(t *testing.T) {
 	assert.Equal(t, []int{3}, snapshots.BestWeights[0])
 	assert.Equal(t, [][]int{{3}}, snapshots.BestWeights[1])
 }
+
+func TestSnapshotManger_EarlyStop(t *testing.T) {
+	snapshots := SnapshotManger{}
+	snapshots.AddSnapshot(Score{NDCG: 1})
+	assert.False(t, snapshots.EarlyStop(1))
+	snapshots.AddSnapshot(Score{NDCG: 1})
+	assert.True(t, snapshots.EarlyStop(1))
+	assert.False(t, snapshots.EarlyStop(2))
+	assert.False(t, snapshots.EarlyStop(0))
+	snapshots.AddSnapshotNoCopy(Score{NDCG: 0.5})
+	assert.True(t, snapshots.EarlyStop(2))
+	snapshots.AddSnapshotNoCopy(Score{NDCG: 2})
+	assert.False(t, snapshots.EarlyStop(1))
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ranking
+
+import (
+	"github.com/chewxy/math32"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// FactorModel is a matrix factorization model whose predictions are inner products of factors.
+type FactorModel interface {
+	MatrixFactorization
+	// GetUserFactor returns the factor of a user.
+	GetUserFactor(userIndex int) []float32
+	// GetItemFactor returns the factor of a item.
+	GetItemFactor(itemIndex int) []float32
+}
+
+func (bpr *BPR) GetUserFactor(userIndex int) []float32 {
+	return bpr.UserFactor[userIndex]
+}
+
+func (bpr *BPR) GetItemFactor(itemIndex int) []float32 {
+	return bpr.ItemFactor[itemIndex]
+}
+
+func (als *ALS) GetUserFactor(userIndex int) []float32 {
+	return denseRow(als.UserFactor, userIndex)
+}
+
+func (als *ALS) GetItemFactor(itemIndex int) []float32 {
+	return denseRow(als.ItemFactor, itemIndex)
+}
+
+func (ccd *CCD) GetUserFactor(userIndex int) []float32 {
+	return ccd.UserFactor[userIndex]
+}
+
+func (ccd *CCD) GetItemFactor(itemIndex int) []float32 {
+	return ccd.ItemFactor[itemIndex]
+}
+
+func denseRow(m *mat.Dense, i int) []float32 {
+	_, c := m.Dims()
+	row := make([]float32, c)
+	for j := range row {
+		row[j] = float32(m.At(i, j))
+	}
+	return row
+}
+
+// ItemFactors returns factors of all items in a factor model.
+func ItemFactors(m FactorModel) [][]float32 {
+	vectors := make([][]float32, m.GetItemIndex().Len())
+	for i := range vectors {
+		vectors[i] = m.GetItemFactor(i)
+	}
+	return vectors
+}
+
+// VectorIndex retrieves vectors with the largest inner products to a query.
+type VectorIndex interface {
+	// Search returns indices and inner products of top n vectors.
+	Search(q []float32, n int) ([]int, []float32)
+}
+
+// BruteForceIndex scans all vectors for each query.
+type BruteForceIndex struct {
+	vectors [][]float32
+}
+
+// NewBruteForceIndex creates a brute force index.
+func NewBruteForceIndex(vectors [][]float32) *BruteForceIndex {
+	return &BruteForceIndex{vectors: vectors}
+}
+
+// Search top n vectors by scanning all vectors.
+func (idx *BruteForceIndex) Search(q []float32, n int) ([]int, []float32) {
+	filter := base.NewTopKFilter(n)
+	for i, vector := range idx.vectors {
+		filter.Push(i, floats.Dot(q, vector))
+	}
+	return filter.PopAll()
+}
+
+// IVF is an inverted file index. Vectors are partitioned into clusters by k-means and only vectors in
+// clusters whose centroids have the largest inner products to the query are scanned.
+type IVF struct {
+	vectors   [][]float32
+	centroids [][]float32
+	clusters  [][]int
+	numProbe  int
+}
+
+// NewIVF builds an inverted file index. If the number of clusters is 0, it's set to the square root of
+// the number of vectors. If the number of probes is 0, 10% of clusters are probed.
+func NewIVF(vectors [][]float32, numClusters, numProbe, numIter, numJobs int, seed int64) *IVF {
+	if numClusters <= 0 {
+		numClusters = int(math32.Sqrt(float32(len(vectors))))
+	}
+	if numClusters > len(vectors) {
+		numClusters = len(vectors)
+	}
+	if numClusters < 1 {
+		numClusters = 1
+	}
+	if numProbe <= 0 {
+		numProbe = numClusters / 10
+	}
+	if numProbe < 1 {
+		numProbe = 1
+	}
+	idx := &IVF{vectors: vectors, numProbe: numProbe}
+	if len(vectors) == 0 {
+		// no vectors to be clustered
+		return idx
+	}
+	// initialize centroids by random vectors
+	rng := base.NewRandomGenerator(seed)
+	idx.centroids = make([][]float32, numClusters)
+	for i, j := range rng.Perm(len(vectors))[:numClusters] {
+		idx.centroids[i] = append([]float32(nil), vectors[j]...)
+	}
+	// k-means
+	assignments := make([]int, len(vectors))
+	for it := 0; it < numIter; it++ {
+		idx.assign(assignments, numJobs)
+		idx.update(assignments)
+	}
+	idx.assign(assignments, numJobs)
+	idx.clusters = make([][]int, numClusters)
+	for i, c := range assignments {
+		idx.clusters[c] = append(idx.clusters[c], i)
+	}
+	return idx
+}
+
+// assign vectors to nearest centroids.
+func (idx *IVF) assign(assignments []int, numJobs int) {
+	_ = base.Parallel(len(idx.vectors), numJobs, func(_, i int) error {
+		best, bestDistance := 0, float32(math32.MaxFloat32)
+		for c, centroid := range idx.centroids {
+			var distance float32
+			for k := range centroid {
+				d := centroid[k] - idx.vectors[i][k]
+				distance += d * d
+			}
+			if distance < bestDistance {
+				best, bestDistance = c, distance
+			}
+		}
+		assignments[i] = best
+		return nil
+	})
+}
+
+// update centroids by means of assigned vectors. Empty clusters keep their centroids.
+func (idx *IVF) update(assignments []int) {
+	sums := make([][]float32, len(idx.centroids))
+	counts := make([]float32, len(idx.centroids))
+	for i, c := range assignments {
+		if sums[c] == nil {
+			sums[c] = make([]float32, len(idx.vectors[i]))
+		}
+		floats.Add(sums[c], idx.vectors[i])
+		counts[c]++
+	}
+	for c := range idx.centroids {
+		if counts[c] > 0 {
+			floats.MulConst(sums[c], 1/counts[c])
+			idx.centroids[c] = sums[c]
+		}
+	}
+}
+
+// Search top n vectors in probed clusters. Clusters are probed in the order of inner products between centroids and
+// the query. At least numProbe clusters are probed, and more clusters are probed until n vectors have been scanned.
+func (idx *IVF) Search(q []float32, n int) ([]int, []float32) {
+	// rank clusters to probe
+	probes := base.NewTopKFilter(len(idx.centroids))
+	for c, centroid := range idx.centroids {
+		if len(idx.clusters[c]) > 0 {
+			probes.Push(c, floats.Dot(q, centroid))
+		}
+	}
+	clusters, _ := probes.PopAll()
+	// scan vectors in clusters
+	filter := base.NewTopKFilter(n)
+	numScanned := 0
+	for i, c := range clusters {
+		if i >= idx.numProbe && numScanned >= n {
+			break
+		}
+		for _, j := range idx.clusters[c] {
+			filter.Push(j, floats.Dot(q, idx.vectors[j]))
+		}
+		numScanned += len(idx.clusters[c])
+	}
+	return filter.PopAll()
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ranking
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+)
+
+var (
+	_ FactorModel = &BPR{}
+	_ FactorModel = &ALS{}
+	_ FactorModel = &CCD{}
+)
+
+func newRandomBPR(numUsers, numItems, numFactors int) *BPR {
+	rng := base.NewRandomGenerator(0)
+	bpr := NewBPR(nil)
+	bpr.UserIndex = base.NewMapIndex()
+	bpr.ItemIndex = base.NewMapIndex()
+	for i := 0; i < numUsers; i++ {
+		bpr.UserIndex.Add(strconv.Itoa(i))
+	}
+	for i := 0; i < numItems; i++ {
+		bpr.ItemIndex.Add(strconv.Itoa(i))
+	}
+	bpr.UserFactor = rng.NormalMatrix(numUsers, numFactors, 0, 1)
+	bpr.ItemFactor = rng.NormalMatrix(numItems, numFactors, 0, 1)
+	return bpr
+}
+
+func TestBruteForceIndex(t *testing.T) {
+	index := NewBruteForceIndex([][]float32{{1, 0}, {0, 1}, {1, 1}, {-1, -1}})
+	indices, scores := index.Search([]float32{1, 2}, 3)
+	assert.Equal(t, []int{2, 1, 0}, indices)
+	assert.Equal(t, []float32{3, 2, 1}, scores)
+}
+
+func TestIVF(t *testing.T) {
+	bpr := newRandomBPR(100, 1000, 8)
+	vectors := ItemFactors(bpr)
+	// probe all clusters
+	index := NewIVF(vectors, 10, 10, 10, 2, 0)
+	assert.Equal(t, float32(1), EvaluateIndex(bpr, index, 10, 100))
+	// probe part of clusters
+	index = NewIVF(vectors, 10, 3, 10, 2, 0)
+	recall := EvaluateIndex(bpr, index, 10, 100)
+	assert.Greater(t, recall, float32(0.5))
+	assert.Less(t, recall, float32(1))
+	// probe more clusters until enough vectors are scanned
+	index = NewIVF(vectors, 10, 1, 10, 2, 0)
+	indices, _ := index.Search(bpr.GetUserFactor(0), 500)
+	assert.Equal(t, 500, len(indices))
+	// default settings
+	index = NewIVF(vectors, 0, 0, 10, 2, 0)
+	assert.Equal(t, 31, len(index.centroids))
+	assert.Equal(t, 3, index.numProbe)
+}
+
+func TestIVF_Empty(t *testing.T) {
+	index := NewIVF(nil, 0, 0, 10, 2, 0)
+	indices, scores := index.Search([]float32{1, 2}, 3)
+	assert.Empty(t, indices)
+	assert.Empty(t, scores)
+}
@@ -0,0 +1,320 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ranking
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chewxy/math32"
+	"github.com/scylladb/go-set"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+	"go.uber.org/zap"
+	"gonum.org/v1/gonum/mat"
+)
+
+// slimTolerance is the max change of weights to stop coordinate descent of SLIM.
+const slimTolerance = 1e-4
+
+// predictItemBased predicts the score of a item given a user profile for item-based models.
+func predictItemBased(m ItemBasedModel, itemIndex base.Index, userProfile []string, itemId string) float32 {
+	supportIndices := make([]int, 0, len(userProfile))
+	for _, supportId := range userProfile {
+		supportIndex := itemIndex.ToNumber(supportId)
+		if supportIndex == base.NotId {
+			base.Logger().Info("unknown item:", zap.String("item_id", supportId))
+			return 0
+		}
+		supportIndices = append(supportIndices, supportIndex)
+	}
+	index := itemIndex.ToNumber(itemId)
+	if index == base.NotId {
+		base.Logger().Info("unknown item:", zap.String("item_id", itemId))
+		return 0
+	}
+	return m.InternalPredict(supportIndices, index)
+}
+
+// EASE is a linear item-item model with a closed-form solution [1]. The weight matrix B is the solution of
+//
+//   min_B ||X - XB||^2_F + \lambda ||B||^2_F  s.t. diag(B) = 0
+//
+// which is B = I - P diagMat(1/diag(P)), where P = (X^TX + \lambda I)^{-1}. The time complexity of training is
+// O(n^3) for n items and the weights are dense, so it fits catalogs with no more than tens of thousands items.
+//
+// Hyper-parameters:
+//	 Reg 		- The L2 regularization strength \lambda. Default is 100.
+//	 MaxItems 	- The max number of items. Fitting is refused for larger catalogs before n×n matrices are
+//			  allocated. Default is 5000.
+//
+// [1] Steck, Harald. "Embarrassingly shallow autoencoders for sparse data." The World Wide Web Conference. 2019.
+type EASE struct {
+	model.BaseModel
+	ItemIndex base.Index
+	Weights   [][]float32 // Weights[i][j] is the contribution of item i in a user profile to item j
+	reg       float32
+	maxItems  int
+}
+
+// NewEASE creates a EASE model.
+func NewEASE(params model.Params) *EASE {
+	ease := new(EASE)
+	ease.SetParams(params)
+	return ease
+}
+
+func (ease *EASE) SetParams(params model.Params) {
+	ease.BaseModel.SetParams(params)
+	ease.reg = ease.Params.GetFloat32(model.Reg, 100)
+	ease.maxItems = ease.Params.GetInt(model.MaxItems, 5000)
+}
+
+func (ease *EASE) GetParamsGrid() model.ParamsGrid {
+	return model.ParamsGrid{
+		model.Reg: []interface{}{10, 50, 100, 200, 500, 1000},
+	}
+}
+
+func (ease *EASE) Clear() {
+	ease.ItemIndex = nil
+	ease.Weights = nil
+}
+
+func (ease *EASE) Invalid() bool {
+	return ease == nil || ease.ItemIndex == nil || ease.Weights == nil
+}
+
+func (ease *EASE) GetItemIndex() base.Index {
+	return ease.ItemIndex
+}
+
+func (ease *EASE) Predict(userProfile []string, itemId string) float32 {
+	return predictItemBased(ease, ease.ItemIndex, userProfile, itemId)
+}
+
+func (ease *EASE) InternalPredict(userProfile []int, itemIndex int) float32 {
+	sum := float32(0)
+	for _, supportIndex := range userProfile {
+		sum += ease.Weights[supportIndex][itemIndex]
+	}
+	return sum
+}
+
+func (ease *EASE) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
+	config = config.LoadDefaultIfNil()
+	base.Logger().Info("fit ease",
+		zap.Any("params", ease.GetParams()),
+		zap.Any("config", config))
+	numItems := trainSet.ItemCount()
+	if numItems > ease.maxItems {
+		// dense matrices of too many items run out of memory
+		base.Logger().Error("too many items to fit ease",
+			zap.Int("n_items", numItems),
+			zap.Int("max_items", ease.maxItems))
+		ease.Clear()
+		return Score{}
+	}
+	ease.ItemIndex = trainSet.ItemIndex
+	fitStart := time.Now()
+	// G = X^TX + \lambda I
+	gram := make([]float64, numItems*numItems)
+	for _, userFeedback := range trainSet.UserFeedback {
+		for _, i := range userFeedback {
+			for _, j := range userFeedback {
+				gram[i*numItems+j]++
+			}
+		}
+	}
+	for i := 0; i < numItems; i++ {
+		gram[i*numItems+i] += float64(ease.reg)
+	}
+	// P = G^{-1}
+	var chol mat.Cholesky
+	if ok := chol.Factorize(mat.NewSymDense(numItems, gram)); !ok {
+		base.Logger().Error("failed to factorize gram matrix")
+		return Score{}
+	}
+	var p mat.SymDense
+	if err := chol.InverseTo(&p); err != nil {
+		base.Logger().Error("failed to inverse gram matrix", zap.Error(err))
+		return Score{}
+	}
+	// B_{ij} = -P_{ij} / P_{jj} and B_{jj} = 0
+	ease.Weights = base.NewMatrix32(numItems, numItems)
+	_ = base.Parallel(numItems, config.Jobs, func(_, i int) error {
+		for j := 0; j < numItems; j++ {
+			if i != j {
+				ease.Weights[i][j] = float32(-p.At(i, j) / p.At(j, j))
+			}
+		}
+		return nil
+	})
+	fitTime := time.Since(fitStart)
+	evalStart := time.Now()
+	scores := Evaluate(ease, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+	evalTime := time.Since(evalStart)
+	base.Logger().Info("fit ease complete",
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]),
+		zap.String("fit_time", fitTime.String()),
+		zap.String("eval_time", evalTime.String()))
+	return Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+}
+
+// SLIM is a sparse linear item-item model [1]. Each column w_j of the weight matrix W is the solution of
+//
+//   min_{w_j} 1/2 ||x_j - Xw_j||^2 + \beta/2 ||w_j||^2 + \lambda ||w_j||_1  s.t. w_j >= 0, w_{jj} = 0
+//
+// which is solved by coordinate descent. Only items co-occurred with item j are candidates of non-zero weights.
+//
+// Hyper-parameters:
+//	 Reg 		- The L2 regularization strength \beta. Default is 1.
+//	 L1Reg 		- The L1 regularization strength \lambda. Default is 1.
+//	 NEpochs	- The max number of sweeps of coordinate descent. Default is 10.
+//
+// [1] Ning, Xia, and George Karypis. "Slim: Sparse linear methods for top-n recommender systems." 2011 IEEE 11th
+// International Conference on Data Mining. IEEE, 2011.
+type SLIM struct {
+	model.BaseModel
+	ItemIndex base.Index
+	Weights   []ConcurrentMap // Weights[i] stores non-zero contributions of item i in a user profile to items
+	reg       float32
+	l1Reg     float32
+	nEpochs   int
+}
+
+// NewSLIM creates a SLIM model.
+func NewSLIM(params model.Params) *SLIM {
+	slim := new(SLIM)
+	slim.SetParams(params)
+	return slim
+}
+
+func (slim *SLIM) SetParams(params model.Params) {
+	slim.BaseModel.SetParams(params)
+	slim.reg = slim.Params.GetFloat32(model.Reg, 1)
+	slim.l1Reg = slim.Params.GetFloat32(model.L1Reg, 1)
+	slim.nEpochs = slim.Params.GetInt(model.NEpochs, 10)
+}
+
+func (slim *SLIM) GetParamsGrid() model.ParamsGrid {
+	return model.ParamsGrid{
+		model.Reg:   []interface{}{0.1, 1, 10},
+		model.L1Reg: []interface{}{0.1, 1, 10},
+	}
+}
+
+func (slim *SLIM) Clear() {
+	slim.ItemIndex = nil
+	slim.Weights = nil
+}
+
+func (slim *SLIM) Invalid() bool {
+	return slim == nil || slim.ItemIndex == nil || slim.Weights == nil
+}
+
+func (slim *SLIM) GetItemIndex() base.Index {
+	return slim.ItemIndex
+}
+
+func (slim *SLIM) Predict(userProfile []string, itemId string) float32 {
+	return predictItemBased(slim, slim.ItemIndex, userProfile, itemId)
+}
+
+func (slim *SLIM) InternalPredict(userProfile []int, itemIndex int) float32 {
+	sum := float32(0)
+	for _, supportIndex := range userProfile {
+		sum += slim.Weights[supportIndex].Get(itemIndex)
+	}
+	return sum
+}
+
+func (slim *SLIM) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
+	config = config.LoadDefaultIfNil()
+	base.Logger().Info("fit slim",
+		zap.Any("params", slim.GetParams()),
+		zap.Any("config", config))
+	slim.ItemIndex = trainSet.ItemIndex
+	slim.Weights = make([]ConcurrentMap, trainSet.ItemCount())
+	for i := range slim.Weights {
+		slim.Weights[i] = NewConcurrentMap()
+	}
+	fitStart := time.Now()
+	// residuals of each job
+	residuals := base.NewMatrix32(config.Jobs, trainSet.UserCount())
+	_ = base.Parallel(trainSet.ItemCount(), config.Jobs, func(workerId, j int) error {
+		// r = x_j
+		r := residuals[workerId]
+		for _, userIndex := range trainSet.ItemFeedback[j] {
+			r[userIndex] = 1
+		}
+		// collect candidates
+		candidateSet := set.NewIntSet()
+		for _, userIndex := range trainSet.ItemFeedback[j] {
+			candidateSet.Add(trainSet.UserFeedback[userIndex]...)
+		}
+		candidateSet.Remove(j)
+		candidates := candidateSet.List()
+		weights := make([]float32, len(candidates))
+		// coordinate descent
+		for ep := 0; ep < slim.nEpochs; ep++ {
+			maxDelta := float32(0)
+			for k, i := range candidates {
+				norm := float32(len(trainSet.ItemFeedback[i]))
+				grad := norm * weights[k]
+				for _, userIndex := range trainSet.ItemFeedback[i] {
+					grad += r[userIndex]
+				}
+				weight := math32.Max(0, grad-slim.l1Reg) / (norm + slim.reg)
+				if delta := weight - weights[k]; delta != 0 {
+					for _, userIndex := range trainSet.ItemFeedback[i] {
+						r[userIndex] -= delta
+					}
+					weights[k] = weight
+					maxDelta = math32.Max(maxDelta, math32.Abs(delta))
+				}
+			}
+			if maxDelta < slimTolerance {
+				break
+			}
+		}
+		// save weights and reset residuals
+		for k, i := range candidates {
+			if weights[k] > 0 {
+				slim.Weights[i].Set(j, weights[k])
+			}
+			for _, userIndex := range trainSet.ItemFeedback[i] {
+				r[userIndex] = 0
+			}
+		}
+		for _, userIndex := range trainSet.ItemFeedback[j] {
+			r[userIndex] = 0
+		}
+		return nil
+	})
+	fitTime := time.Since(fitStart)
+	evalStart := time.Now()
+	scores := Evaluate(slim, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+	evalTime := time.Since(evalStart)
+	base.Logger().Info("fit slim complete",
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]),
+		zap.String("fit_time", fitTime.String()),
+		zap.String("eval_time", evalTime.String()))
+	return Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ranking
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+)
+
+// newClusteredDataset creates a dataset where users of a cluster only interact with items of the cluster.
+func newClusteredDataset(numClusters, numItemsPerCluster, numUsersPerCluster int) *DataSet {
+	dataset := NewMapIndexDataset()
+	rng := base.NewRandomGenerator(0)
+	for c := 0; c < numClusters; c++ {
+		for u := 0; u < numUsersPerCluster; u++ {
+			userId := strconv.Itoa(c*numUsersPerCluster + u)
+			for _, i := range rng.Sample(0, numItemsPerCluster, numItemsPerCluster/2) {
+				dataset.AddFeedback(userId, strconv.Itoa(c*numItemsPerCluster+i), true)
+			}
+		}
+	}
+	return dataset
+}
+
+func testItemBasedModel(t *testing.T, name string, m ItemBasedModel) {
+	trainSet, testSet := newClusteredDataset(2, 10, 50).Split(0, 0)
+	score := m.Fit(trainSet, testSet, &FitConfig{Jobs: 2, Candidates: 10, TopK: 10})
+	assert.Greater(t, score.NDCG, float32(0.5))
+	// items in the same cluster are preferred
+	userProfile := []string{"0", "1", "2"}
+	assert.Greater(t, m.Predict(userProfile, "3"), m.Predict(userProfile, "13"))
+	assert.Equal(t, m.Predict(userProfile, "3"),
+		m.InternalPredict([]int{trainSet.ItemIndex.ToNumber("0"), trainSet.ItemIndex.ToNumber("1"),
+			trainSet.ItemIndex.ToNumber("2")}, trainSet.ItemIndex.ToNumber("3")))
+	// unknown items
+	assert.Zero(t, m.Predict([]string{"unknown"}, "3"))
+	assert.Zero(t, m.Predict(userProfile, "unknown"))
+	// test encode and decode
+	buf, err := EncodeModel(m)
+	assert.NoError(t, err)
+	decoded, err := DecodeModel(name, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Predict(userProfile, "3"), decoded.(ItemBasedModel).Predict(userProfile, "3"))
+}
+
+func TestEASE(t *testing.T) {
+	m := NewEASE(model.Params{model.Reg: 10})
+	testItemBasedModel(t, "ease", m)
+	// weights of items themselves are zeros
+	for i := range m.Weights {
+		assert.Zero(t, m.Weights[i][i])
+	}
+	// test clear
+	m.Clear()
+	assert.True(t, m.Invalid())
+	// refuse catalogs larger than max items
+	trainSet, testSet := newClusteredDataset(2, 10, 50).Split(0, 0)
+	m = NewEASE(model.Params{model.MaxItems: 10})
+	score := m.Fit(trainSet, testSet, nil)
+	assert.Zero(t, score)
+	assert.True(t, m.Invalid())
+}
+
+func TestSLIM(t *testing.T) {
+	m := NewSLIM(model.Params{model.Reg: 1, model.L1Reg: 0.1, model.NEpochs: 20})
+	testItemBasedModel(t, "slim", m)
+	// weights are sparse and non-negative
+	for i := range m.Weights {
+		assert.Zero(t, m.Weights[i].Get(i))
+		for _, w := range m.Weights[i].Map {
+			assert.Greater(t, w, float32(0))
+		}
+	}
+	// test clear
+	m.Clear()
+	assert.True(t, m.Invalid())
+}
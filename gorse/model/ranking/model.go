@@ -37,11 +37,39 @@ type Score struct {
 	Recall    float32
 }
 
+// LearningCurve records training losses of every epoch and scores of evaluated epochs during fitting. Models are
+// evaluated every Verbose epochs, so there are fewer scores than losses.
+type LearningCurve struct {
+	Epochs     []int     // epochs with training losses
+	Losses     []float32 // training losses
+	EvalEpochs []int     // evaluated epochs
+	Scores     []Score   // scores of evaluated epochs
+}
+
+// AddLoss appends the training loss of an epoch to the learning curve. Nothing happens if the learning curve is nil.
+func (curve *LearningCurve) AddLoss(epoch int, loss float32) {
+	if curve != nil {
+		curve.Epochs = append(curve.Epochs, epoch)
+		curve.Losses = append(curve.Losses, loss)
+	}
+}
+
+// AddScore appends the score of an evaluated epoch to the learning curve. Nothing happens if the learning curve
+// is nil.
+func (curve *LearningCurve) AddScore(epoch int, score Score) {
+	if curve != nil {
+		curve.EvalEpochs = append(curve.EvalEpochs, epoch)
+		curve.Scores = append(curve.Scores, score)
+	}
+}
+
 type FitConfig struct {
 	Jobs       int
-	Verbose    int
+	Verbose    int // evaluate every Verbose epochs, where early stopping is checked
 	Candidates int
 	TopK       int
+	Patience   int            // stop fitting if scores aren't improved for Patience evaluations (0 means disabled)
+	Curve      *LearningCurve // learning curve recorded during fitting (optional)
 }
 
 func NewFitConfig() *FitConfig {
@@ -58,6 +86,11 @@ func (config *FitConfig) SetJobs(nJobs int) *FitConfig {
 	return config
 }
 
+func (config *FitConfig) SetPatience(patience int) *FitConfig {
+	config.Patience = patience
+	return config
+}
+
 func (config *FitConfig) LoadDefaultIfNil() *FitConfig {
 	if config == nil {
 		return NewFitConfig()
@@ -83,6 +116,30 @@ type MatrixFactorization interface {
 	GetUserIndex() base.Index
 }
 
+// ItemBasedModel predicts scores of items from items in the profile of a user.
+type ItemBasedModel interface {
+	Model
+	// Predict the score of a item (itemId) given items (userProfile) in the profile of a user.
+	Predict(userProfile []string, itemId string) float32
+	// InternalPredict predicts the score given item indices in the profile of a user and a item index.
+	InternalPredict(userProfile []int, itemIndex int) float32
+}
+
+// SequentialModel predicts scores of items from the most recent items of a user in chronological order.
+type SequentialModel interface {
+	ItemBasedModel
+	// SequenceLength returns the number of most recent items used in predictions.
+	SequenceLength() int
+}
+
+// RecentItems returns at most n most recent items of a sequence.
+func RecentItems(sequence []int, n int) []int {
+	if len(sequence) > n {
+		return sequence[len(sequence)-n:]
+	}
+	return sequence
+}
+
 type BaseMatrixFactorization struct {
 	model.BaseModel
 	UserIndex base.Index
@@ -112,6 +169,14 @@ func NewModel(name string, params model.Params) (Model, error) {
 		return NewCCD(params), nil
 	case "knn":
 		return NewKNN(params), nil
+	case "ease":
+		return NewEASE(params), nil
+	case "slim":
+		return NewSLIM(params), nil
+	case "item2vec":
+		return NewItem2Vec(params), nil
+	case "fmc":
+		return NewFMC(params), nil
 	}
 	return nil, fmt.Errorf("unknown model %v", name)
 }
@@ -168,6 +233,34 @@ func DecodeModel(name string, buf []byte) (Model, error) {
 			return nil, err
 		}
 		return &knn, nil
+	case "ease":
+		var ease EASE
+		if err := decoder.Decode(&ease); err != nil {
+			return nil, err
+		}
+		return &ease, nil
+	case "slim":
+		var slim SLIM
+		if err := decoder.Decode(&slim); err != nil {
+			return nil, err
+		}
+		return &slim, nil
+	case "item2vec":
+		var item2Vec Item2Vec
+		if err := decoder.Decode(&item2Vec); err != nil {
+			return nil, err
+		}
+		// restore the length of sequences from hyper-parameters
+		item2Vec.SetParams(item2Vec.Params)
+		return &item2Vec, nil
+	case "fmc":
+		var fmc FMC
+		if err := decoder.Decode(&fmc); err != nil {
+			return nil, err
+		}
+		// restore the length of sequences from hyper-parameters
+		fmc.SetParams(fmc.Params)
+		return &fmc, nil
 	}
 	return nil, fmt.Errorf("unknown model %v", name)
 }
@@ -186,6 +279,8 @@ func DecodeModel(name string, buf []byte) (Model, error) {
 //	 NEpochs	- The number of iteration of the SGD procedure. Default is 100.
 //	 InitMean	- The mean of initial random latent factors. Default is 0.
 //	 InitStdDev	- The standard deviation of initial random latent factors. Default is 0.001.
+//	 HardNegativeRate - The probability of sampling negative items from negative feedback of
+//				  the user if exists. Default is 0.5.
 type BPR struct {
 	BaseMatrixFactorization
 	// Model parameters
@@ -198,6 +293,7 @@ type BPR struct {
 	reg        float32
 	initMean   float32
 	initStdDev float32
+	hardRate   float32
 }
 
 // NewBPR creates a BPR model.
@@ -217,6 +313,7 @@ func (bpr *BPR) SetParams(params model.Params) {
 	bpr.reg = bpr.Params.GetFloat32(model.Reg, 0.01)
 	bpr.initMean = bpr.Params.GetFloat32(model.InitMean, 0)
 	bpr.initStdDev = bpr.Params.GetFloat32(model.InitStdDev, 0.001)
+	bpr.hardRate = bpr.Params.GetFloat32(model.HardNegativeRate, 0.5)
 }
 
 func (bpr *BPR) GetParamsGrid() model.ParamsGrid {
@@ -229,6 +326,16 @@ func (bpr *BPR) GetParamsGrid() model.ParamsGrid {
 	}
 }
 
+func (bpr *BPR) GetParamsSpace() model.ParamsSpace {
+	return model.ParamsSpace{
+		model.NFactors:   model.NewChoices(8, 16, 32, 64),
+		model.Lr:         model.NewLogRange(0.001, 0.1),
+		model.Reg:        model.NewLogRange(0.001, 0.1),
+		model.InitMean:   model.NewChoices(0),
+		model.InitStdDev: model.NewLogRange(0.001, 0.1),
+	}
+}
+
 // Predict by the BPR model.
 func (bpr *BPR) Predict(userId, itemId string) float32 {
 	// Convert sparse Names to dense Names
@@ -289,7 +396,9 @@ func (bpr *BPR) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
 		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
 		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-	snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, bpr.UserFactor, bpr.ItemFactor)
+	score := Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+	snapshots.AddSnapshot(score, bpr.UserFactor, bpr.ItemFactor)
+	config.Curve.AddScore(0, score)
 	// Training
 	for epoch := 1; epoch <= bpr.nEpochs; epoch++ {
 		fitStart := time.Now()
@@ -308,7 +417,14 @@ func (bpr *BPR) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 			posIndex := trainSet.UserFeedback[userIndex][rng[workerId].Intn(ratingCount)]
 			// Select a negative sample
 			negIndex := -1
-			for {
+			if userIndex < len(trainSet.HardNegatives) && len(trainSet.HardNegatives[userIndex]) > 0 &&
+				rng[workerId].Float32() < bpr.hardRate {
+				temp := trainSet.HardNegatives[userIndex][rng[workerId].Intn(len(trainSet.HardNegatives[userIndex]))]
+				if _, exist := userFeedback[userIndex][temp]; !exist {
+					negIndex = temp
+				}
+			}
+			for negIndex == -1 {
 				temp := rng[workerId].Intn(trainSet.ItemCount())
 				if _, exist := userFeedback[userIndex][temp]; !exist {
 					negIndex = temp
@@ -338,6 +454,7 @@ func (bpr *BPR) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 			return nil
 		})
 		fitTime := time.Since(fitStart)
+		config.Curve.AddLoss(epoch, cost)
 		// Cross validation
 		if epoch%config.Verbose == 0 || epoch == bpr.nEpochs {
 			evalStart = time.Now()
@@ -349,7 +466,13 @@ func (bpr *BPR) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
 				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
 				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-			snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, bpr.UserFactor, bpr.ItemFactor)
+			score = Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+			snapshots.AddSnapshot(score, bpr.UserFactor, bpr.ItemFactor)
+			config.Curve.AddScore(epoch, score)
+			if snapshots.EarlyStop(config.Patience) {
+				base.Logger().Info(fmt.Sprintf("early stop bpr at %v/%v", epoch, bpr.nEpochs))
+				break
+			}
 		}
 	}
 	// restore best snapshot
@@ -418,6 +541,7 @@ func (bpr *BPR) Init(trainSet *DataSet) {
 //   InitMean   - The mean of initial latent factors. Default is 0.
 //   InitStdDev - The standard deviation of initial latent factors. Default is 0.1.
 //   Reg        - The strength of regularization.
+//   Alpha      - The weight of unobserved feedback. The confidence of observed feedback is its weight plus Alpha.
 type ALS struct {
 	BaseMatrixFactorization
 	// Model parameters
@@ -460,6 +584,16 @@ func (als *ALS) GetParamsGrid() model.ParamsGrid {
 	}
 }
 
+func (als *ALS) GetParamsSpace() model.ParamsSpace {
+	return model.ParamsSpace{
+		model.NFactors:   model.NewChoices(8, 16, 32, 64),
+		model.InitMean:   model.NewChoices(0),
+		model.InitStdDev: model.NewLogRange(0.001, 0.1),
+		model.Reg:        model.NewLogRange(0.001, 0.1),
+		model.Alpha:      model.NewLogRange(0.001, 0.1),
+	}
+}
+
 // Predict by the ALS model.
 func (als *ALS) Predict(userId, itemId string) float32 {
 	userIndex := als.UserIndex.ToNumber(userId)
@@ -524,7 +658,12 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 	itemFactorCopy := mat.NewDense(trainSet.ItemCount(), als.nFactors, nil)
 	userFactorCopy.Copy(als.UserFactor)
 	itemFactorCopy.Copy(als.ItemFactor)
-	snapshots.AddSnapshotNoCopy(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, userFactorCopy, itemFactorCopy)
+	score := Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+	snapshots.AddSnapshotNoCopy(score, userFactorCopy, itemFactorCopy)
+	if config.Curve != nil {
+		config.Curve.AddLoss(0, als.loss(trainSet))
+	}
+	config.Curve.AddScore(0, score)
 	for ep := 1; ep <= als.nEpochs; ep++ {
 		fitStart := time.Now()
 		// Recompute all user factors: x_u = (Y^T C^userIndex Y + \lambda reg)^{-1} Y^T C^userIndex p(userIndex)
@@ -534,12 +673,13 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 		err := base.Parallel(trainSet.UserCount(), config.Jobs, func(workerId, userIndex int) error {
 			a[workerId].Copy(c)
 			b := mat.NewVecDense(als.nFactors, nil)
-			for _, itemIndex := range trainSet.UserFeedback[userIndex] {
+			for k, itemIndex := range trainSet.UserFeedback[userIndex] {
+				confidence := float64(trainSet.UserFeedbackWeight(userIndex, k))
 				// Y^T (C^u-I) Y
-				temp1[workerId].Outer(1, als.ItemFactor.RowView(itemIndex), als.ItemFactor.RowView(itemIndex))
+				temp1[workerId].Outer(confidence, als.ItemFactor.RowView(itemIndex), als.ItemFactor.RowView(itemIndex))
 				a[workerId].Add(a[workerId], temp1[workerId])
 				// Y^T C^u p(u)
-				temp2[workerId].ScaleVec(1+als.weight, als.ItemFactor.RowView(itemIndex))
+				temp2[workerId].ScaleVec(confidence+als.weight, als.ItemFactor.RowView(itemIndex))
 				b.AddVec(b, temp2[workerId])
 			}
 			a[workerId].Add(a[workerId], regI)
@@ -558,12 +698,13 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 		err = base.Parallel(trainSet.ItemCount(), config.Jobs, func(workerId, itemIndex int) error {
 			a[workerId].Copy(c)
 			b := mat.NewVecDense(als.nFactors, nil)
-			for _, index := range trainSet.ItemFeedback[itemIndex] {
+			for k, index := range trainSet.ItemFeedback[itemIndex] {
+				confidence := float64(trainSet.ItemFeedbackWeight(itemIndex, k))
 				// X^T (C^i-I) X
-				temp1[workerId].Outer(1, als.UserFactor.RowView(index), als.UserFactor.RowView(index))
+				temp1[workerId].Outer(confidence, als.UserFactor.RowView(index), als.UserFactor.RowView(index))
 				a[workerId].Add(a[workerId], temp1[workerId])
 				// X^T C^i p(i)
-				temp2[workerId].ScaleVec(1+als.weight, als.UserFactor.RowView(index))
+				temp2[workerId].ScaleVec(confidence+als.weight, als.UserFactor.RowView(index))
 				b.AddVec(b, temp2[workerId])
 			}
 			a[workerId].Add(a[workerId], regI)
@@ -576,6 +717,9 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 			base.Logger().Error("failed to inverse matrix", zap.Error(err))
 		}
 		fitTime := time.Since(fitStart)
+		if config.Curve != nil {
+			config.Curve.AddLoss(ep, als.loss(trainSet))
+		}
 		// Cross validation
 		if ep%config.Verbose == 0 || ep == als.nEpochs {
 			evalStart = time.Now()
@@ -591,7 +735,13 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 			itemFactorCopy = mat.NewDense(trainSet.ItemCount(), als.nFactors, nil)
 			userFactorCopy.Copy(als.UserFactor)
 			itemFactorCopy.Copy(als.ItemFactor)
-			snapshots.AddSnapshotNoCopy(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, userFactorCopy, itemFactorCopy)
+			score = Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+			snapshots.AddSnapshotNoCopy(score, userFactorCopy, itemFactorCopy)
+			config.Curve.AddScore(ep, score)
+			if snapshots.EarlyStop(config.Patience) {
+				base.Logger().Info(fmt.Sprintf("early stop als at %v/%v", ep, als.nEpochs))
+				break
+			}
 		}
 	}
 	// restore best snapshot
@@ -604,6 +754,30 @@ func (als *ALS) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 	return snapshots.BestScore
 }
 
+// loss returns the weighted squared loss of ALS on the training set. Observed feedback is regressed to 1 with
+// confidence weight + feedback weight and unobserved feedback is regressed to 0 with confidence weight.
+func (als *ALS) loss(trainSet *DataSet) float32 {
+	// squared predictions of all pairs: tr(X^T X Y^T Y)
+	userGram := mat.NewDense(als.nFactors, als.nFactors, nil)
+	userGram.Mul(als.UserFactor.T(), als.UserFactor)
+	itemGram := mat.NewDense(als.nFactors, als.nFactors, nil)
+	itemGram.Mul(als.ItemFactor.T(), als.ItemFactor)
+	userGram.MulElem(userGram, itemGram)
+	loss := als.weight * mat.Sum(userGram)
+	// observed feedback
+	for userIndex, items := range trainSet.UserFeedback {
+		for k, itemIndex := range items {
+			confidence := float64(trainSet.UserFeedbackWeight(userIndex, k))
+			prediction := mat.Dot(als.UserFactor.RowView(userIndex), als.ItemFactor.RowView(itemIndex))
+			loss += (confidence+als.weight)*(1-prediction)*(1-prediction) - als.weight*prediction*prediction
+		}
+	}
+	// regularization
+	userNorm, itemNorm := mat.Norm(als.UserFactor, 2), mat.Norm(als.ItemFactor, 2)
+	loss += als.reg * (userNorm*userNorm + itemNorm*itemNorm)
+	return float32(loss)
+}
+
 func (als *ALS) Clear() {
 	als.UserIndex = nil
 	als.ItemIndex = nil
@@ -692,6 +866,16 @@ func (ccd *CCD) GetParamsGrid() model.ParamsGrid {
 	}
 }
 
+func (ccd *CCD) GetParamsSpace() model.ParamsSpace {
+	return model.ParamsSpace{
+		model.NFactors:   model.NewChoices(8, 16, 32, 64),
+		model.InitMean:   model.NewChoices(0),
+		model.InitStdDev: model.NewLogRange(0.001, 0.1),
+		model.Reg:        model.NewLogRange(0.001, 0.1),
+		model.Alpha:      model.NewLogRange(0.001, 0.1),
+	}
+}
+
 // Predict by the ALS model.
 func (ccd *CCD) Predict(userId, itemId string) float32 {
 	userIndex := ccd.UserIndex.ToNumber(userId)
@@ -791,7 +975,12 @@ func (ccd *CCD) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
 		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
 		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-	snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, ccd.UserFactor, ccd.ItemFactor)
+	score := Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+	snapshots.AddSnapshot(score, ccd.UserFactor, ccd.ItemFactor)
+	if config.Curve != nil {
+		config.Curve.AddLoss(0, ccd.loss(trainSet))
+	}
+	config.Curve.AddScore(0, score)
 	for ep := 1; ep <= ccd.nEpochs; ep++ {
 		fitStart := time.Now()
 		// Update user factors
@@ -873,6 +1062,9 @@ func (ccd *CCD) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 			return nil
 		})
 		fitTime := time.Since(fitStart)
+		if config.Curve != nil {
+			config.Curve.AddLoss(ep, ccd.loss(trainSet))
+		}
 		// Cross validation
 		if ep%config.Verbose == 0 || ep == ccd.nEpochs {
 			evalStart = time.Now()
@@ -884,7 +1076,13 @@ func (ccd *CCD) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
 				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
 				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-			snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, ccd.UserFactor, ccd.ItemFactor)
+			score = Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+			snapshots.AddSnapshot(score, ccd.UserFactor, ccd.ItemFactor)
+			config.Curve.AddScore(ep, score)
+			if snapshots.EarlyStop(config.Patience) {
+				base.Logger().Info(fmt.Sprintf("early stop ccd at %v/%v", ep, ccd.nEpochs))
+				break
+			}
 		}
 	}
 	// restore best snapshot
@@ -896,3 +1094,40 @@ func (ccd *CCD) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
 		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
 	return snapshots.BestScore
 }
+
+// loss returns the weighted squared loss of CCD on the training set. Observed feedback is regressed to 1 with
+// confidence 1 and unobserved feedback is regressed to 0 with confidence weight.
+func (ccd *CCD) loss(trainSet *DataSet) float32 {
+	// squared predictions of all pairs: tr(P^T P Q^T Q)
+	userGram := base.NewMatrix32(ccd.nFactors, ccd.nFactors)
+	itemGram := base.NewMatrix32(ccd.nFactors, ccd.nFactors)
+	for _, factor := range ccd.UserFactor {
+		for i := range userGram {
+			floats.MulConstAddTo(factor, factor[i], userGram[i])
+		}
+	}
+	for _, factor := range ccd.ItemFactor {
+		for i := range itemGram {
+			floats.MulConstAddTo(factor, factor[i], itemGram[i])
+		}
+	}
+	var loss float32
+	for i := range userGram {
+		loss += ccd.weight * floats.Dot(userGram[i], itemGram[i])
+	}
+	// observed feedback
+	for userIndex, items := range trainSet.UserFeedback {
+		for _, itemIndex := range items {
+			prediction := ccd.InternalPredict(userIndex, itemIndex)
+			loss += (1-prediction)*(1-prediction) - ccd.weight*prediction*prediction
+		}
+	}
+	// regularization
+	for _, factor := range ccd.UserFactor {
+		loss += ccd.reg * floats.Dot(factor, factor)
+	}
+	for _, factor := range ccd.ItemFactor {
+		loss += ccd.reg * floats.Dot(factor, factor)
+	}
+	return loss
+}
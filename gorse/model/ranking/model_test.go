@@ -40,6 +40,73 @@ func assertEpsilon(t *testing.T, expect, actual, eps float32) {
 	}
 }
 
+// bruteForceLoss computes the weighted squared loss of implicit feedback over all pairs of users and items.
+func bruteForceLoss(trainSet *DataSet, m MatrixFactorization, observedWeight, unobservedWeight, reg float64,
+	userFactor, itemFactor func(int) []float32) float32 {
+	var loss float64
+	for userIndex := 0; userIndex < trainSet.UserCount(); userIndex++ {
+		observed := make(map[int]float64)
+		for k, itemIndex := range trainSet.UserFeedback[userIndex] {
+			observed[itemIndex] = observedWeight * float64(trainSet.UserFeedbackWeight(userIndex, k))
+		}
+		for itemIndex := 0; itemIndex < trainSet.ItemCount(); itemIndex++ {
+			prediction := float64(m.InternalPredict(userIndex, itemIndex))
+			if confidence, exist := observed[itemIndex]; exist {
+				loss += confidence * (1 - prediction) * (1 - prediction)
+			} else {
+				loss += unobservedWeight * prediction * prediction
+			}
+		}
+	}
+	for userIndex := 0; userIndex < trainSet.UserCount(); userIndex++ {
+		for _, x := range userFactor(userIndex) {
+			loss += reg * float64(x) * float64(x)
+		}
+	}
+	for itemIndex := 0; itemIndex < trainSet.ItemCount(); itemIndex++ {
+		for _, x := range itemFactor(itemIndex) {
+			loss += reg * float64(x) * float64(x)
+		}
+	}
+	return float32(loss)
+}
+
+func TestALS_Loss(t *testing.T) {
+	trainSet, testSet := newClusteredDataset(2, 10, 10).Split(0, 0)
+	m := NewALS(model.Params{model.NFactors: 4, model.NEpochs: 5, model.Reg: 0.01, model.Alpha: 0.05})
+	config := &FitConfig{Jobs: 2, Candidates: 10, TopK: 10, Verbose: 2, Curve: &LearningCurve{}}
+	m.Fit(trainSet, testSet, config)
+	// losses are recorded every epoch
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, config.Curve.Epochs)
+	assert.Equal(t, []int{0, 2, 4, 5}, config.Curve.EvalEpochs)
+	// loss never increases in alternating least squares
+	for i := 1; i < len(config.Curve.Losses); i++ {
+		assert.LessOrEqual(t, config.Curve.Losses[i], config.Curve.Losses[i-1]*(1+1e-4))
+	}
+	expected := bruteForceLoss(trainSet, m, 1+m.weight, m.weight, m.reg,
+		func(userIndex int) []float32 { return m.GetUserFactor(userIndex) },
+		func(itemIndex int) []float32 { return m.GetItemFactor(itemIndex) })
+	assert.InDelta(t, expected, m.loss(trainSet), float64(expected)*1e-4)
+}
+
+func TestCCD_Loss(t *testing.T) {
+	trainSet, testSet := newClusteredDataset(2, 10, 10).Split(0, 0)
+	m := NewCCD(model.Params{model.NFactors: 4, model.NEpochs: 5, model.Reg: 0.01, model.Alpha: 0.05})
+	config := &FitConfig{Jobs: 2, Candidates: 10, TopK: 10, Verbose: 2, Curve: &LearningCurve{}}
+	m.Fit(trainSet, testSet, config)
+	// losses are recorded every epoch
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, config.Curve.Epochs)
+	assert.Equal(t, []int{0, 2, 4, 5}, config.Curve.EvalEpochs)
+	// loss never increases in coordinate descent
+	for i := 1; i < len(config.Curve.Losses); i++ {
+		assert.LessOrEqual(t, config.Curve.Losses[i], config.Curve.Losses[i-1]*(1+1e-4))
+	}
+	expected := bruteForceLoss(trainSet, m, 1, float64(m.weight), float64(m.reg),
+		func(userIndex int) []float32 { return m.UserFactor[userIndex] },
+		func(itemIndex int) []float32 { return m.ItemFactor[itemIndex] })
+	assert.InDelta(t, expected, m.loss(trainSet), float64(expected)*1e-4)
+}
+
 // He, Xiangnan, et al. "Neural collaborative filtering." Proceedings
 // of the 26th international conference on world wide web. 2017.
 
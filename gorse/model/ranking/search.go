@@ -51,6 +51,24 @@ func (r *ParamsSearchResult) AddScore(params model.Params, score Score) {
 	}
 }
 
+// evaluate fits the estimator with parameters and records the score. The estimator is cloned as the best model if
+// the score is the best so far.
+func (r *ParamsSearchResult) evaluate(estimator Model, trainSet, testSet *DataSet, params model.Params,
+	fitConfig *FitConfig) Score {
+	estimator.Clear()
+	estimator.SetParams(estimator.GetParams().Overwrite(params))
+	score := estimator.Fit(trainSet, testSet, fitConfig)
+	r.Scores = append(r.Scores, score)
+	r.Params = append(r.Params, params.Copy())
+	if score.NDCG > r.BestScore.NDCG {
+		r.BestModel = Clone(estimator)
+		r.BestScore = score
+		r.BestParams = params.Copy()
+		r.BestIndex = len(r.Params) - 1
+	}
+	return score
+}
+
 // GridSearchCV finds the best parameters for a model.
 func GridSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramGrid model.ParamsGrid,
 	seed int64, fitConfig *FitConfig) ParamsSearchResult {
@@ -74,18 +92,7 @@ func GridSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramGri
 			base.Logger().Info(fmt.Sprintf("grid search (%v/%v)", progress, count),
 				zap.Any("params", params))
 			// Cross validate
-			estimator.Clear()
-			estimator.SetParams(estimator.GetParams().Overwrite(params))
-			score := estimator.Fit(trainSet, testSet, fitConfig)
-			// Create GridSearch result
-			results.Scores = append(results.Scores, score)
-			results.Params = append(results.Params, params.Copy())
-			if len(results.Scores) == 0 || score.NDCG > results.BestScore.NDCG {
-				results.BestModel = Clone(estimator)
-				results.BestScore = score
-				results.BestParams = params.Copy()
-				results.BestIndex = len(results.Params) - 1
-			}
+			results.evaluate(estimator, trainSet, testSet, params, fitConfig)
 		} else {
 			paramName := paramNames[deep]
 			values := paramGrid[paramName]
@@ -122,27 +129,50 @@ func RandomSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramG
 		// Cross validate
 		base.Logger().Info(fmt.Sprintf("random search (%v/%v)", i, numTrials),
 			zap.Any("params", params))
-		estimator.Clear()
-		estimator.SetParams(estimator.GetParams().Overwrite(params))
-		score := estimator.Fit(trainSet, testSet, fitConfig)
-		results.Scores = append(results.Scores, score)
-		results.Params = append(results.Params, params.Copy())
-		if len(results.Scores) == 0 || score.NDCG > results.BestScore.NDCG {
-			results.BestModel = Clone(estimator)
-			results.BestScore = score
-			results.BestParams = params.Copy()
-			results.BestIndex = len(results.Params) - 1
-		}
+		results.evaluate(estimator, trainSet, testSet, params, fitConfig)
+	}
+	return results
+}
+
+// TPESearchCV searches hyper-parameters by the tree-structured Parzen estimator. Hyper-parameters of each
+// trial are suggested by scores of previous trials.
+func TPESearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramSpace model.ParamsSpace,
+	numTrials int, seed int64, fitConfig *FitConfig) ParamsSearchResult {
+	// if the number of combination is less than number of trials, use grid search
+	if paramGrid, ok := paramSpace.ToGrid(); ok && paramGrid.NumCombinations() < numTrials {
+		return GridSearchCV(estimator, trainSet, testSet, paramGrid, seed, fitConfig)
+	}
+	tpe := model.NewTPE(paramSpace, seed)
+	results := ParamsSearchResult{
+		Scores: make([]Score, 0, numTrials),
+		Params: make([]model.Params, 0, numTrials),
+	}
+	for i := 1; i <= numTrials; i++ {
+		params := tpe.Suggest()
+		// Cross validate
+		base.Logger().Info(fmt.Sprintf("tpe search (%v/%v)", i, numTrials),
+			zap.Any("params", params))
+		score := results.evaluate(estimator, trainSet, testSet, params, fitConfig)
+		tpe.Observe(params, float64(score.NDCG))
 	}
 	return results
 }
 
+// slimSearchEpochs is the max number of sweeps of coordinate descent to search SLIM. Each sweep updates weights of
+// all pairs of co-occurred items, which is much slower than an epoch of other models.
+const slimSearchEpochs = 10
+
 // ModelSearcher is a thread-safe personal ranking model searcher.
 type ModelSearcher struct {
 	// arguments
 	numEpochs int
 	numTrials int
 	numJobs   int
+	patience  int
+	// max number of items to search EASE and SLIM
+	easeMaxItems int
+	slimMaxItems int
+	useTPE       bool
 	// results
 	bestMutex      sync.Mutex
 	bestModelName  string
@@ -152,11 +182,17 @@ type ModelSearcher struct {
 }
 
 // NewModelSearcher creates a thread-safe personal ranking model searcher.
-func NewModelSearcher(nEpoch, nTrials, nJobs int) *ModelSearcher {
+// Hyper-parameters are searched by the tree-structured Parzen estimator if useTPE is true, otherwise by random.
+// EASE is searched only if the number of items is no more than easeMaxItems, so is SLIM with slimMaxItems.
+func NewModelSearcher(nEpoch, nTrials, nJobs, patience, easeMaxItems, slimMaxItems int, useTPE bool) *ModelSearcher {
 	return &ModelSearcher{
 		numTrials:      nTrials,
 		numEpochs:      nEpoch,
 		numJobs:        nJobs,
+		patience:       patience,
+		easeMaxItems:   easeMaxItems,
+		slimMaxItems:   slimMaxItems,
+		useTPE:         useTPE,
 		bestSimilarity: model.SimilarityCosine,
 	}
 }
@@ -180,14 +216,39 @@ func (searcher *ModelSearcher) Fit(trainSet, valSet *DataSet) error {
 		zap.Int("n_users", trainSet.UserCount()),
 		zap.Int("n_items", trainSet.ItemCount()))
 	startTime := time.Now()
-	models := []string{"bpr", "ccd", "knn"}
+	models := []string{"bpr", "ccd", "knn", "ease", "slim", "item2vec", "fmc"}
 	for _, name := range models {
-		m, err := NewModel(name, model.Params{model.NEpochs: searcher.numEpochs})
+		params := model.Params{model.NEpochs: searcher.numEpochs}
+		if name == "ease" {
+			if trainSet.ItemCount() > searcher.easeMaxItems {
+				base.Logger().Info("skip ease for too many items",
+					zap.Int("n_items", trainSet.ItemCount()),
+					zap.Int("max_items", searcher.easeMaxItems))
+				continue
+			}
+			params[model.MaxItems] = searcher.easeMaxItems
+		} else if name == "slim" {
+			if trainSet.ItemCount() > searcher.slimMaxItems {
+				base.Logger().Info("skip slim for too many items",
+					zap.Int("n_items", trainSet.ItemCount()),
+					zap.Int("max_items", searcher.slimMaxItems))
+				continue
+			}
+			if searcher.numEpochs > slimSearchEpochs {
+				params[model.NEpochs] = slimSearchEpochs
+			}
+		}
+		m, err := NewModel(name, params)
 		if err != nil {
 			return err
 		}
-		r := RandomSearchCV(m, trainSet, valSet, m.GetParamsGrid(), searcher.numTrials, 0,
-			NewFitConfig().SetJobs(searcher.numJobs))
+		fitConfig := NewFitConfig().SetJobs(searcher.numJobs).SetPatience(searcher.patience)
+		var r ParamsSearchResult
+		if searcher.useTPE {
+			r = TPESearchCV(m, trainSet, valSet, model.GetParamsSpace(m), searcher.numTrials, 0, fitConfig)
+		} else {
+			r = RandomSearchCV(m, trainSet, valSet, m.GetParamsGrid(), searcher.numTrials, 0, fitConfig)
+		}
 		searcher.bestMutex.Lock()
 		if name == "knn" {
 			searcher.bestSimilarity = r.BestModel.GetParams()[model.Similarity].(string)
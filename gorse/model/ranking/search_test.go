@@ -87,3 +87,21 @@ func TestRandomSearchCV(t *testing.T) {
 		model.InitStdDev: 4,
 	}, r.BestParams)
 }
+
+func TestTPESearchCV(t *testing.T) {
+	m := &mockMatrixFactorizationForSearch{}
+	space := model.ParamsSpace{
+		model.NFactors:   model.NewIntRange(1, 4),
+		model.InitMean:   model.NewUniformRange(1, 4),
+		model.InitStdDev: model.NewChoices(4),
+	}
+	r := TPESearchCV(m, nil, nil, space, 30, 0, nil)
+	assert.Equal(t, 30, len(r.Scores))
+	assert.Greater(t, r.BestScore.NDCG, float32(11))
+	assert.Equal(t, r.Params[r.BestIndex], r.BestParams)
+	assert.Equal(t, 4, r.BestParams[model.NFactors])
+	// use grid search if the number of combination is less than number of trials
+	r = TPESearchCV(m, nil, nil, model.GetParamsSpace(m), 100, 0, nil)
+	assert.Equal(t, 64, len(r.Scores))
+	assert.Equal(t, float32(12), r.BestScore.NDCG)
+}
@@ -0,0 +1,439 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ranking
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chewxy/math32"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/floats"
+	"github.com/zhenghaoz/gorse/model"
+	"go.uber.org/zap"
+)
+
+// item2VecNegatives is the number of negative samples for each positive pair in item2vec.
+const item2VecNegatives = 5
+
+// countTransitions counts transitions between adjacent items in sequences of users.
+func countTransitions(trainSet *DataSet) int {
+	count := 0
+	for userIndex := 0; userIndex < trainSet.UserCount(); userIndex++ {
+		if n := len(trainSet.UserSequence(userIndex)); n > 1 {
+			count += n - 1
+		}
+	}
+	return count
+}
+
+// Item2Vec learns embeddings of items from sequences of users by skip-gram with negative sampling [1]. Items
+// within a context window of each other in a sequence are positive pairs. The score of an item j given recent
+// items of a user is estimated by:
+//
+//   \hat{x}_j = \frac{1}{|L|} \sum_{l \in L} v_l^T c_j
+//
+// where L is the set of the most recent items, v_l is the input embedding of item l and c_j is the output
+// embedding of item j.
+//
+// Hyper-parameters:
+//	 Lr 		- The learning rate of SGD. Default is 0.05.
+//	 NFactors	- The number of dimensions of embeddings. Default is 10.
+//	 NEpochs	- The number of iteration of the SGD procedure. Default is 100.
+//	 InitMean	- The mean of initial random embeddings. Default is 0.
+//	 InitStdDev	- The standard deviation of initial random embeddings. Default is 0.01.
+//	 Window		- The size of context window, which is also the number of recent items. Default is 5.
+//
+// [1] Barkan, Oren, and Noam Koenigstein. "Item2vec: neural item embedding for collaborative filtering." 2016
+// IEEE 26th International Workshop on Machine Learning for Signal Processing (MLSP). IEEE, 2016.
+type Item2Vec struct {
+	model.BaseModel
+	ItemIndex    base.Index
+	InputFactor  [][]float32 // v_i
+	OutputFactor [][]float32 // c_i
+	nFactors     int
+	nEpochs      int
+	lr           float32
+	initMean     float32
+	initStdDev   float32
+	window       int
+}
+
+// NewItem2Vec creates a item2vec model.
+func NewItem2Vec(params model.Params) *Item2Vec {
+	item2Vec := new(Item2Vec)
+	item2Vec.SetParams(params)
+	return item2Vec
+}
+
+func (item2Vec *Item2Vec) SetParams(params model.Params) {
+	item2Vec.BaseModel.SetParams(params)
+	item2Vec.nFactors = item2Vec.Params.GetInt(model.NFactors, 10)
+	item2Vec.nEpochs = item2Vec.Params.GetInt(model.NEpochs, 100)
+	item2Vec.lr = item2Vec.Params.GetFloat32(model.Lr, 0.05)
+	item2Vec.initMean = item2Vec.Params.GetFloat32(model.InitMean, 0)
+	item2Vec.initStdDev = item2Vec.Params.GetFloat32(model.InitStdDev, 0.01)
+	item2Vec.window = item2Vec.Params.GetInt(model.Window, 5)
+}
+
+func (item2Vec *Item2Vec) GetParamsGrid() model.ParamsGrid {
+	return model.ParamsGrid{
+		model.NFactors:   []interface{}{8, 16, 32, 64},
+		model.Lr:         []interface{}{0.005, 0.01, 0.05, 0.1},
+		model.InitMean:   []interface{}{0},
+		model.InitStdDev: []interface{}{0.001, 0.01, 0.1},
+		model.Window:     []interface{}{1, 3, 5, 10},
+	}
+}
+
+func (item2Vec *Item2Vec) Clear() {
+	item2Vec.ItemIndex = nil
+	item2Vec.InputFactor = nil
+	item2Vec.OutputFactor = nil
+}
+
+func (item2Vec *Item2Vec) Invalid() bool {
+	return item2Vec == nil ||
+		item2Vec.ItemIndex == nil ||
+		item2Vec.InputFactor == nil ||
+		item2Vec.OutputFactor == nil
+}
+
+func (item2Vec *Item2Vec) GetItemIndex() base.Index {
+	return item2Vec.ItemIndex
+}
+
+func (item2Vec *Item2Vec) SequenceLength() int {
+	return item2Vec.window
+}
+
+func (item2Vec *Item2Vec) Predict(userProfile []string, itemId string) float32 {
+	return predictItemBased(item2Vec, item2Vec.ItemIndex, userProfile, itemId)
+}
+
+func (item2Vec *Item2Vec) InternalPredict(userProfile []int, itemIndex int) float32 {
+	if len(userProfile) == 0 {
+		return 0
+	}
+	sum := float32(0)
+	for _, supportIndex := range userProfile {
+		sum += floats.Dot(item2Vec.InputFactor[supportIndex], item2Vec.OutputFactor[itemIndex])
+	}
+	return sum / float32(len(userProfile))
+}
+
+func (item2Vec *Item2Vec) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
+	config = config.LoadDefaultIfNil()
+	base.Logger().Info("fit item2vec",
+		zap.Int("train_set_size", trainSet.Count()),
+		zap.Int("test_set_size", valSet.Count()),
+		zap.Any("params", item2Vec.GetParams()),
+		zap.Any("config", config))
+	item2Vec.ItemIndex = trainSet.ItemIndex
+	item2Vec.InputFactor = item2Vec.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), item2Vec.nFactors, item2Vec.initMean, item2Vec.initStdDev)
+	item2Vec.OutputFactor = item2Vec.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), item2Vec.nFactors, item2Vec.initMean, item2Vec.initStdDev)
+	// Create buffers
+	temp := base.NewMatrix32(config.Jobs, item2Vec.nFactors)
+	rng := make([]base.RandomGenerator, config.Jobs)
+	for i := 0; i < config.Jobs; i++ {
+		rng[i] = base.NewRandomGenerator(item2Vec.GetRandomGenerator().Int63())
+	}
+	var cost float32
+	// update updates embeddings of a pair and accumulates the gradient of the input embedding into temp.
+	update := func(workerId, inputIndex, outputIndex int, label float32) {
+		score := floats.Dot(item2Vec.InputFactor[inputIndex], item2Vec.OutputFactor[outputIndex])
+		if label > 0 {
+			cost += math32.Log(1 + math32.Exp(-score))
+		} else {
+			cost += math32.Log(1 + math32.Exp(score))
+		}
+		grad := item2Vec.lr * (label - 1/(1+math32.Exp(-score)))
+		floats.MulConstAddTo(item2Vec.OutputFactor[outputIndex], grad, temp[workerId])
+		floats.MulConstAddTo(item2Vec.InputFactor[inputIndex], grad, item2Vec.OutputFactor[outputIndex])
+	}
+	snapshots := SnapshotManger{}
+	for epoch := 1; epoch <= item2Vec.nEpochs; epoch++ {
+		fitStart := time.Now()
+		cost = 0
+		_ = base.Parallel(trainSet.UserCount(), config.Jobs, func(workerId, userIndex int) error {
+			sequence := trainSet.UserSequence(userIndex)
+			for t, inputIndex := range sequence {
+				for c := base.Max(0, t-item2Vec.window); c < len(sequence) && c <= t+item2Vec.window; c++ {
+					if c == t || sequence[c] == inputIndex {
+						continue
+					}
+					floats.Zero(temp[workerId])
+					// Update the positive pair
+					update(workerId, inputIndex, sequence[c], 1)
+					// Update negative pairs
+					for n := 0; n < item2VecNegatives; n++ {
+						if negIndex := rng[workerId].Intn(trainSet.ItemCount()); negIndex != sequence[c] {
+							update(workerId, inputIndex, negIndex, 0)
+						}
+					}
+					floats.Add(item2Vec.InputFactor[inputIndex], temp[workerId])
+				}
+			}
+			return nil
+		})
+		fitTime := time.Since(fitStart)
+		config.Curve.AddLoss(epoch, cost)
+		// Cross validation
+		if epoch%config.Verbose == 0 || epoch == item2Vec.nEpochs {
+			evalStart := time.Now()
+			scores := Evaluate(item2Vec, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+			evalTime := time.Since(evalStart)
+			base.Logger().Debug(fmt.Sprintf("fit item2vec %v/%v", epoch, item2Vec.nEpochs),
+				zap.String("fit_time", fitTime.String()),
+				zap.String("eval_time", evalTime.String()),
+				zap.Float32("loss", cost),
+				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
+				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
+				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
+			score := Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+			snapshots.AddSnapshot(score, item2Vec.InputFactor, item2Vec.OutputFactor)
+			config.Curve.AddScore(epoch, score)
+			if snapshots.EarlyStop(config.Patience) {
+				base.Logger().Info(fmt.Sprintf("early stop item2vec at %v/%v", epoch, item2Vec.nEpochs))
+				break
+			}
+		}
+	}
+	// restore best snapshot
+	if snapshots.BestWeights != nil {
+		item2Vec.InputFactor = snapshots.BestWeights[0].([][]float32)
+		item2Vec.OutputFactor = snapshots.BestWeights[1].([][]float32)
+	}
+	base.Logger().Info("fit item2vec complete",
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), snapshots.BestScore.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), snapshots.BestScore.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
+	return snapshots.BestScore
+}
+
+// FMC is the factorized Markov chain, which is the Markov chain part of FPMC [1]. The transition from recent
+// items of a user to the next item j is estimated by:
+//
+//   \hat{x}_j = \frac{1}{|L|} \sum_{l \in L} v_j^T w_l
+//
+// where L is the set of the most recent items, v_j is the factor of item j as a next item and w_l is the factor
+// of item l as a previous item. Factors are learned by S-BPR on transitions in sequences of users.
+//
+// Hyper-parameters:
+//	 Reg 		- The regularization parameter of the cost function that is
+// 				  optimized. Default is 0.01.
+//	 Lr 		- The learning rate of SGD. Default is 0.05.
+//	 NFactors	- The number of latent factors. Default is 10.
+//	 NEpochs	- The number of iteration of the SGD procedure. Default is 100.
+//	 InitMean	- The mean of initial random latent factors. Default is 0.
+//	 InitStdDev	- The standard deviation of initial random latent factors. Default is 0.01.
+//	 Window		- The number of recent items. Default is 1.
+//
+// [1] Rendle, Steffen, Christoph Freudenthaler, and Lars Schmidt-Thieme. "Factorizing personalized markov chains
+// for next-basket recommendation." Proceedings of the 19th international conference on World wide web. 2010.
+type FMC struct {
+	model.BaseModel
+	ItemIndex  base.Index
+	NextFactor [][]float32 // v_j
+	PrevFactor [][]float32 // w_l
+	nFactors   int
+	nEpochs    int
+	lr         float32
+	reg        float32
+	initMean   float32
+	initStdDev float32
+	window     int
+}
+
+// NewFMC creates a FMC model.
+func NewFMC(params model.Params) *FMC {
+	fmc := new(FMC)
+	fmc.SetParams(params)
+	return fmc
+}
+
+func (fmc *FMC) SetParams(params model.Params) {
+	fmc.BaseModel.SetParams(params)
+	fmc.nFactors = fmc.Params.GetInt(model.NFactors, 10)
+	fmc.nEpochs = fmc.Params.GetInt(model.NEpochs, 100)
+	fmc.lr = fmc.Params.GetFloat32(model.Lr, 0.05)
+	fmc.reg = fmc.Params.GetFloat32(model.Reg, 0.01)
+	fmc.initMean = fmc.Params.GetFloat32(model.InitMean, 0)
+	fmc.initStdDev = fmc.Params.GetFloat32(model.InitStdDev, 0.01)
+	fmc.window = fmc.Params.GetInt(model.Window, 1)
+}
+
+func (fmc *FMC) GetParamsGrid() model.ParamsGrid {
+	return model.ParamsGrid{
+		model.NFactors:   []interface{}{8, 16, 32, 64},
+		model.Lr:         []interface{}{0.005, 0.01, 0.05, 0.1},
+		model.Reg:        []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.InitMean:   []interface{}{0},
+		model.InitStdDev: []interface{}{0.001, 0.01, 0.1},
+		model.Window:     []interface{}{1, 3, 5},
+	}
+}
+
+func (fmc *FMC) Clear() {
+	fmc.ItemIndex = nil
+	fmc.NextFactor = nil
+	fmc.PrevFactor = nil
+}
+
+func (fmc *FMC) Invalid() bool {
+	return fmc == nil ||
+		fmc.ItemIndex == nil ||
+		fmc.NextFactor == nil ||
+		fmc.PrevFactor == nil
+}
+
+func (fmc *FMC) GetItemIndex() base.Index {
+	return fmc.ItemIndex
+}
+
+func (fmc *FMC) SequenceLength() int {
+	return fmc.window
+}
+
+func (fmc *FMC) Predict(userProfile []string, itemId string) float32 {
+	return predictItemBased(fmc, fmc.ItemIndex, userProfile, itemId)
+}
+
+func (fmc *FMC) InternalPredict(userProfile []int, itemIndex int) float32 {
+	if len(userProfile) == 0 {
+		return 0
+	}
+	sum := float32(0)
+	for _, supportIndex := range userProfile {
+		sum += floats.Dot(fmc.NextFactor[itemIndex], fmc.PrevFactor[supportIndex])
+	}
+	return sum / float32(len(userProfile))
+}
+
+func (fmc *FMC) Fit(trainSet, valSet *DataSet, config *FitConfig) Score {
+	config = config.LoadDefaultIfNil()
+	base.Logger().Info("fit fmc",
+		zap.Int("train_set_size", trainSet.Count()),
+		zap.Int("test_set_size", valSet.Count()),
+		zap.Any("params", fmc.GetParams()),
+		zap.Any("config", config))
+	fmc.ItemIndex = trainSet.ItemIndex
+	fmc.NextFactor = fmc.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), fmc.nFactors, fmc.initMean, fmc.initStdDev)
+	fmc.PrevFactor = fmc.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), fmc.nFactors, fmc.initMean, fmc.initStdDev)
+	// Create buffers
+	temp := base.NewMatrix32(config.Jobs, fmc.nFactors)
+	prevFactor := base.NewMatrix32(config.Jobs, fmc.nFactors)
+	positiveItemFactor := base.NewMatrix32(config.Jobs, fmc.nFactors)
+	negativeItemFactor := base.NewMatrix32(config.Jobs, fmc.nFactors)
+	rng := make([]base.RandomGenerator, config.Jobs)
+	for i := 0; i < config.Jobs; i++ {
+		rng[i] = base.NewRandomGenerator(fmc.GetRandomGenerator().Int63())
+	}
+	// Convert array to hashmap
+	userFeedback := make([]map[int]interface{}, trainSet.UserCount())
+	for u := range userFeedback {
+		userFeedback[u] = make(map[int]interface{})
+		for _, i := range trainSet.UserFeedback[u] {
+			userFeedback[u][i] = nil
+		}
+	}
+	numTransitions := countTransitions(trainSet)
+	snapshots := SnapshotManger{}
+	for epoch := 1; epoch <= fmc.nEpochs && numTransitions > 0; epoch++ {
+		fitStart := time.Now()
+		cost := float32(0)
+		_ = base.Parallel(numTransitions, config.Jobs, func(workerId, _ int) error {
+			// Select a transition
+			var userIndex int
+			var sequence []int
+			for {
+				userIndex = rng[workerId].Intn(trainSet.UserCount())
+				sequence = trainSet.UserSequence(userIndex)
+				if len(sequence) > 1 {
+					break
+				}
+			}
+			t := 1 + rng[workerId].Intn(len(sequence)-1)
+			posIndex := sequence[t]
+			recentItems := RecentItems(sequence[:t], fmc.window)
+			// Select a negative sample
+			negIndex := -1
+			for negIndex == -1 {
+				temp := rng[workerId].Intn(trainSet.ItemCount())
+				if _, exist := userFeedback[userIndex][temp]; !exist {
+					negIndex = temp
+				}
+			}
+			diff := fmc.InternalPredict(recentItems, posIndex) - fmc.InternalPredict(recentItems, negIndex)
+			grad := math32.Exp(-diff) / (1.0 + math32.Exp(-diff))
+			cost += math32.Log(1 + math32.Exp(-diff))
+			// Pairwise update
+			floats.Zero(prevFactor[workerId])
+			for _, l := range recentItems {
+				floats.MulConstAddTo(fmc.PrevFactor[l], 1/float32(len(recentItems)), prevFactor[workerId])
+			}
+			copy(positiveItemFactor[workerId], fmc.NextFactor[posIndex])
+			copy(negativeItemFactor[workerId], fmc.NextFactor[negIndex])
+			// Update positive item factor: +w_L
+			floats.MulConstTo(prevFactor[workerId], grad, temp[workerId])
+			floats.MulConstAddTo(positiveItemFactor[workerId], -fmc.reg, temp[workerId])
+			floats.MulConstAddTo(temp[workerId], fmc.lr, fmc.NextFactor[posIndex])
+			// Update negative item factor: -w_L
+			floats.MulConstTo(prevFactor[workerId], -grad, temp[workerId])
+			floats.MulConstAddTo(negativeItemFactor[workerId], -fmc.reg, temp[workerId])
+			floats.MulConstAddTo(temp[workerId], fmc.lr, fmc.NextFactor[negIndex])
+			// Update factors of recent items: (v_i-v_j)/|L|
+			floats.SubTo(positiveItemFactor[workerId], negativeItemFactor[workerId], temp[workerId])
+			floats.MulConst(temp[workerId], grad/float32(len(recentItems)))
+			for _, l := range recentItems {
+				floats.MulConst(fmc.PrevFactor[l], 1-fmc.lr*fmc.reg)
+				floats.MulConstAddTo(temp[workerId], fmc.lr, fmc.PrevFactor[l])
+			}
+			return nil
+		})
+		fitTime := time.Since(fitStart)
+		config.Curve.AddLoss(epoch, cost)
+		// Cross validation
+		if epoch%config.Verbose == 0 || epoch == fmc.nEpochs {
+			evalStart := time.Now()
+			scores := Evaluate(fmc, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+			evalTime := time.Since(evalStart)
+			base.Logger().Debug(fmt.Sprintf("fit fmc %v/%v", epoch, fmc.nEpochs),
+				zap.String("fit_time", fitTime.String()),
+				zap.String("eval_time", evalTime.String()),
+				zap.Float32("loss", cost),
+				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
+				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
+				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
+			score := Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+			snapshots.AddSnapshot(score, fmc.NextFactor, fmc.PrevFactor)
+			config.Curve.AddScore(epoch, score)
+			if snapshots.EarlyStop(config.Patience) {
+				base.Logger().Info(fmt.Sprintf("early stop fmc at %v/%v", epoch, fmc.nEpochs))
+				break
+			}
+		}
+	}
+	// restore best snapshot
+	if snapshots.BestWeights != nil {
+		fmc.NextFactor = snapshots.BestWeights[0].([][]float32)
+		fmc.PrevFactor = snapshots.BestWeights[1].([][]float32)
+	}
+	base.Logger().Info("fit fmc complete",
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), snapshots.BestScore.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), snapshots.BestScore.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
+	return snapshots.BestScore
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ranking
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/storage/data"
+)
+
+// newSequentialDataset creates a dataset where users walk through items of a cluster in a cycle.
+func newSequentialDataset(numClusters, numItemsPerCluster, numUsersPerCluster, length int) *DataSet {
+	dataset := NewMapIndexDataset()
+	feedback := make([]data.Feedback, 0)
+	rng := base.NewRandomGenerator(0)
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for c := 0; c < numClusters; c++ {
+		for u := 0; u < numUsersPerCluster; u++ {
+			userId := strconv.Itoa(c*numUsersPerCluster + u)
+			start := rng.Intn(numItemsPerCluster)
+			for i := 0; i < length; i++ {
+				itemId := strconv.Itoa(c*numItemsPerCluster + (start+i)%numItemsPerCluster)
+				dataset.AddFeedback(userId, itemId, true)
+				// insert feedback in reversed order
+				feedback = append([]data.Feedback{{
+					FeedbackKey: data.FeedbackKey{UserId: userId, ItemId: itemId},
+					Timestamp:   timestamp.Add(time.Duration(i) * time.Hour),
+				}}, feedback...)
+			}
+		}
+	}
+	dataset.SetSequences(feedback)
+	return dataset
+}
+
+func testSequentialModel(t *testing.T, name string, m SequentialModel) {
+	trainSet, testSet := newSequentialDataset(2, 10, 50, 8).Split(0, 0)
+	score := m.Fit(trainSet, testSet, &FitConfig{Jobs: 2, Candidates: 10, TopK: 10, Verbose: 10})
+	assert.Greater(t, score.NDCG, float32(0.5))
+	// items in the same cluster are preferred
+	userProfile := []string{"0", "1", "2"}
+	userProfile = userProfile[base.Max(0, len(userProfile)-m.SequenceLength()):]
+	assert.Greater(t, m.Predict(userProfile, "3"), m.Predict(userProfile, "13"))
+	userProfileIndices := make([]int, len(userProfile))
+	for i, itemId := range userProfile {
+		userProfileIndices[i] = trainSet.ItemIndex.ToNumber(itemId)
+	}
+	assert.Equal(t, m.Predict(userProfile, "3"), m.InternalPredict(userProfileIndices, trainSet.ItemIndex.ToNumber("3")))
+	// unknown items
+	assert.Zero(t, m.Predict([]string{"unknown"}, "3"))
+	assert.Zero(t, m.Predict(userProfile, "unknown"))
+	// test encode and decode
+	buf, err := EncodeModel(m)
+	assert.NoError(t, err)
+	decoded, err := DecodeModel(name, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Predict(userProfile, "3"), decoded.(SequentialModel).Predict(userProfile, "3"))
+	assert.Equal(t, m.SequenceLength(), decoded.(SequentialModel).SequenceLength())
+}
+
+func TestItem2Vec(t *testing.T) {
+	m := NewItem2Vec(model.Params{model.NEpochs: 20, model.Window: 3})
+	testSequentialModel(t, "item2vec", m)
+	assert.Equal(t, 3, m.SequenceLength())
+	// test clear
+	m.Clear()
+	assert.True(t, m.Invalid())
+}
+
+func TestFMC(t *testing.T) {
+	m := NewFMC(model.Params{model.NEpochs: 20, model.Window: 1})
+	testSequentialModel(t, "fmc", m)
+	assert.Equal(t, 1, m.SequenceLength())
+	// next items are preferred to previous items
+	assert.Greater(t, m.Predict([]string{"2"}, "3"), m.Predict([]string{"2"}, "1"))
+	// test clear
+	m.Clear()
+	assert.True(t, m.Invalid())
+}
+
+func TestItem2Vec_EarlyStop(t *testing.T) {
+	trainSet, testSet := newSequentialDataset(2, 10, 50, 8).Split(0, 0)
+	// scores never improve if the learning rate is zero
+	m := NewItem2Vec(model.Params{model.NEpochs: 20, model.Lr: 0})
+	config := &FitConfig{Jobs: 2, Candidates: 10, TopK: 10, Verbose: 2, Patience: 2, Curve: &LearningCurve{}}
+	m.Fit(trainSet, testSet, config)
+	// patience is the number of evaluations, which are every Verbose epochs
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, config.Curve.Epochs)
+	assert.Equal(t, 6, len(config.Curve.Losses))
+	assert.Equal(t, []int{2, 4, 6}, config.Curve.EvalEpochs)
+	assert.Equal(t, 3, len(config.Curve.Scores))
+	assert.Greater(t, config.Curve.Losses[0], float32(0))
+}
@@ -0,0 +1,256 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"sort"
+
+	"github.com/zhenghaoz/gorse/base"
+)
+
+// TPE is the tree-structured Parzen estimator [1], a sequential model-based optimizer for hyper-parameters.
+// Observed trials are split into good trials and bad trials by scores. For each hyper-parameter, densities of
+// values in good trials l(x) and bad trials g(x) are estimated by Parzen windows, and the candidate sampled
+// from l(x) with the largest l(x)/g(x) is suggested. Hyper-parameters are sampled at random before there
+// are enough observed trials.
+//
+// [1] Bergstra, James, et al. "Algorithms for hyper-parameter optimization." Advances in neural information
+// processing systems 24 (2011).
+type TPE struct {
+	NumStartup    int     // number of random trials before model-based suggestions
+	NumCandidates int     // number of candidates sampled from l(x)
+	Gamma         float64 // fraction of good trials
+
+	space  ParamsSpace
+	names  []ParamName
+	rng    base.RandomGenerator
+	params []Params
+	scores []float64
+}
+
+// NewTPE creates a tree-structured Parzen estimator over a search space.
+func NewTPE(space ParamsSpace, seed int64) *TPE {
+	names := make([]ParamName, 0, len(space))
+	for name := range space {
+		names = append(names, name)
+	}
+	// iterate hyper-parameters in a fixed order to be reproducible
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+	return &TPE{
+		NumStartup:    3,
+		NumCandidates: 24,
+		Gamma:         0.25,
+		space:         space,
+		names:         names,
+		rng:           base.NewRandomGenerator(seed),
+	}
+}
+
+// Observe records the score of a trial. Larger scores are better.
+func (tpe *TPE) Observe(params Params, score float64) {
+	tpe.params = append(tpe.params, params.Copy())
+	tpe.scores = append(tpe.scores, score)
+}
+
+// Suggest returns hyper-parameters of the next trial.
+func (tpe *TPE) Suggest() Params {
+	params := make(Params, len(tpe.names))
+	if len(tpe.scores) < base.Max(tpe.NumStartup, 2) {
+		for _, name := range tpe.names {
+			params[name] = tpe.sampleRandom(tpe.space[name])
+		}
+		return params
+	}
+	// split trials into good trials and bad trials
+	order := make([]int, len(tpe.scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return tpe.scores[order[i]] > tpe.scores[order[j]]
+	})
+	numGood := int(math.Ceil(tpe.Gamma * float64(len(order))))
+	numGood = base.Max(1, base.Min(numGood, len(order)-1))
+	for _, name := range tpe.names {
+		good := make([]interface{}, 0, numGood)
+		bad := make([]interface{}, 0, len(order)-numGood)
+		for i, trial := range order {
+			if value, exist := tpe.params[trial][name]; exist {
+				if i < numGood {
+					good = append(good, value)
+				} else {
+					bad = append(bad, value)
+				}
+			}
+		}
+		r := tpe.space[name]
+		if r.IsContinuous() {
+			params[name] = tpe.suggestContinuous(r, good, bad)
+		} else {
+			params[name] = tpe.suggestChoice(r, good, bad)
+		}
+	}
+	return params
+}
+
+func (tpe *TPE) sampleRandom(r ParamRange) interface{} {
+	if !r.IsContinuous() {
+		return r.Choices[tpe.rng.Intn(len(r.Choices))]
+	}
+	low, high := r.internalBounds()
+	return r.fromInternal(low + tpe.rng.Float64()*(high-low))
+}
+
+func (tpe *TPE) suggestContinuous(r ParamRange, good, bad []interface{}) interface{} {
+	low, high := r.internalBounds()
+	goodMus, goodSigmas := parzenWindows(r.toInternal(good), low, high)
+	badMus, badSigmas := parzenWindows(r.toInternal(bad), low, high)
+	bestValue, bestScore := 0.0, math.Inf(-1)
+	for i := 0; i < tpe.NumCandidates; i++ {
+		// sample a candidate from l(x)
+		c := tpe.rng.Intn(len(goodMus))
+		x := goodMus[c] + tpe.rng.NormFloat64()*goodSigmas[c]
+		x = math.Max(low, math.Min(high, x))
+		if score := logDensity(x, goodMus, goodSigmas) - logDensity(x, badMus, badSigmas); score > bestScore {
+			bestValue, bestScore = x, score
+		}
+	}
+	return r.fromInternal(bestValue)
+}
+
+func (tpe *TPE) suggestChoice(r ParamRange, good, bad []interface{}) interface{} {
+	goodWeights := choiceWeights(r.Choices, good)
+	badWeights := choiceWeights(r.Choices, bad)
+	bestIndex, bestScore := 0, math.Inf(-1)
+	for i := 0; i < tpe.NumCandidates; i++ {
+		// sample a candidate from l(x)
+		c, p := 0, tpe.rng.Float64()
+		for c < len(goodWeights)-1 && p >= goodWeights[c] {
+			p -= goodWeights[c]
+			c++
+		}
+		if score := goodWeights[c] / badWeights[c]; score > bestScore {
+			bestIndex, bestScore = c, score
+		}
+	}
+	return r.Choices[bestIndex]
+}
+
+// internalBounds returns bounds of the range in the space where Parzen windows are estimated.
+func (r ParamRange) internalBounds() (float64, float64) {
+	if r.Log {
+		return math.Log(r.Low), math.Log(r.High)
+	}
+	return r.Low, r.High
+}
+
+// toInternal converts observed values to the space where Parzen windows are estimated.
+func (r ParamRange) toInternal(values []interface{}) []float64 {
+	xs := make([]float64, 0, len(values))
+	for _, value := range values {
+		var x float64
+		switch value := value.(type) {
+		case int:
+			x = float64(value)
+		case float32:
+			x = float64(value)
+		case float64:
+			x = value
+		default:
+			continue
+		}
+		if r.Log {
+			x = math.Log(x)
+		}
+		xs = append(xs, x)
+	}
+	return xs
+}
+
+// fromInternal converts a value in the space where Parzen windows are estimated to a hyper-parameter.
+func (r ParamRange) fromInternal(x float64) interface{} {
+	if r.Log {
+		x = math.Exp(x)
+	}
+	x = math.Max(r.Low, math.Min(r.High, x))
+	if r.Integer {
+		return int(math.Round(x))
+	}
+	return x
+}
+
+// parzenWindows estimates Gaussian kernels of observations in [low, high]. The bandwidth of each kernel is the
+// larger distance to its neighbors. A prior kernel covering the whole range is included.
+func parzenWindows(xs []float64, low, high float64) ([]float64, []float64) {
+	sorted := append([]float64{}, xs...)
+	sort.Float64s(sorted)
+	mus := []float64{(low + high) / 2}
+	sigmas := []float64{high - low}
+	minSigma := (high - low) / math.Min(100, float64(len(sorted)+1))
+	for i, mu := range sorted {
+		left, right := low, high
+		if i > 0 {
+			left = sorted[i-1]
+		}
+		if i+1 < len(sorted) {
+			right = sorted[i+1]
+		}
+		sigma := math.Max(mu-left, right-mu)
+		sigma = math.Max(minSigma, math.Min(high-low, sigma))
+		mus = append(mus, mu)
+		sigmas = append(sigmas, sigma)
+	}
+	return mus, sigmas
+}
+
+// logDensity returns the log density of a mixture of Gaussian kernels with equal weights.
+func logDensity(x float64, mus, sigmas []float64) float64 {
+	logs := make([]float64, len(mus))
+	maxLog := math.Inf(-1)
+	for i := range mus {
+		z := (x - mus[i]) / sigmas[i]
+		logs[i] = -z*z/2 - math.Log(sigmas[i])
+		maxLog = math.Max(maxLog, logs[i])
+	}
+	sum := 0.0
+	for _, l := range logs {
+		sum += math.Exp(l - maxLog)
+	}
+	return maxLog + math.Log(sum/float64(len(mus)))
+}
+
+// choiceWeights returns probabilities of choices in observations, smoothed by a uniform prior.
+func choiceWeights(choices, values []interface{}) []float64 {
+	weights := make([]float64, len(choices))
+	for i := range weights {
+		weights[i] = 1
+	}
+	for _, value := range values {
+		for i, choice := range choices {
+			if choice == value {
+				weights[i]++
+				break
+			}
+		}
+	}
+	total := float64(len(choices) + len(values))
+	for i := range weights {
+		weights[i] /= total
+	}
+	return weights
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamsSpace(t *testing.T) {
+	grid := ParamsGrid{
+		NFactors: []interface{}{8, 16},
+		Lr:       []interface{}{0.01, 0.1},
+	}
+	space := grid.ToSpace()
+	assert.False(t, space[NFactors].IsContinuous())
+	converted, ok := space.ToGrid()
+	assert.True(t, ok)
+	assert.Equal(t, grid, converted)
+	space[Reg] = NewLogRange(0.001, 1)
+	assert.True(t, space[Reg].IsContinuous())
+	_, ok = space.ToGrid()
+	assert.False(t, ok)
+}
+
+func TestTPE_Ranges(t *testing.T) {
+	tpe := NewTPE(ParamsSpace{
+		NFactors:   NewIntRange(4, 64),
+		Lr:         NewLogRange(0.001, 0.1),
+		InitStdDev: NewUniformRange(0.01, 0.1),
+		Similarity: NewChoices(SimilarityCosine, SimilarityDot),
+	}, 0)
+	for i := 0; i < 20; i++ {
+		params := tpe.Suggest()
+		assert.GreaterOrEqual(t, params.GetInt(NFactors, 0), 4)
+		assert.LessOrEqual(t, params.GetInt(NFactors, 0), 64)
+		assert.GreaterOrEqual(t, params.GetFloat32(Lr, 0), float32(0.001))
+		assert.LessOrEqual(t, params.GetFloat32(Lr, 0), float32(0.1))
+		assert.GreaterOrEqual(t, params.GetFloat32(InitStdDev, 0), float32(0.01))
+		assert.LessOrEqual(t, params.GetFloat32(InitStdDev, 0), float32(0.1))
+		assert.Contains(t, []string{SimilarityCosine, SimilarityDot}, params.GetString(Similarity, ""))
+		tpe.Observe(params, float64(i))
+	}
+}
+
+func TestTPE_Optimize(t *testing.T) {
+	// objective is maximized at Lr = 0.01 and Similarity = Dot
+	objective := func(params Params) float64 {
+		score := -math.Pow(math.Log10(float64(params.GetFloat32(Lr, 0)))+2, 2)
+		if params.GetString(Similarity, "") == SimilarityDot {
+			score += 1
+		}
+		return score
+	}
+	tpe := NewTPE(ParamsSpace{
+		Lr:         NewLogRange(0.0001, 1),
+		Similarity: NewChoices(SimilarityCosine, SimilarityDot),
+	}, 0)
+	best := math.Inf(-1)
+	numDot := 0
+	for i := 0; i < 30; i++ {
+		params := tpe.Suggest()
+		score := objective(params)
+		tpe.Observe(params, score)
+		best = math.Max(best, score)
+		if i >= 10 && params.GetString(Similarity, "") == SimilarityDot {
+			numDot++
+		}
+	}
+	assert.Greater(t, best, 0.9)
+	assert.Greater(t, numDot, 15)
+}
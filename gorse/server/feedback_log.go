@@ -0,0 +1,309 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"go.uber.org/zap"
+)
+
+const (
+	feedbackLogMinRetry = time.Second
+	feedbackLogMaxRetry = time.Minute
+	// feedbackLogBatchSize is the batch size of replay if the given batch size isn't positive.
+	feedbackLogBatchSize = 1000
+)
+
+// FeedbackLog is a local append-only log of feedback. Feedback is accepted once it's appended to the log and
+// replayed to the data store asynchronously. Feedback not written to the data store is recovered on restart.
+//
+// The byte offset of feedback written to the data store is committed to a separate offset file, so flushing a
+// batch doesn't rewrite the log. The log is compacted once flushed bytes outnumber pending bytes.
+type FeedbackLog struct {
+	path        string
+	file        *os.File
+	offset      int64 // bytes of flushed feedback at the head of the log
+	pending     []data.Feedback
+	sizes       []int64 // bytes of pending feedback in the log
+	pendingSize int64
+	mutex       sync.Mutex
+	notify      chan struct{}
+	done        chan struct{}
+}
+
+// OpenFeedbackLog opens a feedback log. Feedback remained in the log is loaded as pending feedback.
+func OpenFeedbackLog(path string) (*FeedbackLog, error) {
+	// create parent folder if not exists
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	log := &FeedbackLog{
+		path:    path,
+		pending: make([]data.Feedback, 0),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	// recover pending feedback after the committed offset
+	offset, err := readFeedbackLogOffset(log.offsetPath())
+	if err != nil {
+		return nil, err
+	}
+	if f, err := os.Open(path); err == nil {
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var feedback data.Feedback
+			if err = json.Unmarshal(scanner.Bytes(), &feedback); err != nil {
+				// the last line might be broken if the server crashed while appending
+				base.Logger().Warn("skip broken feedback in log", zap.String("path", path), zap.Error(err))
+				continue
+			}
+			log.pending = append(log.pending, feedback)
+		}
+		_ = f.Close()
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	// rewrite the log to drop broken lines and flushed feedback
+	if err := log.rewrite(); err != nil {
+		return nil, err
+	}
+	FeedbackLogQueueDepth.Set(float64(len(log.pending)))
+	return log, nil
+}
+
+// Append feedback to the log. Feedback is synced to the disk before returning.
+func (log *FeedbackLog) Append(feedback ...data.Feedback) error {
+	buf := make([]byte, 0)
+	sizes := make([]int64, len(feedback))
+	for i, v := range feedback {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+		sizes[i] = int64(len(line) + 1)
+	}
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if _, err := log.file.Write(buf); err != nil {
+		return err
+	}
+	if err := log.file.Sync(); err != nil {
+		return err
+	}
+	log.pending = append(log.pending, feedback...)
+	log.sizes = append(log.sizes, sizes...)
+	log.pendingSize += int64(len(buf))
+	FeedbackLogQueueDepth.Set(float64(len(log.pending)))
+	// wake up replay
+	select {
+	case log.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of feedback not written to the data store.
+func (log *FeedbackLog) Len() int {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return len(log.pending)
+}
+
+// Flush writes at most n pending feedback to the data store by the insert function. The offset of written feedback
+// is committed if succeed. It returns the number of written feedback.
+func (log *FeedbackLog) Flush(insert func([]data.Feedback) error, n int) (int, error) {
+	log.mutex.Lock()
+	if n > len(log.pending) {
+		n = len(log.pending)
+	}
+	batch := append([]data.Feedback(nil), log.pending[:n]...)
+	log.mutex.Unlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := insert(batch); err != nil {
+		return 0, err
+	}
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	var flushedSize int64
+	for _, size := range log.sizes[:n] {
+		flushedSize += size
+	}
+	log.pending = log.pending[n:]
+	log.sizes = log.sizes[n:]
+	log.pendingSize -= flushedSize
+	FeedbackLogQueueDepth.Set(float64(len(log.pending)))
+	log.offset += flushedSize
+	if log.offset >= log.pendingSize {
+		// compact the log, the cost is amortized by flushed feedback
+		return n, log.rewrite()
+	}
+	return n, writeFeedbackLogOffset(log.offsetPath(), log.offset)
+}
+
+// Replay writes pending feedback to the data store by the insert function in batches until the log is closed.
+// Failed batches are retried with exponential backoff. The default batch size is used if the batch size isn't
+// positive, otherwise no feedback would be written.
+func (log *FeedbackLog) Replay(insert func([]data.Feedback) error, batchSize int) {
+	if batchSize <= 0 {
+		batchSize = feedbackLogBatchSize
+	}
+	retry := feedbackLogMinRetry
+	for {
+		n, err := log.Flush(insert, batchSize)
+		if err != nil {
+			base.Logger().Error("failed to replay feedback log", zap.Int("n_pending", log.Len()),
+				zap.Duration("retry", retry), zap.Error(err))
+			select {
+			case <-log.done:
+				return
+			case <-time.After(retry):
+			}
+			if retry *= 2; retry > feedbackLogMaxRetry {
+				retry = feedbackLogMaxRetry
+			}
+			continue
+		}
+		retry = feedbackLogMinRetry
+		if n == 0 {
+			// wait for new feedback
+			select {
+			case <-log.done:
+				return
+			case <-log.notify:
+			}
+		}
+	}
+}
+
+// Close the log. Pending feedback is kept in the log.
+func (log *FeedbackLog) Close() error {
+	close(log.done)
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return log.file.Close()
+}
+
+// rewrite the log with pending feedback. The log is replaced atomically by renaming a temporary file. The offset
+// is reset before renaming, so feedback might be replayed twice but never lost if the server crashes in between.
+func (log *FeedbackLog) rewrite() error {
+	tempPath := log.path + ".tmp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	log.sizes = make([]int64, len(log.pending))
+	log.pendingSize = 0
+	for i, v := range log.pending {
+		line, err := json.Marshal(v)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		line = append(line, '\n')
+		if _, err = writer.Write(line); err != nil {
+			_ = f.Close()
+			return err
+		}
+		log.sizes[i] = int64(len(line))
+		log.pendingSize += int64(len(line))
+	}
+	if err = writer.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if log.file != nil {
+		if err = log.file.Close(); err != nil {
+			return err
+		}
+		log.file = nil
+	}
+	if err = writeFeedbackLogOffset(log.offsetPath(), 0); err != nil {
+		return err
+	}
+	log.offset = 0
+	if err = os.Rename(tempPath, log.path); err != nil {
+		return err
+	}
+	log.file, err = os.OpenFile(log.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+// offsetPath returns the path of the committed offset file.
+func (log *FeedbackLog) offsetPath() string {
+	return log.path + ".offset"
+}
+
+// readFeedbackLogOffset reads a committed offset. Zero is returned if the offset file doesn't exist.
+func readFeedbackLogOffset(path string) (int64, error) {
+	text, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(text)), 10, 64)
+}
+
+// writeFeedbackLogOffset commits an offset. The offset file is replaced atomically by renaming a temporary file.
+func writeFeedbackLogOffset(path string, offset int64) error {
+	tempPath := path + ".tmp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(strconv.FormatInt(offset, 10)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/steinfletcher/apitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/storage/data"
+)
+
+func TestFeedbackLog(t *testing.T) {
+	// delete test file if exists
+	path := filepath.Join(os.TempDir(), "TestFeedbackLog_Server")
+	_ = os.Remove(path)
+	_ = os.Remove(path + ".offset")
+	log, err := OpenFeedbackLog(path)
+	assert.NoError(t, err)
+	assert.Zero(t, log.Len())
+	// append feedback
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "4"}},
+	}
+	assert.NoError(t, log.Append(feedback...))
+	assert.Equal(t, 3, log.Len())
+	assert.Equal(t, float64(3), testutil.ToFloat64(FeedbackLogQueueDepth))
+	// failed to flush
+	n, err := log.Flush(func([]data.Feedback) error { return fmt.Errorf("unavailable") }, 2)
+	assert.Error(t, err)
+	assert.Zero(t, n)
+	assert.Equal(t, 3, log.Len())
+	// flush a batch
+	var inserted []data.Feedback
+	insert := func(batch []data.Feedback) error {
+		inserted = append(inserted, batch...)
+		return nil
+	}
+	n, err = log.Flush(insert, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, feedback[:2], inserted)
+	assert.Equal(t, 1, log.Len())
+	// recover on restart
+	assert.NoError(t, log.Append(feedback[0]))
+	assert.NoError(t, log.Close())
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"FeedbackType":"cli`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	log, err = OpenFeedbackLog(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, log.Len())
+	// replay with the default batch size
+	inserted = nil
+	go log.Replay(insert, 0)
+	assert.Eventually(t, func() bool { return log.Len() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []data.Feedback{feedback[2], feedback[0]}, inserted)
+	assert.Zero(t, testutil.ToFloat64(FeedbackLogQueueDepth))
+	assert.NoError(t, log.Close())
+	// delete test file
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, os.Remove(path+".offset"))
+}
+
+func TestFeedbackLog_Offset(t *testing.T) {
+	// delete test file if exists
+	path := filepath.Join(os.TempDir(), "TestFeedbackLog_Offset")
+	_ = os.Remove(path)
+	_ = os.Remove(path + ".offset")
+	log, err := OpenFeedbackLog(path)
+	assert.NoError(t, err)
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "4"}},
+	}
+	assert.NoError(t, log.Append(feedback...))
+	stat, err := os.Stat(path)
+	assert.NoError(t, err)
+	size := stat.Size()
+	// the log isn't rewritten while flushed feedback is less than pending feedback
+	var inserted []data.Feedback
+	insert := func(batch []data.Feedback) error {
+		inserted = append(inserted, batch...)
+		return nil
+	}
+	n, err := log.Flush(insert, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	stat, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, size, stat.Size())
+	offset, err := readFeedbackLogOffset(path + ".offset")
+	assert.NoError(t, err)
+	assert.Equal(t, size/3, offset)
+	// recover from the committed offset
+	assert.NoError(t, log.Close())
+	log, err = OpenFeedbackLog(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, log.Len())
+	// the log is compacted once flushed feedback outnumbers pending feedback
+	n, err = log.Flush(insert, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, feedback, inserted)
+	stat, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Zero(t, stat.Size())
+	offset, err = readFeedbackLogOffset(path + ".offset")
+	assert.NoError(t, err)
+	assert.Zero(t, offset)
+	assert.NoError(t, log.Close())
+	// delete test file
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, os.Remove(path+".offset"))
+}
+
+func TestServer_InsertFeedbackToLog(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	path := filepath.Join(os.TempDir(), "TestServer_InsertFeedbackToLog")
+	_ = os.Remove(path)
+	_ = os.Remove(path + ".offset")
+	var err error
+	s.FeedbackLog, err = OpenFeedbackLog(path)
+	assert.NoError(t, err)
+	// feedback is accepted by the log
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 2}`).
+		End()
+	assert.Equal(t, 2, s.FeedbackLog.Len())
+	userFeedback, err := s.DataClient.GetUserFeedback("0")
+	assert.NoError(t, err)
+	assert.Empty(t, userFeedback)
+	// replay to the data store
+	_, err = s.FeedbackLog.Flush(func(batch []data.Feedback) error {
+		return s.DataClient.BatchInsertFeedback(batch, true, true)
+	}, 10)
+	assert.NoError(t, err)
+	userFeedback, err = s.DataClient.GetUserFeedback("0")
+	assert.NoError(t, err)
+	assert.Equal(t, feedback[:1], userFeedback)
+	// streamed feedback is accepted by the log
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback/stream").
+		Header("X-API-Key", apiKey).
+		ContentType(MIME_NDJSON).
+		Body(`{"FeedbackType":"click","UserId":"2","ItemId":"4","Timestamp":"2021-01-01"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, IngestSummary{Accepted: 1})).
+		End()
+	assert.Equal(t, 1, s.FeedbackLog.Len())
+	userFeedback, err = s.DataClient.GetUserFeedback("2")
+	assert.NoError(t, err)
+	assert.Empty(t, userFeedback)
+	assert.NoError(t, s.FeedbackLog.Close())
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, os.Remove(path+".offset"))
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	RecommendStageLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "recommend_stage_latency",
+		Help: "Latency of stages in the recommendation pipeline",
+	}, []string{"stage"})
+	RecommendStageItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "recommend_stage_items",
+		Help: "Number of items recommended by stages in the recommendation pipeline",
+	}, []string{"stage"})
+	FeedbackLogQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "feedback_log_queue_depth",
+		Help: "Number of feedback in the local log waiting to be written to the data store",
+	})
+)
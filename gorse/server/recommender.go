@@ -0,0 +1,694 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scylladb/go-set/strset"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"go.uber.org/zap"
+)
+
+const (
+	CollaborativeRecommender = "collaborative"
+	SessionRecommender       = "session"
+	ItemNeighborRecommender  = "item-neighbor"
+	UserNeighborRecommender  = "user-neighbor"
+	PopularRecommender       = "popular-by-label"
+	LatestRecommender        = "latest-by-label"
+	SubscribeRecommender     = "subscribe"
+)
+
+// Recommender generates candidates in a stage of the recommendation pipeline. Items excluded by the
+// context must be skipped and no more than n items should be returned.
+type Recommender func(s *RestServer, ctx *RecommendContext, stage config.StageConfig, n int) ([]cache.ScoredItem, error)
+
+var (
+	recommenders      = make(map[string]Recommender)
+	recommendersMutex sync.RWMutex
+)
+
+func init() {
+	RegisterRecommender(CollaborativeRecommender, collaborativeRecommender)
+	RegisterRecommender(SessionRecommender, sessionRecommender)
+	RegisterRecommender(ItemNeighborRecommender, itemNeighborRecommender)
+	RegisterRecommender(UserNeighborRecommender, userNeighborRecommender)
+	RegisterRecommender(PopularRecommender, popularRecommender)
+	RegisterRecommender(LatestRecommender, latestRecommender)
+	RegisterRecommender(SubscribeRecommender, subscribeRecommender)
+}
+
+// RegisterRecommender registers a recommender, which could be used as a stage in the recommendation pipeline.
+func RegisterRecommender(name string, recommender Recommender) {
+	recommendersMutex.Lock()
+	defer recommendersMutex.Unlock()
+	recommenders[name] = recommender
+}
+
+// GetRecommender returns the recommender registered with the name.
+func GetRecommender(name string) (Recommender, bool) {
+	recommendersMutex.RLock()
+	defer recommendersMutex.RUnlock()
+	recommender, exist := recommenders[name]
+	return recommender, exist
+}
+
+// RecommendFilter restricts items recommended by all stages.
+type RecommendFilter struct {
+	IncludeLabels []string             // recommended items must have at least one of these labels
+	ExcludeLabels []string             // recommended items must have none of these labels
+	BeginTime     *time.Time           // recommended items must be created after this time
+	EndTime       *time.Time           // recommended items must be created before this time
+	Categorical   map[string][]string  // recommended items must have one of these values of each categorical attribute
+	MinNumeric    map[string]float32   // recommended items must have numeric attributes not less than these values
+	MaxNumeric    map[string]float32   // recommended items must have numeric attributes not greater than these values
+	MinTime       map[string]time.Time // recommended items must have timestamp attributes not before these times
+	MaxTime       map[string]time.Time // recommended items must have timestamp attributes not after these times
+}
+
+// NeedItem returns true if items are required to check whether they pass the filter.
+func (filter *RecommendFilter) NeedItem() bool {
+	return filter != nil && (len(filter.IncludeLabels) > 0 || len(filter.ExcludeLabels) > 0 ||
+		filter.BeginTime != nil || filter.EndTime != nil || len(filter.Categorical) > 0 ||
+		len(filter.MinNumeric) > 0 || len(filter.MaxNumeric) > 0 || len(filter.MinTime) > 0 || len(filter.MaxTime) > 0)
+}
+
+// Accept returns true if the item passes the filter.
+func (filter *RecommendFilter) Accept(item data.Item) bool {
+	if filter == nil {
+		return true
+	}
+	labels := strset.New(item.Labels...)
+	if len(filter.IncludeLabels) > 0 && !labels.HasAny(filter.IncludeLabels...) {
+		return false
+	}
+	if labels.HasAny(filter.ExcludeLabels...) {
+		return false
+	}
+	if filter.BeginTime != nil && item.Timestamp.Before(*filter.BeginTime) {
+		return false
+	}
+	if filter.EndTime != nil && item.Timestamp.After(*filter.EndTime) {
+		return false
+	}
+	return filter.acceptAttributes(item.Attributes)
+}
+
+// acceptAttributes returns true if attributes satisfy all attribute conditions. Missing attributes fail conditions.
+func (filter *RecommendFilter) acceptAttributes(attributes data.Attributes) bool {
+	for name, values := range filter.Categorical {
+		value, exist := attributes.Categorical[name]
+		if !exist || !strset.New(values...).Has(value) {
+			return false
+		}
+	}
+	for name, minValue := range filter.MinNumeric {
+		if value, exist := attributes.Numeric[name]; !exist || value < minValue {
+			return false
+		}
+	}
+	for name, maxValue := range filter.MaxNumeric {
+		if value, exist := attributes.Numeric[name]; !exist || value > maxValue {
+			return false
+		}
+	}
+	for name, minTime := range filter.MinTime {
+		if t, exist := attributes.Timestamp[name]; !exist || t.Before(minTime) {
+			return false
+		}
+	}
+	for name, maxTime := range filter.MaxTime {
+		if t, exist := attributes.Timestamp[name]; !exist || t.After(maxTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// RecommendContext holds the states shared by stages while recommending items to a user.
+type RecommendContext struct {
+	UserId        string
+	Explain       bool             // collect history items contributed to recommended items
+	Filter        *RecommendFilter // filter applied to items from all stages
+	ContextLabels []string         // context labels used to re-rank items by the click model
+	excludeSet    *strset.Set
+	userFeedback  []data.Feedback
+	loaded        bool
+	because       map[string][]string
+	items         map[string]*data.Item // items loaded for filtering (nil if not exist)
+}
+
+// NewRecommendContext creates a context for a user. Ignored items of the user and unavailable items are excluded.
+func (s *RestServer) NewRecommendContext(userId string) (*RecommendContext, error) {
+	ignoreItems, err := s.CacheClient.GetList(cache.IgnoreItems, userId)
+	if err != nil {
+		return nil, err
+	}
+	excludeSet, err := cache.UnavailableItems(s.CacheClient, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	excludeSet.Add(ignoreItems...)
+	return &RecommendContext{
+		UserId:     userId,
+		excludeSet: excludeSet,
+		because:    make(map[string][]string),
+		items:      make(map[string]*data.Item),
+	}, nil
+}
+
+// AddReason records that a history item contributes to a recommended item if explanation is required.
+func (ctx *RecommendContext) AddReason(itemId, historyItemId string) {
+	if ctx.Explain {
+		ctx.because[itemId] = append(ctx.because[itemId], historyItemId)
+	}
+}
+
+// Reasons returns history items contributed to a recommended item.
+func (ctx *RecommendContext) Reasons(itemId string) []string {
+	return ctx.because[itemId]
+}
+
+// Exclude returns true if the item shouldn't be recommended.
+func (ctx *RecommendContext) Exclude(itemId string) bool {
+	return ctx.excludeSet.Has(itemId)
+}
+
+// SessionItems returns at most n items in the latest positive feedback, most recent first. Recent feedback is
+// recorded in the cache once inserted, so it's available before feedback is written to the data store. Items with
+// negative feedback or only other feedback (such as read) are skipped.
+func (ctx *RecommendContext) SessionItems(s *RestServer, n int) ([]string, error) {
+	recentFeedback, err := s.CacheClient.GetSortedScores(cache.SessionFeedback, ctx.UserId, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	positiveTypes := strset.New(s.GorseConfig.Database.PositiveFeedbackType...)
+	negativeTypes := strset.New(s.GorseConfig.Database.NegativeFeedbackTypes...)
+	negativeItems := strset.New()
+	for _, feedback := range recentFeedback {
+		itemId, feedbackType := parseSessionMember(feedback.ItemId)
+		if negativeTypes.Has(feedbackType) {
+			negativeItems.Add(itemId)
+		}
+	}
+	items := make([]string, 0, n)
+	sessionItems := strset.New()
+	for _, feedback := range recentFeedback {
+		if len(items) >= n {
+			break
+		}
+		itemId, feedbackType := parseSessionMember(feedback.ItemId)
+		// an item appears once in the session
+		if positiveTypes.Has(feedbackType) && !negativeItems.Has(itemId) && !sessionItems.Has(itemId) {
+			items = append(items, itemId)
+			sessionItems.Add(itemId)
+		}
+	}
+	return items, nil
+}
+
+// sessionMember encodes an item and a feedback type as a member of recent feedback. Item IDs never contain `/`.
+func sessionMember(itemId, feedbackType string) string {
+	return itemId + "/" + feedbackType
+}
+
+// parseSessionMember decodes an item and a feedback type from a member of recent feedback.
+func parseSessionMember(member string) (itemId, feedbackType string) {
+	if i := strings.Index(member, "/"); i >= 0 {
+		return member[:i], member[i+1:]
+	}
+	return member, ""
+}
+
+// ExcludeItems excludes items from recommendation.
+func (ctx *RecommendContext) ExcludeItems(itemIds ...string) {
+	ctx.excludeSet.Add(itemIds...)
+}
+
+// needItem returns true if items are required to check whether they are accepted.
+func (ctx *RecommendContext) needItem() bool {
+	return ctx.Filter.NeedItem()
+}
+
+// loadItems loads items not loaded yet from the database in a batch.
+func (ctx *RecommendContext) loadItems(s *RestServer, itemIds []string) error {
+	missing := make([]string, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		if _, loaded := ctx.items[itemId]; !loaded {
+			missing = append(missing, itemId)
+			ctx.items[itemId] = nil
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	items, err := s.DataClient.BatchGetItems(missing)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		ctx.items[items[i].ItemId] = &items[i]
+	}
+	return nil
+}
+
+// prefetch loads items required to check whether they are accepted in a batch.
+func (ctx *RecommendContext) prefetch(s *RestServer, items []cache.ScoredItem) error {
+	if !ctx.needItem() {
+		return nil
+	}
+	itemIds := make([]string, 0, len(items))
+	for _, item := range items {
+		if !ctx.Exclude(item.ItemId) {
+			itemIds = append(itemIds, item.ItemId)
+		}
+	}
+	return ctx.loadItems(s, itemIds)
+}
+
+// accept returns true if the item passes the filter of the context and it's available now.
+func (ctx *RecommendContext) accept(s *RestServer, itemId string) (bool, error) {
+	if !ctx.needItem() {
+		return true, nil
+	}
+	if err := ctx.loadItems(s, []string{itemId}); err != nil {
+		return false, err
+	}
+	item := ctx.items[itemId]
+	if item == nil {
+		return false, nil
+	}
+	return ctx.Filter.Accept(*item) && item.IsAvailable(time.Now()), nil
+}
+
+// UserFeedback loads historical feedback of the user once. Items in the history are excluded since then.
+func (ctx *RecommendContext) UserFeedback(s *RestServer) ([]data.Feedback, error) {
+	if !ctx.loaded {
+		userFeedback, err := s.DataClient.GetUserFeedback(ctx.UserId)
+		if err != nil {
+			return nil, err
+		}
+		for _, feedback := range userFeedback {
+			ctx.excludeSet.Add(feedback.ItemId)
+		}
+		ctx.userFeedback = userFeedback
+		ctx.loaded = true
+	}
+	return ctx.userFeedback, nil
+}
+
+// StageResult is the output of a stage in the recommendation pipeline.
+type StageResult struct {
+	Stage string
+	Items []cache.ScoredItem
+	Time  time.Duration
+}
+
+// RecommendStages returns stages of the recommendation pipeline. If stages are not configured, the pipeline
+// consists of collaborative filtering, item neighbors and the fallback recommendation (popular/latest).
+func (s *RestServer) RecommendStages() ([]config.StageConfig, error) {
+	if len(s.GorseConfig.Recommend.Stages) > 0 {
+		return s.GorseConfig.Recommend.Stages, nil
+	}
+	stages := []config.StageConfig{{Name: CollaborativeRecommender}, {Name: ItemNeighborRecommender}}
+	switch s.GorseConfig.Recommend.FallbackRecommend {
+	case "latest":
+		stages = append(stages, config.StageConfig{Name: LatestRecommender})
+	case "popular":
+		stages = append(stages, config.StageConfig{Name: PopularRecommender})
+	default:
+		return nil, fmt.Errorf("unknown fallback recommendation method `%s`", s.GorseConfig.Recommend.FallbackRecommend)
+	}
+	return stages, nil
+}
+
+// RecommendPipeline runs stages in order until n items are collected. Each stage contributes no more than
+// its quota. Consecutive stages with weights are blended: their candidates are merged by the sum of scores
+// multiplied by weights and the best ones are taken. Items recommended by previous stages are excluded. If
+// there is a filter in the context or there are scheduled items, stages are asked for more candidates since
+// some of them will be filtered.
+func (s *RestServer) RecommendPipeline(ctx *RecommendContext, n int) ([]StageResult, error) {
+	stages, err := s.RecommendStages()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]StageResult, 0, len(stages))
+	numItems := 0
+	for i := 0; i < len(stages) && numItems < n; {
+		// find consecutive stages with weights
+		j := i + 1
+		if stages[i].Weight != 0 {
+			for j < len(stages) && stages[j].Weight != 0 {
+				j++
+			}
+		}
+		var groupResults []StageResult
+		if j-i == 1 {
+			result, err := s.runStage(ctx, stages[i], n-numItems)
+			if err != nil {
+				return nil, err
+			}
+			groupResults = []StageResult{result}
+		} else if groupResults, err = s.blendStages(ctx, stages[i:j], n-numItems); err != nil {
+			return nil, err
+		}
+		for _, result := range groupResults {
+			for _, item := range result.Items {
+				ctx.excludeSet.Add(item.ItemId)
+			}
+			RecommendStageItems.WithLabelValues(result.Stage).Add(float64(len(result.Items)))
+			numItems += len(result.Items)
+		}
+		results = append(results, groupResults...)
+		i = j
+	}
+	return results, nil
+}
+
+// runStage collects at most k items from a stage. Scores are multiplied by the weight of the stage if set.
+// Collected items aren't excluded from the context.
+func (s *RestServer) runStage(ctx *RecommendContext, stage config.StageConfig, k int) (StageResult, error) {
+	recommender, exist := GetRecommender(stage.Name)
+	if !exist {
+		return StageResult{}, fmt.Errorf("unknown recommender `%s`", stage.Name)
+	}
+	if stage.Quota > 0 && stage.Quota < k {
+		k = stage.Quota
+	}
+	numCandidates := k
+	if ctx.needItem() && numCandidates < s.GorseConfig.Database.CacheSize {
+		numCandidates = s.GorseConfig.Database.CacheSize
+	}
+	start := time.Now()
+	items, err := recommender(s, ctx, stage, numCandidates)
+	if err != nil {
+		return StageResult{}, err
+	}
+	if err = ctx.prefetch(s, items); err != nil {
+		return StageResult{}, err
+	}
+	result := StageResult{Stage: stage.Name, Items: make([]cache.ScoredItem, 0, k)}
+	for _, item := range items {
+		if len(result.Items) >= k {
+			break
+		}
+		if !ctx.Exclude(item.ItemId) {
+			if accepted, err := ctx.accept(s, item.ItemId); err != nil {
+				return StageResult{}, err
+			} else if !accepted {
+				continue
+			}
+			if stage.Weight != 0 {
+				item.Score *= stage.Weight
+			}
+			result.Items = append(result.Items, item)
+		}
+	}
+	result.Time = time.Since(start)
+	RecommendStageLatency.WithLabelValues(stage.Name).Observe(result.Time.Seconds())
+	return result, nil
+}
+
+// blendStages merges candidates from stages by the sum of weighted scores and takes the best k items. An item
+// is attributed to the stage contributing most to its score. Results are split into runs of items from the
+// same stage in the order of blended scores.
+func (s *RestServer) blendStages(ctx *RecommendContext, stages []config.StageConfig, k int) ([]StageResult, error) {
+	type candidate struct {
+		cache.ScoredItem
+		stage        string
+		contribution float32
+	}
+	candidates := make([]*candidate, 0)
+	candidateIndex := make(map[string]*candidate)
+	stageTime := make(map[string]time.Duration)
+	for _, stage := range stages {
+		result, err := s.runStage(ctx, stage, k)
+		if err != nil {
+			return nil, err
+		}
+		stageTime[stage.Name] += result.Time
+		for _, item := range result.Items {
+			if c, exist := candidateIndex[item.ItemId]; exist {
+				c.Score += item.Score
+				if item.Score > c.contribution {
+					c.stage, c.contribution = stage.Name, item.Score
+				}
+			} else {
+				c = &candidate{ScoredItem: item, stage: stage.Name, contribution: item.Score}
+				candidateIndex[item.ItemId] = c
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	results := make([]StageResult, 0)
+	for _, c := range candidates {
+		if len(results) == 0 || results[len(results)-1].Stage != c.stage {
+			// the time of a stage is reported by its first run
+			results = append(results, StageResult{Stage: c.stage, Time: stageTime[c.stage]})
+			stageTime[c.stage] = 0
+		}
+		results[len(results)-1].Items = append(results[len(results)-1].Items, c.ScoredItem)
+	}
+	return results, nil
+}
+
+// rerankByContext re-ranks recommended items by click-through-rates predicted by the click model in the context
+// of the request. Items are unchanged if there are no context labels or there is no click model.
+func (s *RestServer) rerankByContext(ctx *RecommendContext, items []ExplainedItem) ([]ExplainedItem, error) {
+	clickModel := s.getClickModel()
+	if len(ctx.ContextLabels) == 0 || clickModel == nil {
+		return items, nil
+	}
+	itemIds := make([]string, len(items))
+	for i := range items {
+		itemIds[i] = items[i].ItemId
+	}
+	if err := ctx.loadItems(s, itemIds); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		var item data.Item
+		if detail := ctx.items[items[i].ItemId]; detail != nil {
+			item = *detail
+		}
+		items[i].Score = clickModel.Predict(ctx.UserId, items[i].ItemId, item.Labels, item.Attributes, ctx.ContextLabels)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Score > items[j].Score })
+	return items, nil
+}
+
+// collaborativeRecommender recommends items from the cached collaborative filtering recommendation.
+func collaborativeRecommender(s *RestServer, ctx *RecommendContext, _ config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	items, err := s.recommendList(ctx, cache.RecommendItems, ctx.UserId, n)
+	if err == nil && len(items) == 0 {
+		base.Logger().Warn("empty collaborative filtering", zap.String("user_id", ctx.UserId))
+	}
+	return items, err
+}
+
+// sessionRecommender recommends items similar to items in recent positive feedback, which hasn't been consumed by
+// workers yet. Scores of session items and cached collaborative filtering items are normalized and mixed by the
+// session weight.
+func sessionRecommender(s *RestServer, ctx *RecommendContext, _ config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	weight := s.GorseConfig.Recommend.SessionWeight
+	candidates := make(map[string]float32)
+	// collect session items
+	sessionItems, err := ctx.SessionItems(s, s.GorseConfig.Recommend.SessionSize)
+	if err != nil {
+		return nil, err
+	}
+	sessionCandidates := make(map[string]float32)
+	for _, itemId := range sessionItems {
+		similarItems, err := s.CacheClient.GetScores(cache.SimilarItems, itemId, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range similarItems {
+			if !ctx.Exclude(item.ItemId) {
+				sessionCandidates[item.ItemId] += item.Score
+				ctx.AddReason(item.ItemId, itemId)
+			}
+		}
+	}
+	addNormalizedScores(candidates, sessionCandidates, weight)
+	// collect collaborative filtering items
+	collaborativeItems, err := s.recommendList(ctx, cache.RecommendItems, ctx.UserId, s.GorseConfig.Database.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	collaborativeCandidates := make(map[string]float32, len(collaborativeItems))
+	for _, item := range collaborativeItems {
+		collaborativeCandidates[item.ItemId] = item.Score
+	}
+	addNormalizedScores(candidates, collaborativeCandidates, 1-weight)
+	return topKCandidates(candidates, n), nil
+}
+
+// addNormalizedScores adds scores divided by the max absolute score and multiplied by the weight to candidates.
+func addNormalizedScores(candidates, scores map[string]float32, weight float32) {
+	var maxScore float32
+	for _, score := range scores {
+		if score > maxScore {
+			maxScore = score
+		} else if -score > maxScore {
+			maxScore = -score
+		}
+	}
+	if maxScore == 0 {
+		maxScore = 1
+	}
+	for itemId, score := range scores {
+		candidates[itemId] += weight * score / maxScore
+	}
+}
+
+// itemNeighborRecommender recommends items similar to items in the history of the user. Neighbors of items with
+// negative feedback are down-weighted and dropped if their scores aren't positive.
+func itemNeighborRecommender(s *RestServer, ctx *RecommendContext, _ config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	userFeedback, err := ctx.UserFeedback(s)
+	if err != nil {
+		return nil, err
+	}
+	negativeTypes := strset.New(s.GorseConfig.Database.NegativeFeedbackTypes...)
+	// collect candidates
+	candidates := make(map[string]float32)
+	for _, feedback := range userFeedback {
+		// load similar items
+		similarItems, err := s.CacheClient.GetScores(cache.SimilarItems, feedback.ItemId, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		// add unseen items
+		for _, item := range similarItems {
+			if ctx.Exclude(item.ItemId) {
+				continue
+			}
+			if negativeTypes.Has(feedback.FeedbackType) {
+				candidates[item.ItemId] -= s.GorseConfig.Recommend.NegativeNeighborWeight * item.Score
+			} else {
+				candidates[item.ItemId] += item.Score
+				ctx.AddReason(item.ItemId, feedback.ItemId)
+			}
+		}
+	}
+	for itemId, score := range candidates {
+		if score <= 0 {
+			delete(candidates, itemId)
+		}
+	}
+	return topKCandidates(candidates, n), nil
+}
+
+// userNeighborRecommender recommends items in the history of similar users.
+func userNeighborRecommender(s *RestServer, ctx *RecommendContext, _ config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	if _, err := ctx.UserFeedback(s); err != nil {
+		return nil, err
+	}
+	// load similar users
+	similarUsers, err := s.CacheClient.GetScores(cache.SimilarUsers, ctx.UserId, 0, s.GorseConfig.Database.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	// collect candidates except negative feedback of similar users
+	negativeTypes := strset.New(s.GorseConfig.Database.NegativeFeedbackTypes...)
+	candidates := make(map[string]float32)
+	for _, user := range similarUsers {
+		feedback, err := s.DataClient.GetUserFeedback(user.ItemId)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range feedback {
+			if !ctx.Exclude(v.ItemId) && !negativeTypes.Has(v.FeedbackType) {
+				candidates[v.ItemId] += user.Score
+			}
+		}
+	}
+	return topKCandidates(candidates, n), nil
+}
+
+// popularRecommender recommends popular items with the label of the stage. If the label of the stage is not set,
+// popular items with labels included by the filter are recommended.
+func popularRecommender(s *RestServer, ctx *RecommendContext, stage config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	return s.recommendLabelLists(ctx, cache.PopularItems, stage, n)
+}
+
+// latestRecommender recommends latest items with the label of the stage. If the label of the stage is not set,
+// latest items with labels included by the filter are recommended.
+func latestRecommender(s *RestServer, ctx *RecommendContext, stage config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	return s.recommendLabelLists(ctx, cache.LatestItems, stage, n)
+}
+
+// recommendLabelLists merges cached lists of labels for popular-by-label and latest-by-label.
+func (s *RestServer) recommendLabelLists(ctx *RecommendContext, prefix string, stage config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	if stage.Label != "" || ctx.Filter == nil || len(ctx.Filter.IncludeLabels) == 0 {
+		return s.recommendList(ctx, prefix, stage.Label, n)
+	}
+	candidates := make(map[string]float32)
+	for _, label := range ctx.Filter.IncludeLabels {
+		items, err := s.recommendList(ctx, prefix, label, n)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			candidates[item.ItemId] = item.Score
+		}
+	}
+	return topKCandidates(candidates, n), nil
+}
+
+// subscribeRecommender recommends items subscribed by the user.
+func subscribeRecommender(s *RestServer, ctx *RecommendContext, _ config.StageConfig, n int) ([]cache.ScoredItem, error) {
+	return s.recommendList(ctx, cache.SubscribeItems, ctx.UserId, n)
+}
+
+// recommendList returns top n items not excluded in a cached list.
+func (s *RestServer) recommendList(ctx *RecommendContext, prefix, name string, n int) ([]cache.ScoredItem, error) {
+	items, err := cache.GetItemScores(s.CacheClient, prefix, name, 0, s.GorseConfig.Database.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]cache.ScoredItem, 0, n)
+	for _, item := range items {
+		if len(results) >= n {
+			break
+		}
+		if !ctx.Exclude(item.ItemId) {
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+// topKCandidates returns top k candidates with highest scores.
+func topKCandidates(candidates map[string]float32, k int) []cache.ScoredItem {
+	filter := base.NewTopKStringFilter(k)
+	for id, score := range candidates {
+		filter.Push(id, score)
+	}
+	ids, scores := filter.PopAll()
+	return cache.CreateScoredItems(ids, scores)
+}
@@ -15,19 +15,27 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/araddon/dateparse"
+	"github.com/chewxy/math32"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/scylladb/go-set"
+	"github.com/scylladb/go-set/strset"
 
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	"github.com/emicklei/go-restful/v3"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"go.uber.org/zap"
@@ -42,6 +50,32 @@ type RestServer struct {
 	HttpPort    int
 	EnableAuth  bool
 	WebService  *restful.WebService
+	FeedbackLog *FeedbackLog // feedback is appended to the local log instead of the data store if set
+
+	// pending batches of streaming ingestion
+	ingestOnce  sync.Once
+	ingestSlots chan struct{}
+
+	// click model used to re-rank recommended items in context
+	clickModel      click.FactorizationMachine
+	clickModelMutex sync.RWMutex
+}
+
+// SetClickModel replaces the click model used to re-rank recommended items in context.
+func (s *RestServer) SetClickModel(clickModel click.FactorizationMachine) {
+	s.clickModelMutex.Lock()
+	defer s.clickModelMutex.Unlock()
+	s.clickModel = clickModel
+}
+
+// getClickModel returns the click model. Nil is returned if there is no valid click model.
+func (s *RestServer) getClickModel() click.FactorizationMachine {
+	s.clickModelMutex.RLock()
+	defer s.clickModelMutex.RUnlock()
+	if s.clickModel == nil || s.clickModel.Invalid() {
+		return nil
+	}
+	return s.clickModel
 }
 
 // StartHttpServer starts the REST-ful API server.
@@ -112,6 +146,13 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("cursor", "cursor for next page").DataType("string")).
 		Writes(UserIterator{}))
 	// Delete a user
+	ws.Route(ws.PATCH("/user/{user-id}").To(s.patchUser).
+		Doc("Update a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Reads(UserPatch{}).
+		Writes(Success{}))
 	ws.Route(ws.DELETE("/user/{user-id}").To(s.deleteUser).
 		Doc("Delete a user.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
@@ -147,6 +188,13 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
 		Reads([]data.Item{}))
 	// Delete item
+	ws.Route(ws.PATCH("/item/{item-id}").To(s.patchItem).
+		Doc("Update an item. Cached popular, latest and trending items of affected labels are updated.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"item"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("item-id", "identifier of the item").DataType("string")).
+		Reads(ItemPatch{}).
+		Writes(Success{}))
 	ws.Route(ws.DELETE("/item/{item-id}").To(s.deleteItem).
 		Doc("Delete a item.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"item"}).
@@ -160,6 +208,18 @@ func (s *RestServer) CreateWebService() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"feedback"}).
 		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
 		Reads([]data.Feedback{}))
+	// Insert feedback in stream
+	ws.Route(ws.POST("/feedback/stream").To(s.streamFeedback).
+		Doc("Insert feedback in newline delimited JSON. Responds 429 if the data store falls behind.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"feedback"}).
+		Consumes(MIME_NDJSON, restful.MIME_JSON).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Reads(Feedback{}).
+		Writes(IngestSummary{}).
+		Returns(http.StatusOK, "OK", IngestSummary{}).
+		Returns(http.StatusBadRequest, "Line too long", IngestSummary{}).
+		Returns(http.StatusTooManyRequests, "Data store falls behind", IngestSummary{}).
+		Returns(http.StatusInternalServerError, "Failed to insert feedback", IngestSummary{}))
 	// Get feedback
 	ws.Route(ws.GET("/feedback").To(s.getFeedback).
 		Doc("Get multiple feedback.").
@@ -279,6 +339,22 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
 		Writes([]string{}))
+	// Get trending items
+	ws.Route(ws.GET("/trending").To(s.getTrending).
+		Doc("get trending items").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
+		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
+		Writes([]cache.ScoredItem{}))
+	ws.Route(ws.GET("/trending/{label}").To(s.getLabelTrending).
+		Doc("get trending items").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("label", "label of items").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
+		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
+		Writes([]cache.ScoredItem{}))
 	// Get neighbors
 	ws.Route(ws.GET("/neighbors/{item-id}").To(s.getNeighbors).
 		Doc("get neighbors of a item").
@@ -288,12 +364,30 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
 		Writes([]string{}))
+	ws.Route(ws.GET("/user/{user-id}/neighbors").To(s.getUserNeighbors).
+		Doc("get neighbors of a user").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned users").DataType("int")).
+		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
+		Writes([]cache.ScoredItem{}))
 	ws.Route(ws.GET("/recommend/{user-id}").To(s.getRecommend).
 		Doc("Get recommendation for user.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
 		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
 		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
 		Param(ws.QueryParameter("write-back", "write recommendation back to feedback").DataType("string")).
+		Param(ws.QueryParameter("explain", "return scores, stages and reasons of recommended items").DataType("boolean")).
+		Param(ws.QueryParameter("include-label", "recommend items with any of these labels").DataType("string").AllowMultiple(true)).
+		Param(ws.QueryParameter("exclude-label", "don't recommend items with any of these labels").DataType("string").AllowMultiple(true)).
+		Param(ws.QueryParameter("begin-time", "recommend items created after this time").DataType("string")).
+		Param(ws.QueryParameter("end-time", "recommend items created before this time").DataType("string")).
+		Param(ws.QueryParameter("attribute", "recommend items with categorical attributes in the format of name:value").DataType("string").AllowMultiple(true)).
+		Param(ws.QueryParameter("min-attribute", "recommend items with numeric or timestamp attributes not less than name:value").DataType("string").AllowMultiple(true)).
+		Param(ws.QueryParameter("max-attribute", "recommend items with numeric or timestamp attributes not greater than name:value").DataType("string").AllowMultiple(true)).
+		Param(ws.QueryParameter("exclude-item", "don't recommend these items").DataType("string").AllowMultiple(true)).
+		Param(ws.QueryParameter("context", "re-rank items by the click model in this context").DataType("string").AllowMultiple(true)).
 		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
 		Writes([]string{}))
 
@@ -332,7 +426,7 @@ func (s *RestServer) getList(prefix, name string, request *restful.Request, resp
 	}
 	end = begin + n - 1
 	// Get the popular list
-	items, err := s.CacheClient.GetScores(prefix, name, begin, end)
+	items, err := cache.GetItemScores(s.CacheClient, prefix, name, begin, end)
 	if err != nil {
 		InternalServerError(response, err)
 		return
@@ -341,6 +435,52 @@ func (s *RestServer) getList(prefix, name string, request *restful.Request, resp
 	Ok(response, items)
 }
 
+// getItemList gets a list of items without hidden items and unavailable items. These items are removed before
+// pagination.
+func (s *RestServer) getItemList(prefix, name string, request *restful.Request, response *restful.Response) {
+	var n, begin int
+	var err error
+	// read arguments
+	if begin, err = ParseInt(request, "offset", 0); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	if n, err = ParseInt(request, "n", s.GorseConfig.Server.DefaultN); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	unavailableItems, err := cache.UnavailableItems(s.CacheClient, time.Now())
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	if unavailableItems.IsEmpty() {
+		s.getList(prefix, name, request, response)
+		return
+	}
+	// Get the whole list and remove hidden items and unavailable items
+	items, err := cache.GetItemScores(s.CacheClient, prefix, name, 0, -1)
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	visibleItems := make([]cache.ScoredItem, 0, len(items))
+	for _, item := range items {
+		if !unavailableItems.Has(item.ItemId) {
+			visibleItems = append(visibleItems, item)
+		}
+	}
+	// Send result
+	if begin > len(visibleItems) {
+		begin = len(visibleItems)
+	}
+	end := len(visibleItems)
+	if n > 0 && begin+n < end {
+		end = begin + n
+	}
+	Ok(response, visibleItems[begin:end])
+}
+
 // getPopular gets popular items from database.
 func (s *RestServer) getPopular(request *restful.Request, response *restful.Response) {
 	// Authorize
@@ -348,7 +488,7 @@ func (s *RestServer) getPopular(request *restful.Request, response *restful.Resp
 		return
 	}
 	base.Logger().Debug("get popular items")
-	s.getList(cache.PopularItems, "", request, response)
+	s.getItemList(cache.PopularItems, "", request, response)
 }
 
 func (s *RestServer) getLatest(request *restful.Request, response *restful.Response) {
@@ -357,7 +497,7 @@ func (s *RestServer) getLatest(request *restful.Request, response *restful.Respo
 		return
 	}
 	base.Logger().Debug("get latest items")
-	s.getList(cache.LatestItems, "", request, response)
+	s.getItemList(cache.LatestItems, "", request, response)
 }
 
 func (s *RestServer) getLabelPopular(request *restful.Request, response *restful.Response) {
@@ -367,7 +507,7 @@ func (s *RestServer) getLabelPopular(request *restful.Request, response *restful
 	}
 	label := request.PathParameter("label")
 	base.Logger().Debug("get label popular items", zap.String("label", label))
-	s.getList(cache.PopularItems, label, request, response)
+	s.getItemList(cache.PopularItems, label, request, response)
 }
 
 func (s *RestServer) getLabelLatest(request *restful.Request, response *restful.Response) {
@@ -377,7 +517,27 @@ func (s *RestServer) getLabelLatest(request *restful.Request, response *restful.
 	}
 	label := request.PathParameter("label")
 	base.Logger().Debug("get label latest items", zap.String("label", label))
-	s.getList(cache.LatestItems, label, request, response)
+	s.getItemList(cache.LatestItems, label, request, response)
+}
+
+// getTrending gets trending items from database.
+func (s *RestServer) getTrending(request *restful.Request, response *restful.Response) {
+	// Authorize
+	if !s.auth(request, response) {
+		return
+	}
+	base.Logger().Debug("get trending items")
+	s.getItemList(cache.TrendingItems, "", request, response)
+}
+
+func (s *RestServer) getLabelTrending(request *restful.Request, response *restful.Response) {
+	// Authorize
+	if !s.auth(request, response) {
+		return
+	}
+	label := request.PathParameter("label")
+	base.Logger().Debug("get label trending items", zap.String("label", label))
+	s.getItemList(cache.TrendingItems, label, request, response)
 }
 
 // get feedback by item-id with feedback type
@@ -419,7 +579,18 @@ func (s *RestServer) getNeighbors(request *restful.Request, response *restful.Re
 	}
 	// Get item id
 	itemId := request.PathParameter("item-id")
-	s.getList(cache.SimilarItems, itemId, request, response)
+	s.getItemList(cache.SimilarItems, itemId, request, response)
+}
+
+// getUserNeighbors gets neighbors of a user from database.
+func (s *RestServer) getUserNeighbors(request *restful.Request, response *restful.Response) {
+	// Authorize
+	if !s.auth(request, response) {
+		return
+	}
+	// Get user id
+	userId := request.PathParameter("user-id")
+	s.getList(cache.SimilarUsers, userId, request, response)
 }
 
 // getSubscribe gets subscribed items of a user from database.
@@ -430,7 +601,7 @@ func (s *RestServer) getSubscribe(request *restful.Request, response *restful.Re
 	}
 	// Get user id
 	userId := request.PathParameter("user-id")
-	s.getList(cache.SubscribeItems, userId, request, response)
+	s.getItemList(cache.SubscribeItems, userId, request, response)
 }
 
 // getCollaborative gets cached recommended items from database.
@@ -441,142 +612,152 @@ func (s *RestServer) getCollaborative(request *restful.Request, response *restfu
 	}
 	// Get user id
 	userId := request.PathParameter("user-id")
-	s.getList(cache.RecommendItems, userId, request, response)
+	s.getItemList(cache.RecommendItems, userId, request, response)
 }
 
-// Recommend items to users.
+// ExplainedItem is a recommended item with its score, the stage it came from and history items contributed to it.
+type ExplainedItem struct {
+	ItemId  string
+	Score   float32
+	Stage   string
+	Because []string `json:",omitempty"`
+}
+
+// Recommend items to users. Items are collected by stages of the recommendation pipeline in order. By default:
 // 1. If there are recommendations in cache, return cached recommendations.
 // 2. If there are historical interactions of the users, return similar items.
 // 3. Otherwise, return fallback recommendation (popular/latest).
 func (s *RestServer) Recommend(userId string, n int) ([]string, error) {
-	var err error
-	var knnTime, fallbackTime, loadArchReadTime, removeReadTime time.Duration
-
-	// 1. read recommendations in cache.
-	start := time.Now()
-	itemsChan := make(chan []string, 1)
-	errChan := make(chan error, 1)
-	go func() {
-		var collaborativeFilteringItems []cache.ScoredItem
-		collaborativeFilteringItems, err = s.CacheClient.GetScores(cache.RecommendItems, userId, 0, s.GorseConfig.Database.CacheSize)
-		if err != nil {
-			itemsChan <- nil
-			errChan <- err
-		} else {
-			itemsChan <- cache.RemoveScores(collaborativeFilteringItems)
-			errChan <- nil
-			if len(collaborativeFilteringItems) == 0 {
-				base.Logger().Warn("empty collaborative filtering", zap.String("user_id", userId))
-			}
-		}
-	}()
+	ctx, err := s.NewRecommendContext(userId)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.recommend(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]string, len(items))
+	for i, item := range items {
+		results[i] = item.ItemId
+	}
+	return results, nil
+}
 
-	// 0. load ignore items
-	loadCachedReadStart := time.Now()
-	ignoreItems, err := s.CacheClient.GetList(cache.IgnoreItems, userId)
-	excludeSet := set.NewStringSet()
-	for _, item := range ignoreItems {
-		excludeSet.Add(item)
+// RecommendWithExplanation recommends items to users as Recommend but returns scores, stages and history
+// items contributed to recommended items as well.
+func (s *RestServer) RecommendWithExplanation(userId string, n int) ([]ExplainedItem, error) {
+	ctx, err := s.NewRecommendContext(userId)
+	if err != nil {
+		return nil, err
 	}
-	loadCachedReadTime := time.Since(loadCachedReadStart)
+	ctx.Explain = true
+	return s.recommend(ctx, n)
+}
 
-	// *. remove ignore items
-	items := <-itemsChan
-	err = <-errChan
+func (s *RestServer) recommend(ctx *RecommendContext, n int) ([]ExplainedItem, error) {
+	start := time.Now()
+	stages, err := s.RecommendPipeline(ctx, n)
 	if err != nil {
 		return nil, err
 	}
-	results := make([]string, 0, len(items))
-	removeReadStart := time.Now()
-	for _, itemId := range items {
-		if !excludeSet.Has(itemId) {
-			results = append(results, itemId)
+	results := make([]ExplainedItem, 0, n)
+	fields := make([]zap.Field, 0, len(stages)*2+1)
+	for _, stage := range stages {
+		for _, item := range stage.Items {
+			results = append(results, ExplainedItem{
+				ItemId:  item.ItemId,
+				Score:   item.Score,
+				Stage:   stage.Stage,
+				Because: ctx.Reasons(item.ItemId),
+			})
 		}
+		fields = append(fields,
+			zap.Int(fmt.Sprintf("num_from_%s", stage.Stage), len(stage.Items)),
+			zap.Duration(fmt.Sprintf("%s_time", stage.Stage), stage.Time))
 	}
-	removeReadTime += time.Since(removeReadStart)
-	numFromCache := len(results)
+	if results, err = s.rerankByContext(ctx, results); err != nil {
+		return nil, err
+	}
+	fields = append(fields, zap.Duration("total_time", time.Since(start)))
+	base.Logger().Info("complete recommendation", fields...)
+	return results, nil
+}
 
-	// 2. return similar items
-	if len(results) < n {
-		// load historical feedback
-		loadArchReadStart := time.Now()
-		userFeedback, err := s.DataClient.GetUserFeedback(userId)
+// parseRecommendFilter parses the filter of recommended items from query parameters.
+func parseRecommendFilter(request *restful.Request) (*RecommendFilter, error) {
+	filter := &RecommendFilter{
+		IncludeLabels: request.QueryParameters("include-label"),
+		ExcludeLabels: request.QueryParameters("exclude-label"),
+	}
+	if beginTime := request.QueryParameter("begin-time"); beginTime != "" {
+		t, err := dateparse.ParseAny(beginTime)
 		if err != nil {
 			return nil, err
 		}
-		for _, feedback := range userFeedback {
-			excludeSet.Add(feedback.ItemId)
+		filter.BeginTime = &t
+	}
+	if endTime := request.QueryParameter("end-time"); endTime != "" {
+		t, err := dateparse.ParseAny(endTime)
+		if err != nil {
+			return nil, err
 		}
-		loadArchReadTime = time.Since(loadArchReadStart)
-		knnStart := time.Now()
-		// collect candidates
-		candidates := make(map[string]float32)
-		for _, feedback := range userFeedback {
-			// load similar items
-			similarItems, err := s.CacheClient.GetScores(cache.SimilarItems, feedback.ItemId, 0, s.GorseConfig.Database.CacheSize)
-			if err != nil {
-				return nil, err
-			}
-			// add unseen items
-			removeReadStart = time.Now()
-			for _, item := range similarItems {
-				if !excludeSet.Has(item.ItemId) {
-					candidates[item.ItemId] += item.Score
-				}
-			}
-			removeReadTime += time.Since(removeReadStart)
+		filter.EndTime = &t
+	}
+	for _, condition := range request.QueryParameters("attribute") {
+		name, value, err := parseAttributeCondition(condition)
+		if err != nil {
+			return nil, err
 		}
-		// collect top k
-		k := n - len(results)
-		filter := base.NewTopKStringFilter(k)
-		for id, score := range candidates {
-			filter.Push(id, score)
+		if filter.Categorical == nil {
+			filter.Categorical = make(map[string][]string)
 		}
-		ids, _ := filter.PopAll()
-		results = append(results, ids...)
-		knnTime = time.Since(knnStart)
-	}
-	numFromKNN := len(results) - numFromCache
-
-	// 3. return fallback recommendation
-	if len(results) < n {
-		fallbackStart := time.Now()
-		var fallbacks []cache.ScoredItem
-		switch s.GorseConfig.Recommend.FallbackRecommend {
-		case "latest":
-			fallbacks, err = s.CacheClient.GetScores(cache.LatestItems, "", 0, s.GorseConfig.Database.CacheSize)
-		case "popular":
-			fallbacks, err = s.CacheClient.GetScores(cache.PopularItems, "", 0, s.GorseConfig.Database.CacheSize)
-		default:
-			return nil, fmt.Errorf("unknown fallback recommendation method `%s`", s.GorseConfig.Recommend.FallbackRecommend)
+		filter.Categorical[name] = append(filter.Categorical[name], value)
+	}
+	for _, condition := range request.QueryParameters("min-attribute") {
+		if err := parseRangeCondition(condition, &filter.MinNumeric, &filter.MinTime); err != nil {
+			return nil, err
 		}
-		removeReadStart = time.Now()
-		for _, item := range fallbacks {
-			if !excludeSet.Has(item.ItemId) {
-				results = append(results, item.ItemId)
-			}
+	}
+	for _, condition := range request.QueryParameters("max-attribute") {
+		if err := parseRangeCondition(condition, &filter.MaxNumeric, &filter.MaxTime); err != nil {
+			return nil, err
 		}
-		removeReadTime += time.Since(removeReadStart)
-		fallbackTime = time.Since(fallbackStart)
-	}
-	numFromFallback := len(results) - numFromKNN - numFromCache
-
-	// return recommendations
-	if len(results) > n {
-		results = results[:n]
-	}
-	spent := time.Since(start)
-	base.Logger().Info("complete recommendation",
-		zap.Int("num_from_cache", numFromCache),
-		zap.Int("num_from_knn", numFromKNN),
-		zap.Int("num_from_fallback", numFromFallback),
-		zap.Duration("load_cache_read_time", loadCachedReadTime),
-		zap.Duration("load_arch_read_time", loadArchReadTime),
-		zap.Duration("remove_read_time", removeReadTime),
-		zap.Duration("knn_time", knnTime),
-		zap.Duration("fallback_time", fallbackTime),
-		zap.Duration("total_time", spent))
-	return results, nil
+	}
+	return filter, nil
+}
+
+// parseAttributeCondition splits an attribute condition in the format of "name:value".
+func parseAttributeCondition(condition string) (string, string, error) {
+	splits := strings.SplitN(condition, ":", 2)
+	if len(splits) != 2 || splits[0] == "" {
+		return "", "", fmt.Errorf("invalid attribute condition `%v`", condition)
+	}
+	return splits[0], splits[1], nil
+}
+
+// parseRangeCondition parses a range condition. A number bounds a numeric attribute and anything else is parsed
+// as a time bounding a timestamp attribute.
+func parseRangeCondition(condition string, numeric *map[string]float32, timestamp *map[string]time.Time) error {
+	name, value, err := parseAttributeCondition(condition)
+	if err != nil {
+		return err
+	}
+	if number, err := strconv.ParseFloat(value, 32); err == nil {
+		if *numeric == nil {
+			*numeric = make(map[string]float32)
+		}
+		(*numeric)[name] = float32(number)
+		return nil
+	}
+	t, err := dateparse.ParseAny(value)
+	if err != nil {
+		return err
+	}
+	if *timestamp == nil {
+		*timestamp = make(map[string]time.Time)
+	}
+	(*timestamp)[name] = t
+	return nil
 }
 
 func (s *RestServer) getRecommend(request *restful.Request, response *restful.Response) {
@@ -592,11 +773,27 @@ func (s *RestServer) getRecommend(request *restful.Request, response *restful.Re
 		return
 	}
 	writeBackFeedback := request.QueryParameter("write-back")
-	results, err := s.Recommend(userId, n)
+	ctx, err := s.NewRecommendContext(userId)
 	if err != nil {
 		InternalServerError(response, err)
 		return
 	}
+	ctx.Explain = request.QueryParameter("explain") == "true"
+	ctx.ContextLabels = request.QueryParameters("context")
+	ctx.ExcludeItems(request.QueryParameters("exclude-item")...)
+	if ctx.Filter, err = parseRecommendFilter(request); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	items, err := s.recommend(ctx, n)
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	results := make([]string, len(items))
+	for i, item := range items {
+		results[i] = item.ItemId
+	}
 	// write back
 	if writeBackFeedback != "" {
 		for _, itemId := range results {
@@ -623,7 +820,11 @@ func (s *RestServer) getRecommend(request *restful.Request, response *restful.Re
 		}
 	}
 	// Send result
-	Ok(response, results)
+	if ctx.Explain {
+		Ok(response, items)
+	} else {
+		Ok(response, results)
+	}
 }
 
 // Success is the returned data structure for data insert operations.
@@ -642,6 +843,10 @@ func (s *RestServer) insertUser(request *restful.Request, response *restful.Resp
 		BadRequest(response, err)
 		return
 	}
+	if err := temp.Attributes.Validate(); err != nil {
+		BadRequest(response, err)
+		return
+	}
 	if err := s.DataClient.InsertUser(temp); err != nil {
 		InternalServerError(response, err)
 		return
@@ -649,6 +854,65 @@ func (s *RestServer) insertUser(request *restful.Request, response *restful.Resp
 	Ok(response, Success{RowAffected: 1})
 }
 
+// UserPatch is the data structure to update a user. Fields not set are unchanged.
+type UserPatch struct {
+	Labels     []string
+	Subscribe  []string
+	Comment    *string
+	Attributes *data.Attributes
+}
+
+func (s *RestServer) patchUser(request *restful.Request, response *restful.Response) {
+	// authorize
+	if !s.auth(request, response) {
+		return
+	}
+	userId := request.PathParameter("user-id")
+	var patch UserPatch
+	if err := request.ReadEntity(&patch); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	// get user
+	user, err := s.DataClient.GetUser(userId)
+	if err != nil {
+		if err == data.ErrUserNotExist {
+			PageNotFound(response, err)
+		} else {
+			InternalServerError(response, err)
+		}
+		return
+	}
+	// apply patch
+	if patch.Labels != nil {
+		for _, label := range patch.Labels {
+			if err = base.ValidateLabel(label); err != nil {
+				BadRequest(response, err)
+				return
+			}
+		}
+		user.Labels = patch.Labels
+	}
+	if patch.Subscribe != nil {
+		user.Subscribe = patch.Subscribe
+	}
+	if patch.Comment != nil {
+		user.Comment = *patch.Comment
+	}
+	if patch.Attributes != nil {
+		if err = patch.Attributes.Validate(); err != nil {
+			BadRequest(response, err)
+			return
+		}
+		user.Attributes = *patch.Attributes
+	}
+	if err = s.DataClient.InsertUser(user); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	Ok(response, Success{RowAffected: 1})
+}
+
 func (s *RestServer) getUser(request *restful.Request, response *restful.Response) {
 	// Authorize
 	if !s.auth(request, response) {
@@ -683,6 +947,10 @@ func (s *RestServer) insertUsers(request *restful.Request, response *restful.Res
 	var count int
 	// range temp and achieve user
 	for _, user := range *temp {
+		if err := user.Attributes.Validate(); err != nil {
+			BadRequest(response, err)
+			return
+		}
 		if err := s.DataClient.InsertUser(user); err != nil {
 			InternalServerError(response, err)
 			return
@@ -765,10 +1033,47 @@ func (s *RestServer) getFeedbackByUser(request *restful.Request, response *restf
 
 // Item is the data structure for the item but stores the timestamp using string.
 type Item struct {
-	ItemId    string
-	Timestamp string
-	Labels    []string
-	Comment   string
+	ItemId     string
+	Timestamp  string
+	Labels     []string
+	Comment    string
+	IsHidden   bool
+	PublishAt  string `json:",omitempty"`
+	ExpireAt   string `json:",omitempty"`
+	Attributes data.Attributes
+}
+
+// parseItem parses datetime fields and validates attributes of an item. The publish time and the expire time are
+// optional.
+func parseItem(literal Item) (data.Item, error) {
+	item := data.Item{ItemId: literal.ItemId, Labels: literal.Labels, Comment: literal.Comment, IsHidden: literal.IsHidden,
+		Attributes: literal.Attributes}
+	err := item.Attributes.Validate()
+	if err != nil {
+		return data.Item{}, err
+	}
+	if item.Timestamp, err = dateparse.ParseAny(literal.Timestamp); err != nil {
+		return data.Item{}, err
+	}
+	if item.PublishAt, err = parseOptionalTime(literal.PublishAt); err != nil {
+		return data.Item{}, err
+	}
+	if item.ExpireAt, err = parseOptionalTime(literal.ExpireAt); err != nil {
+		return data.Item{}, err
+	}
+	return item, nil
+}
+
+// parseOptionalTime parses a datetime. Nil is returned for an empty string.
+func parseOptionalTime(literal string) (*time.Time, error) {
+	if literal == "" {
+		return nil, nil
+	}
+	t, err := dateparse.ParseAny(literal)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
 func (s *RestServer) insertItems(request *restful.Request, response *restful.Response) {
@@ -782,21 +1087,31 @@ func (s *RestServer) insertItems(request *restful.Request, response *restful.Res
 		BadRequest(response, err)
 		return
 	}
-	// Insert items
-	var count int
-	for _, item := range items {
-		// parse datetime
-		timestamp, err := dateparse.ParseAny(item.Timestamp)
-		if err != nil {
+	// Parse items
+	parsed := make([]data.Item, len(items))
+	for i, literal := range items {
+		var err error
+		if parsed[i], err = parseItem(literal); err != nil {
 			BadRequest(response, err)
 			return
 		}
-		err = s.DataClient.InsertItem(data.Item{ItemId: item.ItemId, Timestamp: timestamp, Labels: item.Labels, Comment: item.Comment})
-		count++
-		if err != nil {
-			InternalServerError(response, err)
-			return
+	}
+	// Insert items
+	var count int
+	var err error
+	for _, item := range parsed {
+		if err = s.DataClient.InsertItem(item); err != nil {
+			break
 		}
+		count++
+	}
+	// update item sets of inserted items at once
+	if setErr := s.updateItemSets(parsed[:count]...); err == nil {
+		err = setErr
+	}
+	if err != nil {
+		InternalServerError(response, err)
+		return
 	}
 	Ok(response, Success{RowAffected: count})
 }
@@ -806,25 +1121,235 @@ func (s *RestServer) insertItem(request *restful.Request, response *restful.Resp
 	if !s.auth(request, response) {
 		return
 	}
-	item := new(Item)
+	literal := new(Item)
 	var err error
-	if err = request.ReadEntity(item); err != nil {
+	if err = request.ReadEntity(literal); err != nil {
 		BadRequest(response, err)
 		return
 	}
 	// parse datetime
-	timestamp, err := dateparse.ParseAny(item.Timestamp)
+	item, err := parseItem(*literal)
 	if err != nil {
 		BadRequest(response, err)
 		return
 	}
-	if err = s.DataClient.InsertItem(data.Item{ItemId: item.ItemId, Timestamp: timestamp, Labels: item.Labels, Comment: item.Comment}); err != nil {
+	if err = s.DataClient.InsertItem(item); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	if err = s.updateItemSets(item); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	Ok(response, Success{RowAffected: 1})
+}
+
+// ItemPatch is the data structure to update an item. Fields not set are unchanged. The publish time or the
+// expire time is removed if it's set to an empty string. Attributes are replaced as a whole.
+type ItemPatch struct {
+	IsHidden   *bool
+	Labels     []string
+	Timestamp  *string
+	Comment    *string
+	PublishAt  *string
+	ExpireAt   *string
+	Attributes *data.Attributes
+}
+
+func (s *RestServer) patchItem(request *restful.Request, response *restful.Response) {
+	// authorize
+	if !s.auth(request, response) {
+		return
+	}
+	itemId := request.PathParameter("item-id")
+	var patch ItemPatch
+	if err := request.ReadEntity(&patch); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	// get item
+	item, err := s.DataClient.GetItem(itemId)
+	if err != nil {
+		if err == data.ErrItemNotExist {
+			PageNotFound(response, err)
+		} else {
+			InternalServerError(response, err)
+		}
+		return
+	}
+	// apply patch
+	patched := item
+	if patch.IsHidden != nil {
+		patched.IsHidden = *patch.IsHidden
+	}
+	if patch.Labels != nil {
+		for _, label := range patch.Labels {
+			if err = base.ValidateLabel(label); err != nil {
+				BadRequest(response, err)
+				return
+			}
+		}
+		patched.Labels = patch.Labels
+	}
+	if patch.Timestamp != nil {
+		if patched.Timestamp, err = dateparse.ParseAny(*patch.Timestamp); err != nil {
+			BadRequest(response, err)
+			return
+		}
+	}
+	if patch.Comment != nil {
+		patched.Comment = *patch.Comment
+	}
+	if patch.PublishAt != nil {
+		if patched.PublishAt, err = parseOptionalTime(*patch.PublishAt); err != nil {
+			BadRequest(response, err)
+			return
+		}
+	}
+	if patch.ExpireAt != nil {
+		if patched.ExpireAt, err = parseOptionalTime(*patch.ExpireAt); err != nil {
+			BadRequest(response, err)
+			return
+		}
+	}
+	if patch.Attributes != nil {
+		if err = patch.Attributes.Validate(); err != nil {
+			BadRequest(response, err)
+			return
+		}
+		patched.Attributes = *patch.Attributes
+	}
+	if err = s.DataClient.InsertItem(patched); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	if err = s.updateItemCache(item, patched); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	if err = s.updateItemSets(patched); err != nil {
 		InternalServerError(response, err)
 		return
 	}
 	Ok(response, Success{RowAffected: 1})
 }
 
+// updateItemCache updates cached popular, latest and trending items of labels affected by an item change. The item
+// is removed from lists of labels it no longer has, or all lists if it's hidden except popular and trending lists of
+// all items, which keep scores for the item to be shown again until lists are updated by the master. Hidden items in
+// these lists are filtered when read. Otherwise, the item is added to popular and trending lists of new labels with
+// its score in the list of all items, and its score in latest lists is updated by its publish time. Lists are sorted
+// sets, so only the item is added or removed.
+func (s *RestServer) updateItemCache(item, patched data.Item) error {
+	// hidden items aren't in lists of labels
+	oldLabels := strset.New()
+	if !item.IsHidden {
+		oldLabels.Add(item.Labels...)
+		oldLabels.Add("")
+	}
+	newLabels := strset.New()
+	if !patched.IsHidden {
+		newLabels.Add(patched.Labels...)
+		newLabels.Add("")
+	}
+	labels := strset.Union(oldLabels, newLabels).List()
+	for _, prefix := range []string{cache.PopularItems, cache.TrendingItems, cache.LatestItems} {
+		var score float64
+		var exist bool
+		if prefix == cache.LatestItems {
+			// round the publish time as scores of latest items written by the master
+			publishTime := patched.PublishTime()
+			score, exist = float64(float32(publishTime.Unix())), !publishTime.IsZero()
+		} else {
+			var err error
+			score, err = s.CacheClient.GetSortedScore(prefix, "", patched.ItemId)
+			if err != nil && err != cache.ErrObjectNotExist {
+				return err
+			}
+			exist = err == nil
+		}
+		for _, label := range labels {
+			var err error
+			if prefix != cache.LatestItems && label == "" {
+				// scores of all items are kept
+				continue
+			} else if !newLabels.Has(label) || (prefix == cache.LatestItems && !exist) {
+				err = s.CacheClient.RemSorted(prefix, label, patched.ItemId)
+			} else if exist && (prefix == cache.LatestItems || !oldLabels.Has(label)) {
+				err = s.addToList(prefix, label, patched.ItemId, score)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addToList adds an item to a cached list with a score. The list is truncated to the cache size.
+func (s *RestServer) addToList(prefix, name, itemId string, score float64) error {
+	if err := s.CacheClient.AddSorted(prefix, name, map[string]float64{itemId: score}); err != nil {
+		return err
+	}
+	if s.GorseConfig.Database.CacheSize > 0 {
+		return s.CacheClient.TrimSorted(prefix, name, s.GorseConfig.Database.CacheSize)
+	}
+	return nil
+}
+
+// updateItemSets updates whether items are hidden, to be published or to be expired in the cache. Changes of all
+// items are collected and applied once for each set. Members are added to or removed from sets atomically, so sets
+// are never cleared while being served.
+func (s *RestServer) updateItemSets(items ...data.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var hiddenItems, shownItems, publishedItems, notExpiringItems []string
+	unpublishedItems := make(map[string]float64)
+	expiringItems := make(map[string]float64)
+	updated := strset.New()
+	for i := len(items) - 1; i >= 0; i-- {
+		// the last update of an item wins
+		item := items[i]
+		if updated.Has(item.ItemId) {
+			continue
+		}
+		updated.Add(item.ItemId)
+		if item.IsHidden || item.IsExpired(now) {
+			hiddenItems = append(hiddenItems, item.ItemId)
+		} else {
+			shownItems = append(shownItems, item.ItemId)
+		}
+		if item.PublishAt != nil && now.Before(*item.PublishAt) {
+			unpublishedItems[item.ItemId] = cache.TimeScore(*item.PublishAt)
+		} else {
+			publishedItems = append(publishedItems, item.ItemId)
+		}
+		if item.ExpireAt != nil && !item.IsExpired(now) {
+			expiringItems[item.ItemId] = cache.TimeScore(*item.ExpireAt)
+		} else {
+			notExpiringItems = append(notExpiringItems, item.ItemId)
+		}
+	}
+	if err := s.CacheClient.AddSet(cache.HiddenItems, "", hiddenItems...); err != nil {
+		return err
+	}
+	if err := s.CacheClient.RemSet(cache.HiddenItems, "", shownItems...); err != nil {
+		return err
+	}
+	if err := s.CacheClient.AddSorted(cache.UnpublishedItems, "", unpublishedItems); err != nil {
+		return err
+	}
+	if err := s.CacheClient.RemSorted(cache.UnpublishedItems, "", publishedItems...); err != nil {
+		return err
+	}
+	if err := s.CacheClient.AddSorted(cache.ExpiringItems, "", expiringItems); err != nil {
+		return err
+	}
+	return s.CacheClient.RemSorted(cache.ExpiringItems, "", notExpiringItems...)
+}
+
 // ItemIterator is the iterator for items.
 type ItemIterator struct {
 	Cursor string
@@ -880,6 +1405,10 @@ func (s *RestServer) deleteItem(request *restful.Request, response *restful.Resp
 		InternalServerError(response, err)
 		return
 	}
+	if err := s.updateItemSets(data.Item{ItemId: itemId}); err != nil {
+		InternalServerError(response, err)
+		return
+	}
 	Ok(response, Success{RowAffected: 1})
 }
 
@@ -887,9 +1416,24 @@ func (s *RestServer) deleteItem(request *restful.Request, response *restful.Resp
 type Feedback struct {
 	data.FeedbackKey
 	Timestamp string
+	Value     *float32 `json:",omitempty"` // optional graded value, null or absent means not set
+	Context   []string `json:",omitempty"`
 	Comment   string
 }
 
+// validateFeedbackValue checks whether the value of feedback is a positive finite number if it's set. The weight of
+// feedback is multiplied by its value, so negative values lead to negative confidences in training. Zero is rejected
+// since it's stored as an unset value, which doesn't change the weight of feedback.
+func validateFeedbackValue(value *float32) (float32, error) {
+	if value == nil {
+		return 0, nil
+	}
+	if math32.IsNaN(*value) || math32.IsInf(*value, 0) || *value <= 0 {
+		return 0, fmt.Errorf("invalid feedback value `%v` (positive finite number required)", *value)
+	}
+	return *value, nil
+}
+
 func (s *RestServer) insertFeedback(request *restful.Request, response *restful.Response) {
 	// authorize
 	if !s.auth(request, response) {
@@ -914,16 +1458,34 @@ func (s *RestServer) insertFeedback(request *restful.Request, response *restful.
 			BadRequest(response, err)
 			return
 		}
+		if feedback[i].Value, err = validateFeedbackValue((*feedbackLiterTime)[i].Value); err != nil {
+			BadRequest(response, err)
+			return
+		}
+		for _, label := range (*feedbackLiterTime)[i].Context {
+			if err = base.ValidateLabel(label); err != nil {
+				BadRequest(response, err)
+				return
+			}
+		}
+		feedback[i].Context = (*feedbackLiterTime)[i].Context
 	}
 	// insert feedback to data store
-	for _, v := range feedback {
-		err = s.DataClient.InsertFeedback(v,
-			s.GorseConfig.Database.AutoInsertUser,
-			s.GorseConfig.Database.AutoInsertItem)
-		if err != nil {
+	if s.FeedbackLog != nil {
+		if err = s.FeedbackLog.Append(feedback...); err != nil {
 			InternalServerError(response, err)
 			return
 		}
+	} else {
+		for _, v := range feedback {
+			err = s.DataClient.InsertFeedback(v,
+				s.GorseConfig.Database.AutoInsertUser,
+				s.GorseConfig.Database.AutoInsertItem)
+			if err != nil {
+				InternalServerError(response, err)
+				return
+			}
+		}
 	}
 	// insert feedback to cache store
 	if err = s.InsertFeedbackToCache(feedback); err != nil {
@@ -941,6 +1503,189 @@ func (s *RestServer) insertFeedback(request *restful.Request, response *restful.
 	Ok(response, Success{RowAffected: len(feedback)})
 }
 
+// MIME_NDJSON is the MIME type of newline delimited JSON.
+const MIME_NDJSON = "application/x-ndjson"
+
+// maxIngestErrors is the max number of errors reported in the summary of streaming ingestion.
+const maxIngestErrors = 1000
+
+// IngestSummary is the summary of streaming ingestion. If ingestion stops early, lines before StoppedAt have been
+// accepted or rejected and lines from StoppedAt should be sent again.
+type IngestSummary struct {
+	Accepted  int
+	Rejected  int
+	Errors    []IngestError
+	StoppedAt int    `json:",omitempty"` // the first line not ingested if ingestion stops early
+	Error     string `json:",omitempty"` // the reason why ingestion stops early
+}
+
+// IngestError is the error of a line in streaming ingestion.
+type IngestError struct {
+	Line  int
+	Error string
+}
+
+// reject records an invalid line.
+func (summary *IngestSummary) reject(line int, err error) {
+	summary.Rejected++
+	if len(summary.Errors) < maxIngestErrors {
+		summary.Errors = append(summary.Errors, IngestError{Line: line, Error: err.Error()})
+	}
+}
+
+// parseFeedback parses and validates a line of feedback in streaming ingestion.
+func parseFeedback(line []byte) (data.Feedback, error) {
+	var literal Feedback
+	if err := json.Unmarshal(line, &literal); err != nil {
+		return data.Feedback{}, err
+	}
+	if err := base.ValidateLabel(literal.FeedbackType); err != nil {
+		return data.Feedback{}, fmt.Errorf("invalid feedback type `%v` (%s)", literal.FeedbackType, err.Error())
+	}
+	if err := base.ValidateId(literal.UserId); err != nil {
+		return data.Feedback{}, fmt.Errorf("invalid user id `%v` (%s)", literal.UserId, err.Error())
+	}
+	if err := base.ValidateId(literal.ItemId); err != nil {
+		return data.Feedback{}, fmt.Errorf("invalid item id `%v` (%s)", literal.ItemId, err.Error())
+	}
+	for _, label := range literal.Context {
+		if err := base.ValidateLabel(label); err != nil {
+			return data.Feedback{}, fmt.Errorf("invalid context label `%v` (%s)", label, err.Error())
+		}
+	}
+	value, err := validateFeedbackValue(literal.Value)
+	if err != nil {
+		return data.Feedback{}, err
+	}
+	feedback := data.Feedback{FeedbackKey: literal.FeedbackKey, Value: value, Context: literal.Context, Comment: literal.Comment}
+	if feedback.Timestamp, err = dateparse.ParseAny(literal.Timestamp); err != nil {
+		return data.Feedback{}, fmt.Errorf("failed to parse datetime `%v`", literal.Timestamp)
+	}
+	return feedback, nil
+}
+
+// acquireIngestSlot waits for a slot to write a batch. False is returned if the data store falls behind.
+func (s *RestServer) acquireIngestSlot() bool {
+	s.ingestOnce.Do(func() {
+		s.ingestSlots = make(chan struct{}, s.GorseConfig.Server.IngestMaxPending)
+	})
+	select {
+	case s.ingestSlots <- struct{}{}:
+		return true
+	default:
+	}
+	timer := time.NewTimer(time.Duration(s.GorseConfig.Server.IngestTimeout) * time.Second)
+	defer timer.Stop()
+	select {
+	case s.ingestSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// releaseIngestSlot releases a slot after a batch is written.
+func (s *RestServer) releaseIngestSlot() {
+	<-s.ingestSlots
+}
+
+// insertFeedbackBatch writes a batch of feedback to the data store (or the feedback log if set) and the cache store.
+func (s *RestServer) insertFeedbackBatch(feedback []data.Feedback) error {
+	defer s.releaseIngestSlot()
+	if s.FeedbackLog != nil {
+		if err := s.FeedbackLog.Append(feedback...); err != nil {
+			return err
+		}
+	} else if err := s.DataClient.BatchInsertFeedback(feedback,
+		s.GorseConfig.Database.AutoInsertUser,
+		s.GorseConfig.Database.AutoInsertItem); err != nil {
+		return err
+	}
+	if err := s.InsertFeedbackToCache(feedback); err != nil {
+		return err
+	}
+	users := set.NewStringSet()
+	for _, v := range feedback {
+		users.Add(v.UserId)
+	}
+	for _, userId := range users.List() {
+		if err := s.CacheClient.SetString(cache.LastActiveTime, userId, base.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamFeedback inserts feedback in newline delimited JSON. Lines are parsed incrementally and written in batches.
+// Invalid lines are rejected and reported in the summary. If a batch can't be written in time since too many batches
+// are pending, the ingestion stops and responds 429 with the summary of lines before the batch.
+func (s *RestServer) streamFeedback(request *restful.Request, response *restful.Response) {
+	// authorize
+	if !s.auth(request, response) {
+		return
+	}
+	var summary IngestSummary
+	// stop responds the summary once ingestion stops at a line.
+	stop := func(code, lineNumber int, err error) {
+		base.Logger().Error("streaming ingestion stopped", zap.Int("line", lineNumber), zap.Error(err))
+		summary.StoppedAt = lineNumber
+		summary.Error = err.Error()
+		response.Header().Set("Access-Control-Allow-Origin", "*")
+		if err = response.WriteHeaderAndJson(code, summary, restful.MIME_JSON); err != nil {
+			base.Logger().Error("failed to write json", zap.Error(err))
+		}
+	}
+	batch := make([]data.Feedback, 0, s.GorseConfig.Server.IngestBatchSize)
+	batchStart := 0 // the line of the first feedback in the batch
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		if !s.acquireIngestSlot() {
+			response.Header().Set("Retry-After", strconv.Itoa(s.GorseConfig.Server.IngestTimeout))
+			stop(http.StatusTooManyRequests, batchStart, fmt.Errorf("data store falls behind"))
+			return false
+		}
+		if err := s.insertFeedbackBatch(batch); err != nil {
+			stop(http.StatusInternalServerError, batchStart, err)
+			return false
+		}
+		summary.Accepted += len(batch)
+		batch = batch[:0]
+		return true
+	}
+	scanner := bufio.NewScanner(request.Request.Body)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), 1024*1024)
+	lineNumber := 1
+	for ; scanner.Scan(); lineNumber++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		feedback, err := parseFeedback(line)
+		if err != nil {
+			summary.reject(lineNumber, err)
+			continue
+		}
+		if len(batch) == 0 {
+			batchStart = lineNumber
+		}
+		batch = append(batch, feedback)
+		if len(batch) >= s.GorseConfig.Server.IngestBatchSize && !flush() {
+			return
+		}
+	}
+	// feedback before the broken line is ingested
+	if !flush() {
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		stop(http.StatusBadRequest, lineNumber, err)
+		return
+	}
+	Ok(response, summary)
+}
+
 // FeedbackIterator is the iterator for feedback.
 type FeedbackIterator struct {
 	Cursor   string
@@ -1131,13 +1876,29 @@ func (s *RestServer) auth(request *restful.Request, response *restful.Response)
 	return false
 }
 
-// InsertFeedbackToCache inserts feedback to cache.
+// InsertFeedbackToCache inserts feedback to cache. Feedback is also recorded in the recent feedback of the user with
+// its type and time, which is truncated to the cache size.
 func (s *RestServer) InsertFeedbackToCache(feedback []data.Feedback) error {
+	now := time.Now()
 	for _, v := range feedback {
 		err := s.CacheClient.AppendList(cache.IgnoreItems, v.UserId, v.ItemId)
 		if err != nil {
 			return err
 		}
+		timestamp := v.Timestamp
+		if timestamp.IsZero() {
+			timestamp = now
+		}
+		err = s.CacheClient.AddSorted(cache.SessionFeedback, v.UserId, map[string]float64{
+			sessionMember(v.ItemId, v.FeedbackType): cache.TimeScore(timestamp),
+		})
+		if err != nil {
+			return err
+		}
+		err = s.CacheClient.TrimSorted(cache.SessionFeedback, v.UserId, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return err
+		}
 		err = s.CacheClient.IncrInt(cache.GlobalMeta, cache.NumInserted)
 		if err != nil {
 			return err
@@ -14,8 +14,11 @@
 package server
 
 import (
+	"bufio"
 	"encoding/json"
+	"math"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,6 +27,8 @@ import (
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 )
@@ -235,15 +240,182 @@ func TestServer_Items(t *testing.T) {
 		End()
 }
 
+func TestServer_PatchItem(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Database.CacheSize = 2
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := s.DataClient.InsertItem(data.Item{ItemId: "1", Timestamp: timestamp, Labels: []string{"a", "b"}})
+	assert.Nil(t, err)
+	// insert cached lists
+	err = s.CacheClient.SetSorted(cache.PopularItems, "", []cache.ScoredItem{{ItemId: "2", Score: 10}, {ItemId: "1", Score: 5}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.PopularItems, "a", []cache.ScoredItem{{ItemId: "1", Score: 5}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.PopularItems, "b", []cache.ScoredItem{{ItemId: "1", Score: 5}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.PopularItems, "c", []cache.ScoredItem{{ItemId: "3", Score: 8}, {ItemId: "4", Score: 2}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.LatestItems, "", []cache.ScoredItem{{ItemId: "1", Score: float32(timestamp.Unix())}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.LatestItems, "a", []cache.ScoredItem{{ItemId: "1", Score: float32(timestamp.Unix())}})
+	assert.Nil(t, err)
+	// update labels, timestamp and comment
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"Labels": ["b", "c"], "Timestamp": "2022-01-01", "Comment": "comment"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	item, err := s.DataClient.GetItem("1")
+	assert.Nil(t, err)
+	newTimestamp := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, data.Item{ItemId: "1", Timestamp: newTimestamp, Labels: []string{"b", "c"}, Comment: "comment"}, item)
+	popular, err := s.CacheClient.GetSortedScores(cache.PopularItems, "a", 0, -1)
+	assert.Nil(t, err)
+	assert.Empty(t, popular)
+	popular, err = s.CacheClient.GetSortedScores(cache.PopularItems, "b", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: 5}}, popular)
+	// lists are truncated to the cache size
+	popular, err = s.CacheClient.GetSortedScores(cache.PopularItems, "c", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "3", Score: 8}, {ItemId: "1", Score: 5}}, popular)
+	latest, err := s.CacheClient.GetSortedScores(cache.LatestItems, "a", 0, -1)
+	assert.Nil(t, err)
+	assert.Empty(t, latest)
+	latest, err = s.CacheClient.GetSortedScores(cache.LatestItems, "c", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: float32(newTimestamp.Unix())}}, latest)
+	// hide item
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"IsHidden": true}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	item, err = s.DataClient.GetItem("1")
+	assert.Nil(t, err)
+	assert.True(t, item.IsHidden)
+	assert.Equal(t, []string{"b", "c"}, item.Labels)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/popular/c").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{{ItemId: "3", Score: 8}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/popular").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{{ItemId: "2", Score: 10}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/latest").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{})).
+		End()
+	// show item again
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"IsHidden": false}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/popular").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{{ItemId: "2", Score: 10}, {ItemId: "1", Score: 5}})).
+		End()
+	popular, err = s.CacheClient.GetSortedScores(cache.PopularItems, "b", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: 5}}, popular)
+	popular, err = s.CacheClient.GetSortedScores(cache.PopularItems, "c", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "3", Score: 8}, {ItemId: "1", Score: 5}}, popular)
+	latest, err = s.CacheClient.GetSortedScores(cache.LatestItems, "", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: float32(newTimestamp.Unix())}}, latest)
+	// invalid label
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"Labels": ["a|b"]}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	// item not exist
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/2").
+		Header("X-API-Key", apiKey).
+		JSON(`{"IsHidden": true}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestServer_PatchUser(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	err := s.DataClient.InsertUser(data.User{UserId: "1", Labels: []string{"a"}, Subscribe: []string{"x"}, Comment: "comment"})
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/user/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"Labels": ["b", "c"]}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/user/1").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, data.User{UserId: "1", Labels: []string{"b", "c"}, Subscribe: []string{"x"}, Comment: "comment"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/user/2").
+		Header("X-API-Key", apiKey).
+		JSON(`{"Comment": "comment"}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
 func TestServer_Feedback(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
 	// Insert ret
 	feedback := []data.Feedback{
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}, Context: []string{"mobile"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}, Context: []string{"desktop", "night"}},
 		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "4"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "3", ItemId: "6"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "3", ItemId: "6"}, Value: 2.5},
 		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "4", ItemId: "8"}},
 	}
 	//BatchInsertFeedback
@@ -256,6 +428,17 @@ func TestServer_Feedback(t *testing.T) {
 		Status(http.StatusOK).
 		Body(`{"RowAffected": 5}`).
 		End()
+	// negative values and zero values are rejected
+	for _, value := range []float32{-1, 0} {
+		apitest.New().
+			Handler(s.handler).
+			Post("/api/feedback").
+			Header("X-API-Key", apiKey).
+			JSON([]Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "5", ItemId: "0"}, Value: &value}}).
+			Expect(t).
+			Status(http.StatusBadRequest).
+			End()
+	}
 	//Get Feedback
 	apitest.New().
 		Handler(s.handler).
@@ -324,6 +507,96 @@ func TestServer_Feedback(t *testing.T) {
 		End()
 }
 
+func TestServer_StreamFeedback(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Server.IngestBatchSize = 2
+	body := `{"FeedbackType":"click","UserId":"0","ItemId":"0","Timestamp":"2021-01-01"}
+{"FeedbackType":"click","UserId":"1","ItemId":"2","Timestamp":"2021-01-01"}
+
+{"FeedbackType":"click","UserId":"2/","ItemId":"4","Timestamp":"2021-01-01"}
+{"FeedbackType":"click|like","UserId":"3","ItemId":"6","Timestamp":"2021-01-01"}
+{"FeedbackType":"click","UserId":"4","ItemId":"8","Timestamp":"2021-01-01","Value":1.5}
+not json
+{"FeedbackType":"click","UserId":"5","ItemId":"8","Timestamp":"2021-01-01","Value":-1}
+{"FeedbackType":"click","UserId":"6","ItemId":"8","Timestamp":"2021-01-01","Value":0}
+`
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback/stream").
+		Header("X-API-Key", apiKey).
+		ContentType(MIME_NDJSON).
+		Body(body).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, IngestSummary{
+			Accepted: 3,
+			Rejected: 5,
+			Errors: []IngestError{
+				{Line: 4, Error: "invalid user id `2/` (id cannot contain `/`)"},
+				{Line: 5, Error: "invalid feedback type `click|like` (label cannot contain `|`)"},
+				{Line: 7, Error: "invalid character 'o' in literal null (expecting 'u')"},
+				{Line: 8, Error: "invalid feedback value `-1` (positive finite number required)"},
+				{Line: 9, Error: "invalid feedback value `0` (positive finite number required)"},
+			},
+		})).
+		End()
+	feedback, err := s.DataClient.GetUserFeedback("4")
+	assert.Nil(t, err)
+	assert.Equal(t, []data.Feedback{{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "4", ItemId: "8"},
+		Timestamp:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Value:       1.5,
+	}}, feedback)
+	ignored, err := s.CacheClient.GetList(cache.IgnoreItems, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2"}, ignored)
+	// data store falls behind
+	s.GorseConfig.Server.IngestTimeout = 0
+	for i := 0; i < s.GorseConfig.Server.IngestMaxPending; i++ {
+		assert.True(t, s.acquireIngestSlot())
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback/stream").
+		Header("X-API-Key", apiKey).
+		ContentType(MIME_NDJSON).
+		Body(body).
+		Expect(t).
+		Status(http.StatusTooManyRequests).
+		Header("Retry-After", "0").
+		Body(marshal(t, IngestSummary{StoppedAt: 1, Error: "data store falls behind"})).
+		End()
+	for i := 0; i < s.GorseConfig.Server.IngestMaxPending; i++ {
+		s.releaseIngestSlot()
+	}
+	// line is too long
+	body = `{"FeedbackType":"click","UserId":"7","ItemId":"0","Timestamp":"2021-01-01"}
+not json
+{"FeedbackType":"click","UserId":"7","ItemId":"1","Timestamp":"2021-01-01","Comment":"` + strings.Repeat("a", 1024*1024) + `"}
+{"FeedbackType":"click","UserId":"7","ItemId":"2","Timestamp":"2021-01-01"}
+`
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback/stream").
+		Header("X-API-Key", apiKey).
+		ContentType(MIME_NDJSON).
+		Body(body).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		Body(marshal(t, IngestSummary{
+			Accepted:  1,
+			Rejected:  1,
+			Errors:    []IngestError{{Line: 2, Error: "invalid character 'o' in literal null (expecting 'u')"}},
+			StoppedAt: 3,
+			Error:     bufio.ErrTooLong.Error(),
+		})).
+		End()
+	feedback, err = s.DataClient.GetUserFeedback("7")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(feedback))
+}
+
 func TestServer_List(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -334,11 +607,14 @@ func TestServer_List(t *testing.T) {
 	}
 	operators := []ListOperator{
 		{cache.RecommendItems, "0", "/api/intermediate/recommend/0"},
+		{cache.SimilarUsers, "0", "/api/user/0/neighbors"},
 		//{cache.SubscribeItems, "0", "/subscribe/0"},
 		{cache.LatestItems, "", "/api/latest/"},
 		{cache.LatestItems, "0", "/api/latest/0"},
 		{cache.PopularItems, "", "/api/popular/"},
 		{cache.PopularItems, "0", "/api/popular/0"},
+		{cache.TrendingItems, "", "/api/trending/"},
+		{cache.TrendingItems, "0", "/api/trending/0"},
 		{cache.SimilarItems, "0", "/api/neighbors/0"},
 	}
 
@@ -352,7 +628,13 @@ func TestServer_List(t *testing.T) {
 			{"3", 97},
 			{"4", 96},
 		}
-		err := s.CacheClient.SetScores(operator.Prefix, operator.Label, items)
+		var err error
+		switch operator.Prefix {
+		case cache.PopularItems, cache.LatestItems, cache.TrendingItems:
+			err = s.CacheClient.SetSorted(operator.Prefix, operator.Label, items)
+		default:
+			err = s.CacheClient.SetScores(operator.Prefix, operator.Label, items)
+		}
 		assert.Nil(t, err)
 		apitest.New().
 			Handler(s.handler).
@@ -398,6 +680,185 @@ func TestServer_List(t *testing.T) {
 	}
 }
 
+func TestServer_HiddenItems(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	items := []cache.ScoredItem{{"0", 100}, {"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}}
+	err := s.CacheClient.SetSorted(cache.PopularItems, "", items)
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.SimilarItems, "0", items)
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.RecommendItems, "0", items)
+	assert.Nil(t, err)
+	// hide items
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/items").
+		Header("X-API-Key", apiKey).
+		JSON([]Item{
+			{ItemId: "1", Timestamp: "2021-01-01", IsHidden: true},
+			{ItemId: "2", Timestamp: "2021-01-01", IsHidden: true},
+			{ItemId: "3", Timestamp: "2021-01-01", IsHidden: true},
+			{ItemId: "3", Timestamp: "2021-01-01"},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 4}`).
+		End()
+	hidden, err := s.CacheClient.GetSet(cache.HiddenItems, "")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, hidden)
+	// hidden items are removed before pagination
+	for _, url := range []string{"/api/popular", "/api/neighbors/0", "/api/intermediate/recommend/0"} {
+		apitest.New().
+			Handler(s.handler).
+			Get(url).
+			Header("X-API-Key", apiKey).
+			QueryParams(map[string]string{
+				"offset": "1",
+				"n":      "2"}).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(marshal(t, []cache.ScoredItem{items[3], items[4]})).
+			End()
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"0", "3", "4"})).
+		End()
+	// show item
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"IsHidden": false}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	hidden, err = s.CacheClient.GetSet(cache.HiddenItems, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2"}, hidden)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/neighbors/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{items[0], items[1], items[3], items[4]})).
+		End()
+	// delete item
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/item/2").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	hidden, err = s.CacheClient.GetSet(cache.HiddenItems, "")
+	assert.Nil(t, err)
+	assert.Empty(t, hidden)
+}
+
+func TestServer_ScheduledItems(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	items := []cache.ScoredItem{{"0", 100}, {"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}}
+	err := s.CacheClient.SetSorted(cache.LatestItems, "", items)
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.RecommendItems, "0", items)
+	assert.Nil(t, err)
+	// schedule items
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/items").
+		Header("X-API-Key", apiKey).
+		JSON([]Item{
+			{ItemId: "0", Timestamp: "2021-01-01", PublishAt: past},
+			{ItemId: "1", Timestamp: "2021-01-01", PublishAt: future},
+			{ItemId: "2", Timestamp: "2021-01-01", ExpireAt: past},
+			{ItemId: "3", Timestamp: "2021-01-01", ExpireAt: future},
+			{ItemId: "4", Timestamp: "2021-01-01"},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 5}`).
+		End()
+	// items to be published or expired are sorted by times and expired items are hidden
+	unpublished, err := s.CacheClient.GetSorted(cache.UnpublishedItems, "", math.Inf(-1), math.Inf(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, unpublished)
+	expiring, err := s.CacheClient.GetSorted(cache.ExpiringItems, "", math.Inf(-1), math.Inf(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3"}, expiring)
+	hidden, err := s.CacheClient.GetSet(cache.HiddenItems, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2"}, hidden)
+	item, err := s.DataClient.GetItem("1")
+	assert.Nil(t, err)
+	assert.Equal(t, future, item.PublishAt.Format(time.RFC3339))
+	assert.Nil(t, item.ExpireAt)
+	// items not published or expired are removed
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/latest").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{items[0], items[3], items[4]})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "5",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"0", "3", "4"})).
+		End()
+	// publish item
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"PublishAt": ""}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	unpublished, err = s.CacheClient.GetSorted(cache.UnpublishedItems, "", math.Inf(-1), math.Inf(1))
+	assert.Nil(t, err)
+	assert.Empty(t, unpublished)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/intermediate/recommend/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{items[0], items[1], items[3], items[4]})).
+		End()
+	// invalid datetime
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(`{"ExpireAt": "tomorrow"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
 func TestServer_DeleteFeedback(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -625,11 +1086,11 @@ func TestServer_GetRecommends_Fallback_NonPersonalized(t *testing.T) {
 		[]cache.ScoredItem{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}})
 	assert.Nil(t, err)
 	// insert latest
-	err = s.CacheClient.SetScores(cache.LatestItems, "",
+	err = s.CacheClient.SetSorted(cache.LatestItems, "",
 		[]cache.ScoredItem{{"5", 95}, {"6", 94}, {"7", 93}, {"8", 92}})
 	assert.Nil(t, err)
 	// insert popular
-	err = s.CacheClient.SetScores(cache.PopularItems, "",
+	err = s.CacheClient.SetSorted(cache.PopularItems, "",
 		[]cache.ScoredItem{{"9", 91}, {"10", 90}, {"11", 89}, {"12", 88}})
 	assert.Nil(t, err)
 	// test popular fallback
@@ -671,3 +1132,550 @@ func TestServer_GetRecommends_Fallback_NonPersonalized(t *testing.T) {
 		Status(http.StatusInternalServerError).
 		End()
 }
+
+func TestServer_GetRecommends_Stages(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.RecommendItems, "0",
+		[]cache.ScoredItem{{ItemId: "1", Score: 99}, {ItemId: "2", Score: 98}, {ItemId: "3", Score: 97}})
+	assert.Nil(t, err)
+	// insert subscribed items
+	err = s.CacheClient.SetScores(cache.SubscribeItems, "0",
+		[]cache.ScoredItem{{ItemId: "2", Score: 10}, {ItemId: "4", Score: 9}})
+	assert.Nil(t, err)
+	// insert popular items with label
+	err = s.CacheClient.SetSorted(cache.PopularItems, "a",
+		[]cache.ScoredItem{{ItemId: "1", Score: 20}, {ItemId: "5", Score: 19}, {ItemId: "6", Score: 18}})
+	assert.Nil(t, err)
+	// insert similar users
+	err = s.CacheClient.SetScores(cache.SimilarUsers, "0",
+		[]cache.ScoredItem{{ItemId: "1", Score: 1}})
+	assert.Nil(t, err)
+	err = s.DataClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "1", ItemId: "7"}},
+	}, true, true)
+	assert.Nil(t, err)
+	s.GorseConfig.Recommend.Stages = []config.StageConfig{
+		{Name: SubscribeRecommender},
+		{Name: CollaborativeRecommender, Quota: 1},
+		{Name: PopularRecommender, Label: "a"},
+		{Name: UserNeighborRecommender},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "6",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "4", "1", "5", "6", "7"})).
+		End()
+	// test unknown stage
+	s.GorseConfig.Recommend.Stages = []config.StageConfig{{Name: "unknown"}}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusInternalServerError).
+		End()
+}
+
+func TestRecommendContext_LoadItems(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	err := s.DataClient.BatchInsertItem([]data.Item{{ItemId: "1", Labels: []string{"a"}}, {ItemId: "2", Labels: []string{"b"}}})
+	assert.Nil(t, err)
+	ctx, err := s.NewRecommendContext("0")
+	assert.Nil(t, err)
+	ctx.Filter = &RecommendFilter{IncludeLabels: []string{"a"}}
+	// items are loaded in a batch and missing items are remembered
+	err = ctx.prefetch(&s.RestServer, []cache.ScoredItem{{ItemId: "1"}, {ItemId: "2"}, {ItemId: "3"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(ctx.items))
+	assert.Nil(t, ctx.items["3"])
+	// loaded items are not loaded again
+	err = s.DataClient.DeleteItem("1")
+	assert.Nil(t, err)
+	accepted, err := ctx.accept(&s.RestServer, "1")
+	assert.Nil(t, err)
+	assert.True(t, accepted)
+	accepted, err = ctx.accept(&s.RestServer, "2")
+	assert.Nil(t, err)
+	assert.False(t, accepted)
+	accepted, err = ctx.accept(&s.RestServer, "3")
+	assert.Nil(t, err)
+	assert.False(t, accepted)
+}
+
+func TestServer_RecommendPipeline(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	err := s.CacheClient.SetScores(cache.RecommendItems, "0",
+		[]cache.ScoredItem{{ItemId: "1", Score: 10}, {ItemId: "2", Score: 9}, {ItemId: "3", Score: 8}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.LatestItems, "",
+		[]cache.ScoredItem{{ItemId: "3", Score: 4}, {ItemId: "4", Score: 2}})
+	assert.Nil(t, err)
+	err = s.CacheClient.AppendList(cache.IgnoreItems, "0", "2")
+	assert.Nil(t, err)
+	s.GorseConfig.Recommend.Stages = []config.StageConfig{
+		{Name: CollaborativeRecommender, Weight: 0.5},
+		{Name: LatestRecommender},
+	}
+	ctx, err := s.NewRecommendContext("0")
+	assert.Nil(t, err)
+	results, err := s.RecommendPipeline(ctx, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, CollaborativeRecommender, results[0].Stage)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: 5}, {ItemId: "3", Score: 4}}, results[0].Items)
+	assert.Equal(t, LatestRecommender, results[1].Stage)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "4", Score: 2}}, results[1].Items)
+}
+
+func TestServer_RecommendPipeline_Blend(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	err := s.CacheClient.SetScores(cache.RecommendItems, "0",
+		[]cache.ScoredItem{{ItemId: "1", Score: 10}, {ItemId: "2", Score: 9}, {ItemId: "5", Score: 1}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.LatestItems, "",
+		[]cache.ScoredItem{{ItemId: "3", Score: 4}, {ItemId: "4", Score: 1}, {ItemId: "5", Score: 0.5}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.PopularItems, "",
+		[]cache.ScoredItem{{ItemId: "1", Score: 100}, {ItemId: "6", Score: 90}})
+	assert.Nil(t, err)
+	s.GorseConfig.Recommend.Stages = []config.StageConfig{
+		{Name: CollaborativeRecommender, Weight: 1},
+		{Name: LatestRecommender, Weight: 3},
+		{Name: PopularRecommender},
+	}
+	ctx, err := s.NewRecommendContext("0")
+	assert.Nil(t, err)
+	results, err := s.RecommendPipeline(ctx, 4)
+	assert.Nil(t, err)
+	// weighted stages are blended
+	assert.Equal(t, []StageResult{
+		{Stage: LatestRecommender, Items: []cache.ScoredItem{{ItemId: "3", Score: 12}}},
+		{Stage: CollaborativeRecommender, Items: []cache.ScoredItem{{ItemId: "1", Score: 10}, {ItemId: "2", Score: 9}}},
+		{Stage: LatestRecommender, Items: []cache.ScoredItem{{ItemId: "4", Score: 3}}},
+	}, clearStageTime(results))
+	// scores of items from multiple stages are summed and the unweighted stage runs after blended stages
+	ctx, err = s.NewRecommendContext("0")
+	assert.Nil(t, err)
+	results, err = s.RecommendPipeline(ctx, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "4", Score: 3}, {ItemId: "5", Score: 2.5}}, results[2].Items)
+	assert.Equal(t, PopularRecommender, results[3].Stage)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "6", Score: 90}}, results[3].Items)
+}
+
+// clearStageTime sets time of stage results to zero for comparison.
+func clearStageTime(results []StageResult) []StageResult {
+	for i := range results {
+		results[i].Time = 0
+	}
+	return results
+}
+
+func TestServer_GetRecommends_Explain(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.RecommendItems, "0",
+		[]cache.ScoredItem{{ItemId: "1", Score: 99}, {ItemId: "2", Score: 98}})
+	assert.Nil(t, err)
+	// insert feedback
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "3"}},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 2}`).
+		End()
+	// insert similar items
+	err = s.CacheClient.SetScores(cache.SimilarItems, "2", []cache.ScoredItem{{ItemId: "4", Score: 2}, {ItemId: "5", Score: 1}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.SimilarItems, "3", []cache.ScoredItem{{ItemId: "4", Score: 2}})
+	assert.Nil(t, err)
+	// insert latest items
+	err = s.CacheClient.SetSorted(cache.LatestItems, "", []cache.ScoredItem{{ItemId: "6", Score: 10}})
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "4",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []ExplainedItem{
+			{ItemId: "1", Score: 99, Stage: CollaborativeRecommender},
+			{ItemId: "4", Score: 4, Stage: ItemNeighborRecommender, Because: []string{"2", "3"}},
+			{ItemId: "5", Score: 1, Stage: ItemNeighborRecommender, Because: []string{"2"}},
+			{ItemId: "6", Score: 10, Stage: LatestRecommender},
+		})).
+		End()
+}
+
+func TestServer_GetRecommends_NegativeFeedback(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.GorseConfig.Database.NegativeFeedbackTypes = []string{"dislike"}
+	s.GorseConfig.Recommend.Stages = []config.StageConfig{{Name: ItemNeighborRecommender}}
+	// insert feedback
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "like", UserId: "0", ItemId: "1"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "dislike", UserId: "0", ItemId: "2"}},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 2}`).
+		End()
+	// insert similar items
+	err := s.CacheClient.SetScores(cache.SimilarItems, "1",
+		[]cache.ScoredItem{{ItemId: "3", Score: 3}, {ItemId: "4", Score: 2}, {ItemId: "5", Score: 1}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.SimilarItems, "2",
+		[]cache.ScoredItem{{ItemId: "3", Score: 2.5}, {ItemId: "5", Score: 2}, {ItemId: "6", Score: 1}})
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "10",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []ExplainedItem{
+			{ItemId: "4", Score: 2, Stage: ItemNeighborRecommender, Because: []string{"1"}},
+			{ItemId: "3", Score: 0.5, Stage: ItemNeighborRecommender, Because: []string{"1"}},
+		})).
+		End()
+}
+
+func TestServer_GetRecommends_Filter(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert items
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := s.DataClient.BatchInsertItem([]data.Item{
+		{ItemId: "1", Labels: []string{"a"}, Timestamp: timestamp},
+		{ItemId: "2", Labels: []string{"b"}, Timestamp: timestamp},
+		{ItemId: "3", Labels: []string{"a", "b"}, Timestamp: timestamp},
+		{ItemId: "4", Labels: []string{"a"}, Timestamp: timestamp.Add(-time.Hour)},
+		{ItemId: "5", Labels: []string{"a"}, Timestamp: timestamp},
+		{ItemId: "6", Labels: []string{"a"}, Timestamp: timestamp},
+		{ItemId: "7", Labels: []string{"c"}, Timestamp: timestamp},
+	})
+	assert.Nil(t, err)
+	// insert recommendation
+	err = s.CacheClient.SetScores(cache.RecommendItems, "0", []cache.ScoredItem{
+		{ItemId: "1", Score: 99}, {ItemId: "2", Score: 98}, {ItemId: "3", Score: 97}, {ItemId: "4", Score: 96}})
+	assert.Nil(t, err)
+	// insert latest items
+	err = s.CacheClient.SetSorted(cache.LatestItems, "", []cache.ScoredItem{{ItemId: "7", Score: 10}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetSorted(cache.LatestItems, "a", []cache.ScoredItem{
+		{ItemId: "5", Score: 10}, {ItemId: "6", Score: 9}})
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryCollection(map[string][]string{
+			"n":             {"4"},
+			"include-label": {"a"},
+			"exclude-label": {"b"},
+			"begin-time":    {"2020-12-31T23:30:00Z"},
+			"exclude-item":  {"6"},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "5"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"end-time": "2020-12-31T23:30:00Z",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"4"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"begin-time": "invalid",
+		}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestServer_GetRecommends_AttributeFilter(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert items
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := s.DataClient.BatchInsertItem([]data.Item{
+		{ItemId: "1", Timestamp: timestamp, Attributes: data.Attributes{
+			Categorical: map[string]string{"brand": "apple"},
+			Numeric:     map[string]float32{"price": 10},
+			Timestamp:   map[string]time.Time{"release": timestamp},
+		}},
+		{ItemId: "2", Timestamp: timestamp, Attributes: data.Attributes{
+			Categorical: map[string]string{"brand": "banana"},
+			Numeric:     map[string]float32{"price": 20},
+			Timestamp:   map[string]time.Time{"release": timestamp.Add(time.Hour)},
+		}},
+		{ItemId: "3", Timestamp: timestamp, Attributes: data.Attributes{
+			Categorical: map[string]string{"brand": "cherry"},
+			Numeric:     map[string]float32{"price": 30},
+		}},
+		{ItemId: "4", Timestamp: timestamp},
+	})
+	assert.Nil(t, err)
+	// insert recommendation
+	err = s.CacheClient.SetScores(cache.RecommendItems, "0", []cache.ScoredItem{
+		{ItemId: "1", Score: 99}, {ItemId: "2", Score: 98}, {ItemId: "3", Score: 97}, {ItemId: "4", Score: 96}})
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryCollection(map[string][]string{
+			"attribute": {"brand:apple", "brand:cherry"},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "3"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryCollection(map[string][]string{
+			"min-attribute": {"price:15"},
+			"max-attribute": {"price:30"},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "3"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"max-attribute": "release:2021-01-01T00:30:00Z",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"attribute": "brand",
+		}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestServer_ItemAttributes(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert item with attributes
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/item").
+		Header("X-API-Key", apiKey).
+		JSON(Item{ItemId: "1", Timestamp: "2021-01-01T00:00:00Z", Attributes: data.Attributes{
+			Categorical: map[string]string{"brand": "apple"},
+			Numeric:     map[string]float32{"price": 10},
+		}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	item, err := s.DataClient.GetItem("1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"brand": "apple"}, item.Attributes.Categorical)
+	assert.Equal(t, map[string]float32{"price": 10}, item.Attributes.Numeric)
+	// replace attributes
+	apitest.New().
+		Handler(s.handler).
+		Patch("/api/item/1").
+		Header("X-API-Key", apiKey).
+		JSON(ItemPatch{Attributes: &data.Attributes{Numeric: map[string]float32{"price": 20}}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	item, err = s.DataClient.GetItem("1")
+	assert.Nil(t, err)
+	assert.Empty(t, item.Attributes.Categorical)
+	assert.Equal(t, map[string]float32{"price": 20}, item.Attributes.Numeric)
+	// invalid attribute
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/user").
+		Header("X-API-Key", apiKey).
+		JSON(data.User{UserId: "1", Attributes: data.Attributes{Categorical: map[string]string{"gender": "a|b"}}}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestServer_GetRecommends_Context(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// create click model where item 3 is preferred on mobile
+	builder := click.NewUnifiedMapIndexBuilder()
+	builder.AddUser("0")
+	builder.AddItem("1")
+	builder.AddItem("2")
+	builder.AddItem("3")
+	builder.AddCtxLabel("mobile")
+	dataset := &click.Dataset{Index: builder.Build()}
+	fm := click.NewFM(click.FMClassification, model.Params{model.NEpochs: 0, model.NFactors: 1})
+	fm.Fit(dataset, dataset, nil)
+	for i := range fm.V {
+		fm.V[i][0] = 0
+	}
+	fm.W[dataset.Index.EncodeItem("1")] = 0.3
+	fm.W[dataset.Index.EncodeItem("2")] = 0.2
+	fm.W[dataset.Index.EncodeItem("3")] = 0.1
+	fm.V[dataset.Index.EncodeItem("3")][0] = 1
+	fm.V[dataset.Index.EncodeContextLabel("mobile")][0] = 1
+	s.SetClickModel(fm)
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.RecommendItems, "0", []cache.ScoredItem{
+		{ItemId: "3", Score: 99}, {ItemId: "2", Score: 98}, {ItemId: "1", Score: 97}})
+	assert.Nil(t, err)
+	// items aren't re-ranked without context
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"3", "2", "1"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"context": "desktop",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"context": "mobile",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"3", "1", "2"})).
+		End()
+}
+
+func TestServer_GetRecommends_Session(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert recommendation
+	err := s.CacheClient.SetScores(cache.RecommendItems, "0",
+		[]cache.ScoredItem{{ItemId: "1", Score: 10}, {ItemId: "2", Score: 5}, {ItemId: "3", Score: 1}})
+	assert.Nil(t, err)
+	// insert similar items
+	err = s.CacheClient.SetScores(cache.SimilarItems, "1", []cache.ScoredItem{{ItemId: "4", Score: 1}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.SimilarItems, "3", []cache.ScoredItem{{ItemId: "5", Score: 4}, {ItemId: "2", Score: 2}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.SimilarItems, "6", []cache.ScoredItem{{ItemId: "8", Score: 10}})
+	assert.Nil(t, err)
+	err = s.CacheClient.SetScores(cache.SimilarItems, "7", []cache.ScoredItem{{ItemId: "9", Score: 10}})
+	assert.Nil(t, err)
+	// insert feedback in session, negative feedback and read feedback aren't session items
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "3"}, Timestamp: timestamp.Add(time.Hour)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "a", UserId: "0", ItemId: "1"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "dislike", UserId: "0", ItemId: "6"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "0", ItemId: "7"}, Timestamp: timestamp},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 4}`).
+		End()
+	s.GorseConfig.Database.PositiveFeedbackType = []string{"a"}
+	s.GorseConfig.Database.NegativeFeedbackTypes = []string{"dislike"}
+	s.GorseConfig.Recommend.Stages = []config.StageConfig{{Name: SessionRecommender}}
+	// only the most recent feedback
+	s.GorseConfig.Recommend.SessionSize = 1
+	s.GorseConfig.Recommend.SessionWeight = 0.5
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []ExplainedItem{
+			{ItemId: "2", Score: 0.75, Stage: SessionRecommender, Because: []string{"3"}},
+			{ItemId: "5", Score: 0.5, Stage: SessionRecommender, Because: []string{"3"}},
+		})).
+		End()
+	// session items only
+	s.GorseConfig.Recommend.SessionSize = 10
+	s.GorseConfig.Recommend.SessionWeight = 1
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"5", "2", "4"})).
+		End()
+}
@@ -22,10 +22,12 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/protocol"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
@@ -43,6 +45,11 @@ type Server struct {
 	masterHost   string
 	masterPort   int
 	testMode     bool
+	// version of the click model
+	clickModelVersion int64
+	// local feedback log
+	feedbackLogPath string
+	replayOnce      sync.Once
 }
 
 // NewServer creates a server node.
@@ -62,6 +69,19 @@ func NewServer(masterHost string, masterPort int, serverHost string, serverPort
 	}
 }
 
+// EnableFeedbackLog accepts feedback by appending to a local log at the path, which is replayed to the data store
+// asynchronously.
+func (s *Server) EnableFeedbackLog(path string) {
+	s.feedbackLogPath = path
+}
+
+// insertFeedbackLog writes feedback replayed from the local log to the data store.
+func (s *Server) insertFeedbackLog(feedback []data.Feedback) error {
+	return s.DataClient.BatchInsertFeedback(feedback,
+		s.GorseConfig.Database.AutoInsertUser,
+		s.GorseConfig.Database.AutoInsertItem)
+}
+
 // Serve starts a server node.
 func (s *Server) Serve() {
 	rand.Seed(time.Now().UTC().UnixNano())
@@ -93,10 +113,47 @@ func (s *Server) Serve() {
 	}
 	s.masterClient = protocol.NewMasterClient(conn)
 
+	// open local feedback log
+	if s.feedbackLogPath != "" {
+		if s.FeedbackLog, err = OpenFeedbackLog(s.feedbackLogPath); err != nil {
+			base.Logger().Fatal("failed to open feedback log", zap.Error(err),
+				zap.String("path", s.feedbackLogPath))
+		}
+		base.Logger().Info("open feedback log",
+			zap.String("path", s.feedbackLogPath),
+			zap.Int("n_pending", s.FeedbackLog.Len()))
+	}
+
 	go s.Sync()
 	s.StartHttpServer()
 }
 
+// pullClickModel pulls the click model from the master, which is used to re-rank recommended items in context.
+func (s *Server) pullClickModel() {
+	base.Logger().Info("start pull click model")
+	clickResponse, err := s.masterClient.GetClickModel(context.Background(),
+		&protocol.NodeInfo{
+			NodeType: protocol.NodeType_ServerNode,
+			NodeName: s.serverName,
+		}, grpc.MaxCallRecvMsgSize(10e8))
+	if err != nil {
+		base.Logger().Error("failed to pull click model", zap.Error(err))
+		return
+	}
+	if clickResponse.Version == 0 {
+		// the master hasn't fitted a click model yet
+		return
+	}
+	clickModel, err := click.DecodeModel(clickResponse.Model)
+	if err != nil {
+		base.Logger().Error("failed to decode click model", zap.Error(err))
+		return
+	}
+	s.SetClickModel(clickModel)
+	s.clickModelVersion = clickResponse.Version
+	base.Logger().Info("synced click model", zap.String("version", base.Hex(s.clickModelVersion)))
+}
+
 // Sync this server to the master.
 func (s *Server) Sync() {
 	defer base.CheckPanic()
@@ -141,6 +198,18 @@ func (s *Server) Sync() {
 			s.cachePath = s.GorseConfig.Database.CacheStore
 		}
 
+		// replay feedback log once the data store is connected
+		if s.FeedbackLog != nil {
+			s.replayOnce.Do(func() {
+				go s.FeedbackLog.Replay(s.insertFeedbackLog, s.GorseConfig.Server.IngestBatchSize)
+			})
+		}
+
+		// pull click model
+		if meta.ClickModelVersion != s.clickModelVersion {
+			s.pullClickModel()
+		}
+
 	sleep:
 		if s.testMode {
 			return
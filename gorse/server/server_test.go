@@ -19,10 +19,16 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/click"
 	"github.com/zhenghaoz/gorse/protocol"
+	"github.com/zhenghaoz/gorse/storage/data"
 	"google.golang.org/grpc"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 type mockMaster struct {
@@ -32,6 +38,7 @@ type mockMaster struct {
 	meta       *protocol.Meta
 	cacheStore *miniredis.Miniredis
 	dataStore  *miniredis.Miniredis
+	clickModel *protocol.Model
 }
 
 func newMockMaster(t *testing.T) *mockMaster {
@@ -42,11 +49,22 @@ func newMockMaster(t *testing.T) *mockMaster {
 	cfg := (*config.Config)(nil).LoadDefaultIfNil()
 	cfg.Database.DataStore = "redis://" + dataStore.Addr()
 	cfg.Database.CacheStore = "redis://" + cacheStore.Addr()
+	// create click model
+	builder := click.NewUnifiedMapIndexBuilder()
+	builder.AddUser("0")
+	builder.AddItem("0")
+	dataset := &click.Dataset{Index: builder.Build()}
+	fm := click.NewFM(click.FMClassification, model.Params{model.NEpochs: 0})
+	fm.Fit(dataset, dataset, nil)
+	clickModel := &protocol.Model{Version: 1}
+	clickModel.Model, err = click.EncodeModel(fm)
+	assert.NoError(t, err)
 	return &mockMaster{
 		addr:       make(chan string),
-		meta:       &protocol.Meta{Config: marshal(t, cfg)},
+		meta:       &protocol.Meta{Config: marshal(t, cfg), ClickModelVersion: 1},
 		cacheStore: cacheStore,
 		dataStore:  dataStore,
+		clickModel: clickModel,
 	}
 }
 
@@ -59,7 +77,7 @@ func (m *mockMaster) GetRankingModel(context.Context, *protocol.NodeInfo) (*prot
 }
 
 func (m *mockMaster) GetClickModel(context.Context, *protocol.NodeInfo) (*protocol.Model, error) {
-	panic("not implement")
+	return m.clickModel, nil
 }
 
 func (m *mockMaster) GetUserIndex(context.Context, *protocol.NodeInfo) (*protocol.UserIndex, error) {
@@ -89,15 +107,33 @@ func TestServer_Sync(t *testing.T) {
 	address := <-master.addr
 	conn, err := grpc.Dial(address, grpc.WithInsecure())
 	assert.NoError(t, err)
+	// feedback accepted before sync is replayed after the data store is connected
+	path := filepath.Join(os.TempDir(), "TestServer_Sync")
+	_ = os.Remove(path)
+	_ = os.Remove(path + ".offset")
+	feedbackLog, err := OpenFeedbackLog(path)
+	assert.NoError(t, err)
+	assert.NoError(t, feedbackLog.Append(data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}}))
 	serv := &Server{
 		testMode:     true,
 		masterClient: protocol.NewMasterClient(conn),
 		RestServer: RestServer{
 			GorseConfig: (*config.Config)(nil).LoadDefaultIfNil(),
+			FeedbackLog: feedbackLog,
 		},
 	}
 	serv.Sync()
 	assert.Equal(t, "redis://"+master.dataStore.Addr(), serv.dataPath)
 	assert.Equal(t, "redis://"+master.cacheStore.Addr(), serv.cachePath)
+	assert.Equal(t, int64(1), serv.clickModelVersion)
+	assert.NotNil(t, serv.getClickModel())
+	assert.Eventually(t, func() bool { return feedbackLog.Len() == 0 }, time.Second, 10*time.Millisecond)
+	userFeedback, err := serv.DataClient.GetUserFeedback("0")
+	assert.NoError(t, err)
+	assert.Len(t, userFeedback, 1)
+	assert.NoError(t, feedbackLog.Close())
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, os.Remove(path+".offset"))
 	master.Stop()
 }
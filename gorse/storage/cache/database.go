@@ -18,31 +18,42 @@ import (
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
+	"github.com/scylladb/go-set/strset"
+	"math"
 	"strings"
 	"time"
 )
 
 const (
 	IgnoreItems             = "ignore_items"
+	HiddenItems             = "hidden_items"      // set of hidden items and expired items
+	UnpublishedItems        = "unpublished_items" // sorted set of items to be published scored by publish times
+	ExpiringItems           = "expiring_items"    // sorted set of items to be expired scored by expire times
+	SessionFeedback         = "session_feedback"  // sorted set of recent feedback of a user scored by feedback times
 	SimilarItems            = "similar_items"
+	SimilarUsers            = "similar_users"
 	RecommendItems          = "collaborative_items"
 	SubscribeItems          = "subscribe_items"
-	PopularItems            = "popular_items"
-	LatestItems             = "latest_items"
+	PopularItems            = "sorted_popular_items"  // sorted set of popular items
+	LatestItems             = "sorted_latest_items"   // sorted set of latest items scored by publish times
+	TrendingItems           = "sorted_trending_items" // sorted set of trending items
 	LastActiveTime          = "last_active_time"
 	LastUpdateRecommendTime = "last_update_recommend_time"
 
 	// GlobalMeta is global meta information
-	GlobalMeta              = "global_meta"
-	NumInserted             = "num_inserted"
-	NumUsers                = "num_users"
-	NumItems                = "num_items"
-	NumPositiveFeedback     = "num_pos_feedback"
-	LastUpdatePopularTime   = "last_update_popular_time"
-	LastUpdateLatestTime    = "last_update_latest_time"
-	LastUpdateNeighborTime  = "last_update_similar_time"
-	LastFitRankingModelTime = "last_fit_match_model_time"
-	LastRankingModelVersion = "latest_match_model_version"
+	GlobalMeta                 = "global_meta"
+	NumInserted                = "num_inserted"
+	NumUsers                   = "num_users"
+	NumItems                   = "num_items"
+	NumPositiveFeedback        = "num_pos_feedback"
+	LastUpdatePopularTime      = "last_update_popular_time"
+	LastUpdateLatestTime       = "last_update_latest_time"
+	LastUpdateTrendingTime     = "last_update_trending_time"
+	LastUpdateNeighborTime     = "last_update_similar_time"
+	LastFullUpdateNeighborTime = "last_full_update_similar_time"
+	LastUpdateUserNeighborTime = "last_update_similar_users_time"
+	LastFitRankingModelTime    = "last_fit_match_model_time"
+	LastRankingModelVersion    = "latest_match_model_version"
 )
 
 var ErrObjectNotExist = fmt.Errorf("object not exists")
@@ -76,6 +87,46 @@ func RemoveScores(items []ScoredItem) []string {
 	return itemIds
 }
 
+// TimeScore converts a time to a score of sorted sets, which is the number of seconds since the Unix epoch.
+func TimeScore(t time.Time) float64 {
+	return float64(t.Unix()) + float64(t.Nanosecond())/float64(time.Second)
+}
+
+// UnavailableItems returns items unavailable at a time, which are hidden items, items not published and expired
+// items. Expired items are moved to hidden items once items are collected by the master.
+func UnavailableItems(database Database, t time.Time) (*strset.Set, error) {
+	hiddenItems, err := database.GetSet(HiddenItems, "")
+	if err != nil {
+		return nil, err
+	}
+	unavailableSet := strset.New(hiddenItems...)
+	score := TimeScore(t)
+	unpublishedItems, err := database.GetSorted(UnpublishedItems, "", math.Nextafter(score, math.Inf(1)), math.Inf(1))
+	if err != nil {
+		return nil, err
+	}
+	unavailableSet.Add(unpublishedItems...)
+	expiredItems, err := database.GetSorted(ExpiringItems, "", math.Inf(-1), score)
+	if err != nil {
+		return nil, err
+	}
+	unavailableSet.Add(expiredItems...)
+	return unavailableSet, nil
+}
+
+// GetItemScores returns items ranked from begin to end (inclusive) in a cached list. Popular, latest and trending
+// items are stored in sorted sets so that items are updated one by one, while other lists are replaced as a whole.
+// Sorted sets are stored under new keys instead of keys of legacy lists, so they are never read as lists before
+// rebuilt by the master.
+func GetItemScores(database Database, prefix, name string, begin, end int) ([]ScoredItem, error) {
+	switch prefix {
+	case PopularItems, LatestItems, TrendingItems:
+		return database.GetSortedScores(prefix, name, begin, end)
+	default:
+		return database.GetScores(prefix, name, begin, end)
+	}
+}
+
 // Database is the common interface for cache store.
 type Database interface {
 	Close() error
@@ -84,6 +135,16 @@ type Database interface {
 	ClearList(prefix, name string) error
 	AppendList(prefix, name string, items ...string) error
 	GetList(prefix, name string) ([]string, error)
+	AddSet(prefix, name string, members ...string) error
+	RemSet(prefix, name string, members ...string) error
+	GetSet(prefix, name string) ([]string, error)
+	SetSorted(prefix, name string, items []ScoredItem) error
+	AddSorted(prefix, name string, scores map[string]float64) error
+	RemSorted(prefix, name string, members ...string) error
+	GetSorted(prefix, name string, begin, end float64) ([]string, error)
+	GetSortedScores(prefix, name string, begin, end int) ([]ScoredItem, error)
+	GetSortedScore(prefix, name, member string) (float64, error)
+	TrimSorted(prefix, name string, n int) error
 	GetString(prefix, name string) (string, error)
 	SetString(prefix, name string, val string) error
 	GetTime(prefix, name string) (time.Time, error)
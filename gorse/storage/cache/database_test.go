@@ -14,6 +14,7 @@
 package cache
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -120,3 +121,116 @@ func testList(t *testing.T, db Database) {
 	assert.Nil(t, err)
 	assert.Empty(t, totalItems)
 }
+
+func testSet(t *testing.T, db Database) {
+	// add members
+	err := db.AddSet("set", "0", "1", "2", "3")
+	assert.NoError(t, err)
+	err = db.AddSet("set", "0", "2", "4")
+	assert.NoError(t, err)
+	members, err := db.GetSet("set", "0")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4"}, members)
+	// remove members
+	err = db.RemSet("set", "0", "1", "3", "5")
+	assert.NoError(t, err)
+	members, err = db.GetSet("set", "0")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "4"}, members)
+	// empty set
+	err = db.AddSet("set", "1")
+	assert.NoError(t, err)
+	members, err = db.GetSet("set", "1")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func testSorted(t *testing.T, db Database) {
+	// add members
+	err := db.AddSorted("sorted", "0", map[string]float64{"1": 1, "2": 2, "3": 3})
+	assert.NoError(t, err)
+	err = db.AddSorted("sorted", "0", map[string]float64{"1": 4, "5": 5})
+	assert.NoError(t, err)
+	members, err := db.GetSorted("sorted", "0", 2, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "1"}, members)
+	members, err = db.GetSorted("sorted", "0", math.Inf(-1), math.Inf(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "1", "5"}, members)
+	// remove members
+	err = db.RemSorted("sorted", "0", "1", "3")
+	assert.NoError(t, err)
+	members, err = db.GetSorted("sorted", "0", math.Inf(-1), math.Inf(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "5"}, members)
+	// get members with scores
+	err = db.AddSorted("sorted", "0", map[string]float64{"6": 6, "3": 3})
+	assert.NoError(t, err)
+	items, err := db.GetSortedScores("sorted", "0", 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScoredItem{{"6", 6}, {"5", 5}}, items)
+	// trim members
+	err = db.TrimSorted("sorted", "0", 2)
+	assert.NoError(t, err)
+	items, err = db.GetSortedScores("sorted", "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScoredItem{{"6", 6}, {"5", 5}}, items)
+	// get score of a member
+	score, err := db.GetSortedScore("sorted", "0", "5")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5), score)
+	_, err = db.GetSortedScore("sorted", "0", "2")
+	assert.Equal(t, ErrObjectNotExist, err)
+	// replace members
+	err = db.SetSorted("sorted", "0", []ScoredItem{{"7", 7}, {"1", 1}})
+	assert.NoError(t, err)
+	items, err = db.GetSortedScores("sorted", "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScoredItem{{"7", 7}, {"1", 1}}, items)
+	err = db.SetSorted("sorted", "0", nil)
+	assert.NoError(t, err)
+	items, err = db.GetSortedScores("sorted", "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func testUnavailableItems(t *testing.T, db Database) {
+	now := time.Now()
+	err := db.AddSet(HiddenItems, "", "0")
+	assert.NoError(t, err)
+	err = db.AddSorted(UnpublishedItems, "", map[string]float64{
+		"1": TimeScore(now.Add(-time.Hour)),
+		"2": TimeScore(now.Add(time.Hour)),
+	})
+	assert.NoError(t, err)
+	err = db.AddSorted(ExpiringItems, "", map[string]float64{
+		"3": TimeScore(now.Add(-time.Hour)),
+		"4": TimeScore(now),
+		"5": TimeScore(now.Add(time.Hour)),
+	})
+	assert.NoError(t, err)
+	unavailableItems, err := UnavailableItems(db, now)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0", "2", "3", "4"}, unavailableItems.List())
+}
+
+func testItemScores(t *testing.T, db Database) {
+	// legacy lists are never read
+	err := db.SetScores("popular_items", "", []ScoredItem{{"0", 1}})
+	assert.NoError(t, err)
+	items, err := GetItemScores(db, PopularItems, "", 0, -1)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+	// sorted sets are read by scores
+	err = db.SetSorted(PopularItems, "", []ScoredItem{{"0", 1}, {"1", 2}})
+	assert.NoError(t, err)
+	items, err = GetItemScores(db, PopularItems, "", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScoredItem{{"1", 2}, {"0", 1}}, items)
+	// other lists are read as scored lists
+	err = db.SetScores(SimilarItems, "0", []ScoredItem{{"1", 1}, {"2", 2}})
+	assert.NoError(t, err)
+	items, err = GetItemScores(db, SimilarItems, "0", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScoredItem{{"1", 1}, {"2", 2}}, items)
+}
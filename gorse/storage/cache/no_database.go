@@ -49,6 +49,56 @@ func (NoDatabase) GetList(prefix, name string) ([]string, error) {
 	return nil, ErrNoDatabase
 }
 
+// AddSet method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) AddSet(prefix, name string, members ...string) error {
+	return ErrNoDatabase
+}
+
+// RemSet method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) RemSet(prefix, name string, members ...string) error {
+	return ErrNoDatabase
+}
+
+// GetSet method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) GetSet(prefix, name string) ([]string, error) {
+	return nil, ErrNoDatabase
+}
+
+// SetSorted method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) SetSorted(prefix, name string, items []ScoredItem) error {
+	return ErrNoDatabase
+}
+
+// AddSorted method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) AddSorted(prefix, name string, scores map[string]float64) error {
+	return ErrNoDatabase
+}
+
+// RemSorted method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) RemSorted(prefix, name string, members ...string) error {
+	return ErrNoDatabase
+}
+
+// GetSorted method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) GetSorted(prefix, name string, begin, end float64) ([]string, error) {
+	return nil, ErrNoDatabase
+}
+
+// GetSortedScores method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) GetSortedScores(prefix, name string, begin, end int) ([]ScoredItem, error) {
+	return nil, ErrNoDatabase
+}
+
+// GetSortedScore method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) GetSortedScore(prefix, name, member string) (float64, error) {
+	return 0, ErrNoDatabase
+}
+
+// TrimSorted method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) TrimSorted(prefix, name string, n int) error {
+	return ErrNoDatabase
+}
+
 // GetString method of NoDatabase returns ErrNoDatabase.
 func (NoDatabase) GetString(prefix, name string) (string, error) {
 	return "", ErrNoDatabase
@@ -17,6 +17,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"strconv"
 	"time"
 
@@ -109,6 +110,144 @@ func (r *Redis) GetList(prefix, name string) ([]string, error) {
 	return res, err
 }
 
+// AddSet adds members to a set in Redis.
+func (r *Redis) AddSet(prefix, name string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return r.client.SAdd(ctx, key, values...).Err()
+}
+
+// RemSet removes members from a set in Redis.
+func (r *Redis) RemSet(prefix, name string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return r.client.SRem(ctx, key, values...).Err()
+}
+
+// GetSet returns members of a set from Redis.
+func (r *Redis) GetSet(prefix, name string) ([]string, error) {
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	return r.client.SMembers(ctx, key).Result()
+}
+
+// SetSorted replaces members of a sorted set in Redis by scored items atomically.
+func (r *Redis) SetSorted(prefix, name string, items []ScoredItem) error {
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(items) > 0 {
+			members := make([]*redis.Z, len(items))
+			for i, item := range items {
+				members[i] = &redis.Z{Score: float64(item.Score), Member: item.ItemId}
+			}
+			pipe.ZAdd(ctx, key, members...)
+		}
+		return nil
+	})
+	return err
+}
+
+// AddSorted adds members with scores to a sorted set in Redis. Scores of existing members are updated.
+func (r *Redis) AddSorted(prefix, name string, scores map[string]float64) error {
+	if len(scores) == 0 {
+		return nil
+	}
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	members := make([]*redis.Z, 0, len(scores))
+	for member, score := range scores {
+		members = append(members, &redis.Z{Score: score, Member: member})
+	}
+	return r.client.ZAdd(ctx, key, members...).Err()
+}
+
+// RemSorted removes members from a sorted set in Redis.
+func (r *Redis) RemSorted(prefix, name string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	return r.client.ZRem(ctx, key, values...).Err()
+}
+
+// GetSorted returns members of a sorted set with scores between begin and end (inclusive) from Redis. Members are
+// sorted by scores.
+func (r *Redis) GetSorted(prefix, name string, begin, end float64) ([]string, error) {
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	return r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: formatScore(begin),
+		Max: formatScore(end),
+	}).Result()
+}
+
+// GetSortedScores returns members of a sorted set ranked from begin to end (inclusive) with scores from Redis. Members
+// are sorted by scores in descending order.
+func (r *Redis) GetSortedScores(prefix, name string, begin, end int) ([]ScoredItem, error) {
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	members, err := r.client.ZRevRangeWithScores(ctx, key, int64(begin), int64(end)).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]ScoredItem, len(members))
+	for i, member := range members {
+		items[i].ItemId = member.Member.(string)
+		items[i].Score = float32(member.Score)
+	}
+	return items, nil
+}
+
+// GetSortedScore returns the score of a member in a sorted set from Redis. ErrObjectNotExist is returned if the
+// member doesn't exist.
+func (r *Redis) GetSortedScore(prefix, name, member string) (float64, error) {
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	score, err := r.client.ZScore(ctx, key, member).Result()
+	if err == redis.Nil {
+		return 0, ErrObjectNotExist
+	}
+	return score, err
+}
+
+// TrimSorted removes members from a sorted set in Redis except n members with the highest scores.
+func (r *Redis) TrimSorted(prefix, name string, n int) error {
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	return r.client.ZRemRangeByRank(ctx, key, 0, int64(-n-1)).Err()
+}
+
+// formatScore formats a score of sorted sets for Redis.
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "+inf"
+	} else if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
 // GetString returns a string from Redis.
 func (r *Redis) GetString(prefix, name string) (string, error) {
 	var ctx = context.Background()
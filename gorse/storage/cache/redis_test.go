@@ -57,3 +57,27 @@ func TestRedis_List(t *testing.T) {
 	defer db.Close(t)
 	testList(t, db.Database)
 }
+
+func TestRedis_Set(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testSet(t, db.Database)
+}
+
+func TestRedis_Sorted(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testSorted(t, db.Database)
+}
+
+func TestRedis_UnavailableItems(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testUnavailableItems(t, db.Database)
+}
+
+func TestRedis_ItemScores(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testItemScores(t, db.Database)
+}
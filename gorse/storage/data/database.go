@@ -17,6 +17,8 @@ package data
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
@@ -36,18 +38,104 @@ var (
 
 // Item stores meta data about item.
 type Item struct {
-	ItemId    string
-	Timestamp time.Time
-	Labels    []string
-	Comment   string
+	ItemId     string
+	Timestamp  time.Time
+	Labels     []string
+	Comment    string
+	IsHidden   bool       `json:",omitempty"` // hidden items are used in training but not recommended
+	PublishAt  *time.Time `json:",omitempty"` // the item isn't recommended before it's published
+	ExpireAt   *time.Time `json:",omitempty"` // the item isn't recommended after it expires
+	Attributes Attributes
+}
+
+// IsScheduled returns true if the item has a publish time or an expire time.
+func (item *Item) IsScheduled() bool {
+	return item.PublishAt != nil || item.ExpireAt != nil
+}
+
+// PublishTime returns the publish time of the item. It's the timestamp if the publish time is not set.
+func (item *Item) PublishTime() time.Time {
+	if item.PublishAt != nil {
+		return *item.PublishAt
+	}
+	return item.Timestamp
+}
+
+// IsAvailable returns true if the item has been published and hasn't expired at a time.
+func (item *Item) IsAvailable(t time.Time) bool {
+	if item.PublishAt != nil && t.Before(*item.PublishAt) {
+		return false
+	}
+	return !item.IsExpired(t)
+}
+
+// IsExpired returns true if the item has expired at a time. Expired items are never available again.
+func (item *Item) IsExpired(t time.Time) bool {
+	return item.ExpireAt != nil && !t.Before(*item.ExpireAt)
 }
 
 // User stores meta data about user.
 type User struct {
-	UserId    string
-	Labels    []string
-	Subscribe []string
-	Comment   string
+	UserId     string
+	Labels     []string
+	Subscribe  []string
+	Comment    string
+	Attributes Attributes
+}
+
+// Attributes are typed properties of an item or a user, such as the brand, the price and the release date.
+type Attributes struct {
+	Categorical map[string]string    `json:",omitempty"`
+	Numeric     map[string]float32   `json:",omitempty"`
+	Timestamp   map[string]time.Time `json:",omitempty"`
+}
+
+// IsEmpty returns true if there are no attributes.
+func (attrs Attributes) IsEmpty() bool {
+	return len(attrs.Categorical) == 0 && len(attrs.Numeric) == 0 && len(attrs.Timestamp) == 0
+}
+
+// Validate attributes. Names of attributes and categorical values should be valid labels.
+func (attrs Attributes) Validate() error {
+	for name, value := range attrs.Categorical {
+		if err := base.ValidateLabel(name); err != nil {
+			return err
+		}
+		if err := base.ValidateLabel(value); err != nil {
+			return err
+		}
+	}
+	for name := range attrs.Numeric {
+		if err := base.ValidateLabel(name); err != nil {
+			return err
+		}
+	}
+	for name := range attrs.Timestamp {
+		if err := base.ValidateLabel(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Value implements driver.Valuer. Attributes are stored as JSON in SQL databases.
+func (attrs Attributes) Value() (driver.Value, error) {
+	return json.Marshal(attrs)
+}
+
+// Scan implements sql.Scanner. NULL is scanned as empty attributes.
+func (attrs *Attributes) Scan(src interface{}) error {
+	*attrs = Attributes{}
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, attrs)
+	case string:
+		return json.Unmarshal([]byte(src), attrs)
+	default:
+		return fmt.Errorf("can't scan %T into attributes", src)
+	}
 }
 
 // FeedbackKey identifies feedback.
@@ -61,9 +149,24 @@ type FeedbackKey struct {
 type Feedback struct {
 	FeedbackKey
 	Timestamp time.Time
+	Value     float32  `json:",omitempty"` // optional positive graded value such as rating (0 means not set)
+	Context   []string `json:",omitempty"` // optional context labels such as device, hour of day or page
 	Comment   string
 }
 
+// Weight returns the weight of feedback, which is the weight of its type (1 if not set)
+// multiplied by its value (if set).
+func (feedback *Feedback) Weight(weights map[string]float32) float32 {
+	weight, exist := weights[feedback.FeedbackType]
+	if !exist {
+		weight = 1
+	}
+	if feedback.Value != 0 {
+		weight *= feedback.Value
+	}
+	return weight
+}
+
 // Measurement stores a statistical value.
 type Measurement struct {
 	Name      string
@@ -79,6 +182,7 @@ type Database interface {
 	BatchInsertItem(items []Item) error
 	DeleteItem(itemId string) error
 	GetItem(itemId string) (Item, error)
+	BatchGetItems(itemIds []string) ([]Item, error)
 	GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error)
 	GetItemFeedback(itemId string, feedbackTypes ...string) ([]Feedback, error)
 	InsertUser(user User) error
@@ -17,6 +17,7 @@ package data
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"sort"
 	"strconv"
 	"testing"
 	"time"
@@ -98,6 +99,10 @@ func testUsers(t *testing.T, db Database) {
 			UserId:  strconv.Itoa(i),
 			Labels:  []string{strconv.Itoa(i + 100)},
 			Comment: fmt.Sprintf("comment %d", i),
+			Attributes: Attributes{
+				Categorical: map[string]string{"gender": "unknown"},
+				Numeric:     map[string]float32{"age": float32(i + 20)},
+			},
 		})
 		assert.Nil(t, err)
 	}
@@ -108,6 +113,10 @@ func testUsers(t *testing.T, db Database) {
 		assert.Equal(t, strconv.Itoa(i), user.UserId)
 		assert.Equal(t, []string{strconv.Itoa(i + 100)}, user.Labels)
 		assert.Equal(t, fmt.Sprintf("comment %d", i), user.Comment)
+		assert.Equal(t, Attributes{
+			Categorical: map[string]string{"gender": "unknown"},
+			Numeric:     map[string]float32{"age": float32(i + 20)},
+		}, user.Attributes)
 	}
 	// Get this user
 	user, err := db.GetUser("0")
@@ -128,18 +137,18 @@ func testUsers(t *testing.T, db Database) {
 
 func testFeedback(t *testing.T, db Database) {
 	// users that already exists
-	err := db.InsertUser(User{"0", []string{"a"}, []string{"x"}, "comment"})
+	err := db.InsertUser(User{UserId: "0", Labels: []string{"a"}, Subscribe: []string{"x"}, Comment: "comment"})
 	assert.Nil(t, err)
 	// items that already exists
 	err = db.InsertItem(Item{ItemId: "0", Labels: []string{"b"}})
 	assert.Nil(t, err)
 	// Insert ret
 	feedback := []Feedback{
-		{FeedbackKey{positiveFeedbackType, "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "1", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "3", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "4", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "0", "0"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Context: []string{"mobile"}, Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "1", "2"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Context: []string{"desktop", "morning"}, Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "2", "4"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Value: 1.5, Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "3", "6"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "4", "8"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
 	}
 	err = db.BatchInsertFeedback(feedback[1:], true, true)
 	assert.Nil(t, err)
@@ -170,7 +179,7 @@ func testFeedback(t *testing.T, db Database) {
 	// check users that already exists
 	user, err := db.GetUser("0")
 	assert.Nil(t, err)
-	assert.Equal(t, User{"0", []string{"a"}, []string{"x"}, "comment"}, user)
+	assert.Equal(t, User{UserId: "0", Labels: []string{"a"}, Subscribe: []string{"x"}, Comment: "comment"}, user)
 	// check items that already exists
 	item, err := db.GetItem("0")
 	assert.Nil(t, err)
@@ -191,6 +200,11 @@ func testFeedback(t *testing.T, db Database) {
 	assert.Equal(t, 1, len(ret))
 	assert.Equal(t, "2", ret[0].UserId)
 	assert.Equal(t, "4", ret[0].ItemId)
+	assert.Equal(t, float32(1.5), ret[0].Value)
+	ret, err = db.GetItemFeedback("2", positiveFeedbackType)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ret))
+	assert.Equal(t, []string{"desktop", "morning"}, ret[0].Context)
 	// Get all feedback by item
 	ret, err = db.GetItemFeedback("4")
 	assert.Nil(t, err)
@@ -208,6 +222,8 @@ func testFeedback(t *testing.T, db Database) {
 }
 
 func testItems(t *testing.T, db Database) {
+	publishAt := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	expireAt := time.Date(2021, 6, 8, 0, 0, 0, 0, time.UTC)
 	// Items
 	items := []Item{
 		{
@@ -221,24 +237,33 @@ func testItems(t *testing.T, db Database) {
 			Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
 			Labels:    []string{"a"},
 			Comment:   "comment 2",
+			Attributes: Attributes{
+				Categorical: map[string]string{"brand": "gorse"},
+				Numeric:     map[string]float32{"price": 9.9},
+				Timestamp:   map[string]time.Time{"release": time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
+			},
 		},
 		{
 			ItemId:    "4",
 			Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
 			Labels:    []string{"a", "b"},
 			Comment:   "comment 4",
+			PublishAt: &publishAt,
 		},
 		{
 			ItemId:    "6",
 			Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
 			Labels:    []string{"b"},
 			Comment:   "comment 6",
+			PublishAt: &publishAt,
+			ExpireAt:  &expireAt,
 		},
 		{
 			ItemId:    "8",
 			Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
 			Labels:    []string{"b"},
 			Comment:   "comment 8",
+			IsHidden:  true,
 		},
 	}
 	// Insert item
@@ -255,6 +280,14 @@ func testItems(t *testing.T, db Database) {
 		assert.Nil(t, err)
 		assert.Equal(t, item, ret)
 	}
+	// Batch get items
+	batchItems, err := db.BatchGetItems([]string{"2", "6", "unknown"})
+	assert.Nil(t, err)
+	sort.Slice(batchItems, func(i, j int) bool { return batchItems[i].ItemId < batchItems[j].ItemId })
+	assert.Equal(t, []Item{items[1], items[3]}, batchItems)
+	batchItems, err = db.BatchGetItems(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, batchItems)
 	// Delete item
 	err = db.DeleteItem("0")
 	assert.Nil(t, err)
@@ -271,11 +304,11 @@ func testItems(t *testing.T, db Database) {
 func testDeleteUser(t *testing.T, db Database) {
 	// Insert ret
 	feedback := []Feedback{
-		{FeedbackKey{positiveFeedbackType, "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "0", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "0", "0"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "0", "2"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "0", "4"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "0", "6"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "0", "8"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
 	}
 	err := db.BatchInsertFeedback(feedback, true, true)
 	assert.Nil(t, err)
@@ -295,11 +328,11 @@ func testDeleteUser(t *testing.T, db Database) {
 func testDeleteItem(t *testing.T, db Database) {
 	// Insert ret
 	feedbacks := []Feedback{
-		{FeedbackKey{positiveFeedbackType, "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "1", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "2", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "3", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{positiveFeedbackType, "4", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "0", "0"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "1", "0"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "2", "0"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "3", "0"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{positiveFeedbackType, "4", "0"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
 	}
 	err := db.BatchInsertFeedback(feedbacks, true, true)
 	assert.Nil(t, err)
@@ -318,11 +351,11 @@ func testDeleteItem(t *testing.T, db Database) {
 
 func testDeleteFeedback(t *testing.T, db Database) {
 	feedbacks := []Feedback{
-		{FeedbackKey{"type1", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type2", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type3", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "1", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey: FeedbackKey{"type1", "2", "3"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type2", "2", "3"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type3", "2", "3"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type1", "2", "4"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type1", "1", "3"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
 	}
 	err := db.BatchInsertFeedback(feedbacks, true, true)
 	assert.Nil(t, err)
@@ -415,11 +448,11 @@ func testTimeLimit(t *testing.T, db Database) {
 
 	// insert feedback
 	feedbacks := []Feedback{
-		{FeedbackKey{"type1", "2", "3"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type2", "2", "3"}, time.Date(1997, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type3", "2", "3"}, time.Date(1998, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "2", "4"}, time.Date(1999, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
-		{FeedbackKey{"type1", "1", "3"}, time.Date(2000, 3, 15, 0, 0, 0, 0, time.UTC), "comment"},
+		{FeedbackKey: FeedbackKey{"type1", "2", "3"}, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type2", "2", "3"}, Timestamp: time.Date(1997, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type3", "2", "3"}, Timestamp: time.Date(1998, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type1", "2", "4"}, Timestamp: time.Date(1999, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
+		{FeedbackKey: FeedbackKey{"type1", "1", "3"}, Timestamp: time.Date(2000, 3, 15, 0, 0, 0, 0, time.UTC), Comment: "comment"},
 	}
 	err = db.BatchInsertFeedback(feedbacks, true, true)
 	assert.Nil(t, err)
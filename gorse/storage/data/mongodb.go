@@ -209,6 +209,29 @@ func (db *MongoDB) GetItem(itemId string) (item Item, err error) {
 	return
 }
 
+// BatchGetItems returns items from MongoDB. Items don't exist are ignored.
+func (db *MongoDB) BatchGetItems(itemIds []string) ([]Item, error) {
+	if len(itemIds) == 0 {
+		return nil, nil
+	}
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("items")
+	r, err := c.Find(ctx, bson.M{"itemid": bson.M{"$in": itemIds}})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close(ctx)
+	items := make([]Item, 0, len(itemIds))
+	for r.Next(ctx) {
+		var item Item
+		if err = r.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 // GetItems returns items from MongoDB.
 func (db *MongoDB) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	ctx := context.Background()
@@ -54,6 +54,11 @@ func (NoDatabase) GetItem(itemId string) (Item, error) {
 	return Item{}, ErrNoDatabase
 }
 
+// BatchGetItems method of NoDatabase returns ErrNoDatabase.
+func (NoDatabase) BatchGetItems(itemIds []string) ([]Item, error) {
+	return nil, ErrNoDatabase
+}
+
 // GetItems method of NoDatabase returns ErrNoDatabase.
 func (NoDatabase) GetItems(cursor string, n int, time *time.Time) (string, []Item, error) {
 	return "", nil, ErrNoDatabase
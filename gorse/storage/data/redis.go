@@ -192,6 +192,34 @@ func (r *Redis) GetItem(itemId string) (Item, error) {
 	return item, err
 }
 
+// BatchGetItems returns items from Redis. Items don't exist are ignored.
+func (r *Redis) BatchGetItems(itemIds []string) ([]Item, error) {
+	if len(itemIds) == 0 {
+		return nil, nil
+	}
+	var ctx = context.Background()
+	keys := make([]string, len(itemIds))
+	for i, itemId := range itemIds {
+		keys[i] = prefixItem + itemId
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]Item, 0, len(itemIds))
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		var item Item
+		if err = json.Unmarshal([]byte(value.(string)), &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 // GetItems returns items from Redis.
 func (r *Redis) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	var ctx = context.Background()
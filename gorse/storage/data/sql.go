@@ -38,6 +38,10 @@ func (d *SQLDatabase) Init() error {
 		"time_stamp timestamp NOT NULL," +
 		"labels json NOT NULL," +
 		"comment TEXT NOT NULL," +
+		"is_hidden bool NOT NULL DEFAULT 0," +
+		"publish_at timestamp NULL DEFAULT NULL," +
+		"expire_at timestamp NULL DEFAULT NULL," +
+		"attributes json NULL," +
 		"PRIMARY KEY(item_id)" +
 		")"); err != nil {
 		return err
@@ -47,6 +51,7 @@ func (d *SQLDatabase) Init() error {
 		"labels json NOT NULL," +
 		"subscribe json NOT NULL," +
 		"comment TEXT NOT NULL," +
+		"attributes json NULL," +
 		"PRIMARY KEY (user_id)" +
 		")"); err != nil {
 		return err
@@ -56,7 +61,9 @@ func (d *SQLDatabase) Init() error {
 		"user_id varchar(256) NOT NULL," +
 		"item_id varchar(256) NOT NULL," +
 		"time_stamp timestamp NOT NULL," +
+		"value double NOT NULL DEFAULT 0," +
 		"comment TEXT NOT NULL," +
+		"context json NULL," +
 		"PRIMARY KEY(feedback_type, user_id, item_id)" +
 		")"); err != nil {
 		return err
@@ -70,6 +77,28 @@ func (d *SQLDatabase) Init() error {
 		")"); err != nil {
 		return err
 	}
+	// add columns to tables created by previous versions
+	if err := d.addColumnIfNotExists("feedback", "value", "double NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("items", "is_hidden", "bool NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("items", "publish_at", "timestamp NULL DEFAULT NULL"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("items", "expire_at", "timestamp NULL DEFAULT NULL"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("items", "attributes", "json NULL"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("users", "attributes", "json NULL"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("feedback", "context", "json NULL"); err != nil {
+		return err
+	}
 	// create index
 	if exist, err := d.checkIfIndexExists("feedback", "user_id"); err != nil {
 		return err
@@ -93,6 +122,21 @@ func (d *SQLDatabase) checkIfIndexExists(table, index string) (bool, error) {
 	return r.Next(), nil
 }
 
+func (d *SQLDatabase) addColumnIfNotExists(table, column, definition string) error {
+	r, err := d.db.Query("SHOW COLUMNS FROM "+table+" LIKE ?", column)
+	if err != nil {
+		return err
+	}
+	exist := r.Next()
+	if err = r.Close(); err != nil {
+		return err
+	}
+	if !exist {
+		_, err = d.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	}
+	return err
+}
+
 // Close MySQL connection.
 func (d *SQLDatabase) Close() error {
 	return d.db.Close()
@@ -130,9 +174,10 @@ func (d *SQLDatabase) InsertItem(item Item) error {
 	if err != nil {
 		return err
 	}
-	_, err = d.db.Exec("INSERT items(item_id, time_stamp, labels, `comment`) VALUES (?, ?, ?, ?) "+
-		"ON DUPLICATE KEY UPDATE time_stamp = ?, labels = ?, `comment` = ?",
-		item.ItemId, item.Timestamp, labels, item.Comment, item.Timestamp, labels, item.Comment)
+	_, err = d.db.Exec("INSERT items(item_id, time_stamp, labels, `comment`, is_hidden, publish_at, expire_at, attributes) VALUES (?, ?, ?, ?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE time_stamp = ?, labels = ?, `comment` = ?, is_hidden = ?, publish_at = ?, expire_at = ?, attributes = ?",
+		item.ItemId, item.Timestamp, labels, item.Comment, item.IsHidden, item.PublishAt, item.ExpireAt, item.Attributes,
+		item.Timestamp, labels, item.Comment, item.IsHidden, item.PublishAt, item.ExpireAt, item.Attributes)
 	InsertItemLatency.Observe(time.Since(startTime).Seconds())
 	return err
 }
@@ -144,20 +189,21 @@ func (d *SQLDatabase) BatchInsertItem(items []Item) error {
 		batchItems := items[i:base.Min(i+batchSize, len(items))]
 		// build query
 		builder := strings.Builder{}
-		builder.WriteString("INSERT items(item_id, time_stamp, labels, `comment`) VALUES ")
+		builder.WriteString("INSERT items(item_id, time_stamp, labels, `comment`, is_hidden, publish_at, expire_at, attributes) VALUES ")
 		var args []interface{}
 		for i, item := range batchItems {
 			labels, err := json.Marshal(item.Labels)
 			if err != nil {
 				return err
 			}
-			builder.WriteString("(?,?,?,?)")
+			builder.WriteString("(?,?,?,?,?,?,?,?)")
 			if i+1 < len(batchItems) {
 				builder.WriteString(",")
 			}
-			args = append(args, item.ItemId, item.Timestamp, labels, item.Comment)
+			args = append(args, item.ItemId, item.Timestamp, labels, item.Comment, item.IsHidden, item.PublishAt, item.ExpireAt, item.Attributes)
 		}
-		builder.WriteString(" AS new ON DUPLICATE KEY UPDATE time_stamp = new.time_stamp, labels = new.labels, `comment` = new.comment")
+		builder.WriteString(" AS new ON DUPLICATE KEY UPDATE time_stamp = new.time_stamp, labels = new.labels, `comment` = new.comment, is_hidden = new.is_hidden, " +
+			"publish_at = new.publish_at, expire_at = new.expire_at, attributes = new.attributes")
 		_, err := d.db.Exec(builder.String(), args...)
 		if err != nil {
 			return err
@@ -192,7 +238,7 @@ func (d *SQLDatabase) DeleteItem(itemId string) error {
 // GetItem get a item from MySQL.
 func (d *SQLDatabase) GetItem(itemId string) (Item, error) {
 	startTime := time.Now()
-	result, err := d.db.Query("SELECT item_id, time_stamp, labels, `comment` FROM items WHERE item_id = ?", itemId)
+	result, err := d.db.Query("SELECT item_id, time_stamp, labels, `comment`, is_hidden, publish_at, expire_at, attributes FROM items WHERE item_id = ?", itemId)
 	if err != nil {
 		return Item{}, err
 	}
@@ -200,7 +246,7 @@ func (d *SQLDatabase) GetItem(itemId string) (Item, error) {
 	if result.Next() {
 		var item Item
 		var labels string
-		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels, &item.Comment); err != nil {
+		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels, &item.Comment, &item.IsHidden, &item.PublishAt, &item.ExpireAt, &item.Attributes); err != nil {
 			return Item{}, err
 		}
 		if err := json.Unmarshal([]byte(labels), &item.Labels); err != nil {
@@ -212,15 +258,51 @@ func (d *SQLDatabase) GetItem(itemId string) (Item, error) {
 	return Item{}, ErrItemNotExist
 }
 
+// BatchGetItems returns items from MySQL. Items don't exist are ignored.
+func (d *SQLDatabase) BatchGetItems(itemIds []string) ([]Item, error) {
+	if len(itemIds) == 0 {
+		return nil, nil
+	}
+	var builder strings.Builder
+	builder.WriteString("SELECT item_id, time_stamp, labels, `comment`, is_hidden, publish_at, expire_at, attributes FROM items WHERE item_id IN (")
+	args := make([]interface{}, len(itemIds))
+	for i, itemId := range itemIds {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString("?")
+		args[i] = itemId
+	}
+	builder.WriteString(")")
+	result, err := d.db.Query(builder.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	items := make([]Item, 0, len(itemIds))
+	for result.Next() {
+		var item Item
+		var labels string
+		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels, &item.Comment, &item.IsHidden, &item.PublishAt, &item.ExpireAt, &item.Attributes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(labels), &item.Labels); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 // GetItems returns items from MySQL.
 func (d *SQLDatabase) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	var result *sql.Rows
 	var err error
 	if timeLimit == nil {
-		result, err = d.db.Query("SELECT item_id, time_stamp, labels, `comment` FROM items "+
+		result, err = d.db.Query("SELECT item_id, time_stamp, labels, `comment`, is_hidden, publish_at, expire_at, attributes FROM items "+
 			"WHERE item_id >= ? ORDER BY item_id LIMIT ?", cursor, n+1)
 	} else {
-		result, err = d.db.Query("SELECT item_id, time_stamp, labels, `comment` FROM items "+
+		result, err = d.db.Query("SELECT item_id, time_stamp, labels, `comment`, is_hidden, publish_at, expire_at, attributes FROM items "+
 			"WHERE item_id >= ? AND time_stamp >= ? ORDER BY item_id LIMIT ?", cursor, *timeLimit, n+1)
 	}
 	if err != nil {
@@ -231,7 +313,7 @@ func (d *SQLDatabase) GetItems(cursor string, n int, timeLimit *time.Time) (stri
 	for result.Next() {
 		var item Item
 		var labels string
-		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels, &item.Comment); err != nil {
+		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels, &item.Comment, &item.IsHidden, &item.PublishAt, &item.ExpireAt, &item.Attributes); err != nil {
 			return "", nil, err
 		}
 		if err := json.Unmarshal([]byte(labels), &item.Labels); err != nil {
@@ -251,7 +333,7 @@ func (d *SQLDatabase) GetItemFeedback(itemId string, feedbackTypes ...string) ([
 	var result *sql.Rows
 	var err error
 	var builder strings.Builder
-	builder.WriteString("SELECT user_id, item_id, feedback_type FROM feedback WHERE item_id = ?")
+	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, value, `comment`, `context` FROM feedback WHERE item_id = ?")
 	args := []interface{}{itemId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
@@ -271,7 +353,11 @@ func (d *SQLDatabase) GetItemFeedback(itemId string, feedbackTypes ...string) ([
 	feedbacks := make([]Feedback, 0)
 	for result.Next() {
 		var feedback Feedback
-		if err := result.Scan(&feedback.UserId, &feedback.ItemId, &feedback.FeedbackType); err != nil {
+		var feedbackContext sql.NullString
+		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Value, &feedback.Comment, &feedbackContext); err != nil {
+			return nil, err
+		}
+		if err := unmarshalContext(feedbackContext, &feedback); err != nil {
 			return nil, err
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -290,9 +376,9 @@ func (d *SQLDatabase) InsertUser(user User) error {
 	if err != nil {
 		return err
 	}
-	_, err = d.db.Exec("INSERT users(user_id, labels, subscribe, `comment`) VALUES (?, ?, ?, ?) "+
-		"ON DUPLICATE KEY UPDATE labels = ?, subscribe = ?, `comment` = ?",
-		user.UserId, labels, subscribe, user.Comment, labels, subscribe, user.Comment)
+	_, err = d.db.Exec("INSERT users(user_id, labels, subscribe, `comment`, attributes) VALUES (?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE labels = ?, subscribe = ?, `comment` = ?, attributes = ?",
+		user.UserId, labels, subscribe, user.Comment, user.Attributes, labels, subscribe, user.Comment, user.Attributes)
 	return err
 }
 
@@ -321,7 +407,7 @@ func (d *SQLDatabase) DeleteUser(userId string) error {
 
 // GetUser returns a user from MySQL.
 func (d *SQLDatabase) GetUser(userId string) (User, error) {
-	result, err := d.db.Query("SELECT user_id, labels, subscribe, `comment` FROM users WHERE user_id = ?", userId)
+	result, err := d.db.Query("SELECT user_id, labels, subscribe, `comment`, attributes FROM users WHERE user_id = ?", userId)
 	if err != nil {
 		return User{}, err
 	}
@@ -330,7 +416,7 @@ func (d *SQLDatabase) GetUser(userId string) (User, error) {
 		var user User
 		var labels string
 		var subscribe string
-		if err := result.Scan(&user.UserId, &labels, &subscribe, &user.Comment); err != nil {
+		if err := result.Scan(&user.UserId, &labels, &subscribe, &user.Comment, &user.Attributes); err != nil {
 			return User{}, err
 		}
 		if err := json.Unmarshal([]byte(labels), &user.Labels); err != nil {
@@ -346,7 +432,7 @@ func (d *SQLDatabase) GetUser(userId string) (User, error) {
 
 // GetUsers returns users from MySQL.
 func (d *SQLDatabase) GetUsers(cursor string, n int) (string, []User, error) {
-	result, err := d.db.Query("SELECT user_id, labels, subscribe, `comment` FROM users "+
+	result, err := d.db.Query("SELECT user_id, labels, subscribe, `comment`, attributes FROM users "+
 		"WHERE user_id >= ? ORDER BY user_id LIMIT ?", cursor, n+1)
 	if err != nil {
 		return "", nil, err
@@ -357,7 +443,7 @@ func (d *SQLDatabase) GetUsers(cursor string, n int) (string, []User, error) {
 		var user User
 		var labels string
 		var subscribe string
-		if err := result.Scan(&user.UserId, &labels, &subscribe, &user.Comment); err != nil {
+		if err := result.Scan(&user.UserId, &labels, &subscribe, &user.Comment, &user.Attributes); err != nil {
 			return "", nil, err
 		}
 		if err := json.Unmarshal([]byte(labels), &user.Labels); err != nil {
@@ -380,7 +466,7 @@ func (d *SQLDatabase) GetUserFeedback(userId string, feedbackTypes ...string) ([
 	var result *sql.Rows
 	var err error
 	var builder strings.Builder
-	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE user_id = ?")
+	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, value, `comment`, `context` FROM feedback WHERE user_id = ?")
 	args := []interface{}{userId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
@@ -400,7 +486,11 @@ func (d *SQLDatabase) GetUserFeedback(userId string, feedbackTypes ...string) ([
 	feedbacks := make([]Feedback, 0)
 	for result.Next() {
 		var feedback Feedback
-		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+		var feedbackContext sql.NullString
+		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Value, &feedback.Comment, &feedbackContext); err != nil {
+			return nil, err
+		}
+		if err := unmarshalContext(feedbackContext, &feedback); err != nil {
 			return nil, err
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -445,9 +535,14 @@ func (d *SQLDatabase) InsertFeedback(feedback Feedback, insertUser, insertItem b
 		}
 	}
 	// insert feedback
-	_, err := d.db.Exec("INSERT feedback(feedback_type, user_id, item_id, time_stamp, `comment`) VALUES (?,?,?,?,?) "+
-		"ON DUPLICATE KEY UPDATE time_stamp = ?, `comment` = ?",
-		feedback.FeedbackType, feedback.UserId, feedback.ItemId, feedback.Timestamp, feedback.Comment, feedback.Timestamp, feedback.Comment)
+	feedbackContext, err := json.Marshal(feedback.Context)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec("INSERT feedback(feedback_type, user_id, item_id, time_stamp, value, `comment`, `context`) VALUES (?,?,?,?,?,?,?) "+
+		"ON DUPLICATE KEY UPDATE time_stamp = ?, value = ?, `comment` = ?, `context` = ?",
+		feedback.FeedbackType, feedback.UserId, feedback.ItemId, feedback.Timestamp, feedback.Value, feedback.Comment, feedbackContext,
+		feedback.Timestamp, feedback.Value, feedback.Comment, feedbackContext)
 	InsertFeedbackLatency.Observe(time.Since(startTime).Seconds())
 	return err
 }
@@ -528,18 +623,22 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 	for i := 0; i < len(feedback); i += batchSize {
 		batchFeedback := feedback[i:base.Min(i+batchSize, len(feedback))]
 		builder := strings.Builder{}
-		builder.WriteString("INSERT feedback(feedback_type, user_id, item_id, time_stamp, `comment`) VALUES ")
+		builder.WriteString("INSERT feedback(feedback_type, user_id, item_id, time_stamp, value, `comment`, `context`) VALUES ")
 		var args []interface{}
 		for i, f := range batchFeedback {
 			if users.Has(f.UserId) && items.Has(f.ItemId) {
-				builder.WriteString("(?,?,?,?,?)")
+				feedbackContext, err := json.Marshal(f.Context)
+				if err != nil {
+					return err
+				}
+				builder.WriteString("(?,?,?,?,?,?,?)")
 				if i+1 < len(batchFeedback) {
 					builder.WriteString(",")
 				}
-				args = append(args, f.FeedbackType, f.UserId, f.ItemId, f.Timestamp, f.Comment)
+				args = append(args, f.FeedbackType, f.UserId, f.ItemId, f.Timestamp, f.Value, f.Comment, feedbackContext)
 			}
 		}
-		builder.WriteString(" AS new ON DUPLICATE KEY UPDATE time_stamp = new.time_stamp, `comment` = new.`comment`")
+		builder.WriteString(" AS new ON DUPLICATE KEY UPDATE time_stamp = new.time_stamp, value = new.value, `comment` = new.`comment`, `context` = new.`context`")
 		_, err := d.db.Exec(builder.String(), args...)
 		if err != nil {
 			return err
@@ -548,6 +647,14 @@ func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, inser
 	return nil
 }
 
+// unmarshalContext decodes context labels of feedback stored as JSON. NULL is left by previous versions.
+func unmarshalContext(feedbackContext sql.NullString, feedback *Feedback) error {
+	if !feedbackContext.Valid {
+		return nil
+	}
+	return json.Unmarshal([]byte(feedbackContext.String), &feedback.Context)
+}
+
 // GetFeedback returns feedback from MySQL.
 func (d *SQLDatabase) GetFeedback(cursor string, n int, timeLimit *time.Time, feedbackTypes ...string) (string, []Feedback, error) {
 	var cursorKey FeedbackKey
@@ -559,7 +666,7 @@ func (d *SQLDatabase) GetFeedback(cursor string, n int, timeLimit *time.Time, fe
 	var result *sql.Rows
 	var err error
 	var builder strings.Builder
-	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE feedback_type >= ? AND user_id >= ? AND item_id >= ?")
+	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, value, `comment`, `context` FROM feedback WHERE feedback_type >= ? AND user_id >= ? AND item_id >= ?")
 	args := []interface{}{cursorKey.FeedbackType, cursorKey.UserId, cursorKey.ItemId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
@@ -585,7 +692,11 @@ func (d *SQLDatabase) GetFeedback(cursor string, n int, timeLimit *time.Time, fe
 	feedbacks := make([]Feedback, 0)
 	for result.Next() {
 		var feedback Feedback
-		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+		var feedbackContext sql.NullString
+		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Value, &feedback.Comment, &feedbackContext); err != nil {
+			return "", nil, err
+		}
+		if err := unmarshalContext(feedbackContext, &feedback); err != nil {
 			return "", nil, err
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -607,7 +718,7 @@ func (d *SQLDatabase) GetUserItemFeedback(userId, itemId string, feedbackTypes .
 	var result *sql.Rows
 	var err error
 	var builder strings.Builder
-	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE user_id = ? AND item_id = ?")
+	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, value, `comment`, `context` FROM feedback WHERE user_id = ? AND item_id = ?")
 	args := []interface{}{userId, itemId}
 	if len(feedbackTypes) > 0 {
 		builder.WriteString(" AND feedback_type IN (")
@@ -627,7 +738,11 @@ func (d *SQLDatabase) GetUserItemFeedback(userId, itemId string, feedbackTypes .
 	feedbacks := make([]Feedback, 0)
 	for result.Next() {
 		var feedback Feedback
-		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+		var feedbackContext sql.NullString
+		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Value, &feedback.Comment, &feedbackContext); err != nil {
+			return nil, err
+		}
+		if err = unmarshalContext(feedbackContext, &feedback); err != nil {
 			return nil, err
 		}
 		feedbacks = append(feedbacks, feedback)
@@ -0,0 +1,162 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"time"
+
+	"github.com/scylladb/go-set/strset"
+	"github.com/zhenghaoz/gorse/storage/cache"
+)
+
+// loadPinnedItems returns pinned items which exist and are available, that is they aren't hidden, unpublished or
+// expired. Pinned items are kept in the configured order.
+func (w *Worker) loadPinnedItems(unavailableSet *strset.Set) ([]string, error) {
+	if len(w.cfg.Recommend.PinnedItems) == 0 {
+		return nil, nil
+	}
+	items, err := w.dataClient.BatchGetItems(w.cfg.Recommend.PinnedItems)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	availableSet := strset.New()
+	for _, item := range items {
+		if !item.IsHidden && item.IsAvailable(now) && !unavailableSet.Has(item.ItemId) {
+			availableSet.Add(item.ItemId)
+		}
+	}
+	pinnedItems := make([]string, 0, availableSet.Size())
+	for _, itemId := range w.cfg.Recommend.PinnedItems {
+		if availableSet.Has(itemId) {
+			pinnedItems = append(pinnedItems, itemId)
+		}
+	}
+	return pinnedItems, nil
+}
+
+// rerank re-ranks recommended items by business rules before saving them to cache:
+// 1. Relevance of an item comes from its position in the list and multiplied by its boost factor.
+// 2. Items are selected by maximal marginal relevance (MMR) on labels if diversity is enabled.
+// 3. Items with a label are skipped once there are enough items with this label.
+// 4. Pinned items are placed in front of the list except excluded items such as items in the history.
+// The re-ranked list is truncated to the cache size.
+func (w *Worker) rerank(items []cache.ScoredItem, excludeSet *strset.Set, pinnedItems []string) ([]cache.ScoredItem, error) {
+	lambda := w.cfg.Recommend.DiversityLambda
+	maxItemsPerLabel := w.cfg.Recommend.MaxItemsPerLabel
+	// load labels of items
+	itemLabels := make(map[string][]string)
+	if lambda > 0 || maxItemsPerLabel > 0 {
+		itemIds := make([]string, len(items))
+		for i, item := range items {
+			itemIds[i] = item.ItemId
+		}
+		details, err := w.dataClient.BatchGetItems(itemIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, detail := range details {
+			itemLabels[detail.ItemId] = detail.Labels
+		}
+	}
+	labels := make([]*strset.Set, len(items))
+	for i, item := range items {
+		labels[i] = strset.New(itemLabels[item.ItemId]...)
+	}
+	// calculate relevance
+	relevance := make([]float32, len(items))
+	for i, item := range items {
+		relevance[i] = 1 - float32(i)/float32(len(items))
+		if factor, exist := w.cfg.Recommend.BoostedItems[item.ItemId]; exist {
+			relevance[i] *= factor
+			items[i].Score *= factor
+		}
+	}
+	// pin items
+	results := make([]cache.ScoredItem, 0, len(items)+len(pinnedItems))
+	pinnedSet := strset.New()
+	var topScore float32
+	if len(items) > 0 {
+		topScore = items[0].Score
+	}
+	for _, itemId := range pinnedItems {
+		if !excludeSet.Has(itemId) && !pinnedSet.Has(itemId) {
+			pinnedSet.Add(itemId)
+			results = append(results, cache.ScoredItem{ItemId: itemId, Score: topScore})
+		}
+	}
+	// select items by maximal marginal relevance
+	selected := make([]bool, len(items))
+	labelCount := make(map[string]int)
+	var selectedLabels []*strset.Set
+	for {
+		best, bestScore := -1, float32(0)
+		for i := range items {
+			if selected[i] || pinnedSet.Has(items[i].ItemId) {
+				continue
+			}
+			// check max items per label
+			if maxItemsPerLabel > 0 && exceedLabelCount(labels[i], labelCount, maxItemsPerLabel) {
+				continue
+			}
+			score := relevance[i]
+			if lambda > 0 {
+				var maxSimilarity float32
+				for _, other := range selectedLabels {
+					if similarity := jaccard(labels[i], other); similarity > maxSimilarity {
+						maxSimilarity = similarity
+					}
+				}
+				score = (1-lambda)*relevance[i] - lambda*maxSimilarity
+			}
+			if best == -1 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best == -1 {
+			break
+		}
+		selected[best] = true
+		selectedLabels = append(selectedLabels, labels[best])
+		labels[best].Each(func(label string) bool {
+			labelCount[label]++
+			return true
+		})
+		results = append(results, items[best])
+	}
+	if w.cfg.Database.CacheSize > 0 && len(results) > w.cfg.Database.CacheSize {
+		results = results[:w.cfg.Database.CacheSize]
+	}
+	return results, nil
+}
+
+// exceedLabelCount returns true if any label has been recommended enough times.
+func exceedLabelCount(labels *strset.Set, labelCount map[string]int, maxCount int) bool {
+	exceed := false
+	labels.Each(func(label string) bool {
+		exceed = labelCount[label] >= maxCount
+		return !exceed
+	})
+	return exceed
+}
+
+// jaccard computes the Jaccard similarity between two sets of labels.
+func jaccard(a, b *strset.Set) float32 {
+	if a.IsEmpty() && b.IsEmpty() {
+		return 0
+	}
+	intersect := strset.Intersection(a, b).Size()
+	return float32(intersect) / float32(a.Size()+b.Size()-intersect)
+}
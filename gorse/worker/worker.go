@@ -27,6 +27,8 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -42,6 +44,11 @@ import (
 	"google.golang.org/grpc"
 )
 
+const (
+	numIndexIter          = 10
+	numIndexRecallQueries = 100
+)
+
 // Worker manages states of a worker node.
 type Worker struct {
 	// worker config
@@ -71,7 +78,9 @@ type Worker struct {
 	// ranking model
 	latestRankingModelVersion  int64
 	currentRankingModelVersion int64
+	rankingModelMutex          sync.RWMutex
 	rankingModel               ranking.Model
+	rankingIndex               ranking.VectorIndex // vector index built for rankingModel
 
 	// click model
 	latestClickModelVersion  int64
@@ -229,10 +238,14 @@ func (w *Worker) Pull() {
 				}, grpc.MaxCallRecvMsgSize(10e8)); err != nil {
 				base.Logger().Error("failed to pull ranking model", zap.Error(err))
 			} else {
-				w.rankingModel, err = ranking.DecodeModel(rankingResponse.Name, rankingResponse.Model)
+				rankingModel, err := ranking.DecodeModel(rankingResponse.Name, rankingResponse.Model)
 				if err != nil {
 					base.Logger().Error("failed to decode ranking model", zap.Error(err))
 				} else {
+					rankingIndex := w.buildRankingIndex(rankingModel)
+					w.rankingModelMutex.Lock()
+					w.rankingModel, w.rankingIndex = rankingModel, rankingIndex
+					w.rankingModelMutex.Unlock()
 					w.currentRankingModelVersion = rankingResponse.Version
 					base.Logger().Info("synced ranking model",
 						zap.String("version", base.Hex(w.currentRankingModelVersion)))
@@ -327,8 +340,11 @@ func (w *Worker) Serve() {
 			}
 
 			// recommendation
-			if w.rankingModel != nil {
-				w.Recommend(w.rankingModel, workingUsers)
+			w.rankingModelMutex.RLock()
+			rankingModel := w.rankingModel
+			w.rankingModelMutex.RUnlock()
+			if rankingModel != nil {
+				w.Recommend(rankingModel, workingUsers)
 			} else {
 				base.Logger().Debug("local ranking model doesn't exist")
 			}
@@ -348,7 +364,7 @@ func (w *Worker) Serve() {
 // Recommend items to users. The workflow of recommendation is:
 // 1. Skip inactive users.
 // 2. Load historical items.
-// 3. Load positive items if KNN used.
+// 3. Load positive items if item-based models (KNN, EASE or SLIM) used.
 // 4. Generate recommendation.
 // 5. Save result.
 // 6. Insert cold-start items into results.
@@ -362,6 +378,19 @@ func (w *Worker) Recommend(m ranking.Model, users []string) {
 	}
 	// load item index
 	itemIds := m.GetItemIndex().GetNames()
+	// load vector index built for the model
+	rankingIndex := w.getRankingIndex(m)
+	// load hidden items and unavailable items
+	hiddenSet, err := w.loadUnavailableItems()
+	if err != nil {
+		base.Logger().Error("failed to load unavailable items", zap.Error(err))
+		return
+	}
+	pinnedItems, err := w.loadPinnedItems(hiddenSet)
+	if err != nil {
+		base.Logger().Error("failed to load pinned items", zap.Error(err))
+		return
+	}
 	base.Logger().Info("ranking recommendation",
 		zap.Int("n_working_users", len(users)),
 		zap.Int("n_items", len(itemIds)),
@@ -410,7 +439,7 @@ func (w *Worker) Recommend(m ranking.Model, users []string) {
 		}
 		// load positive items
 		var positiveItemIndices []int
-		if _, ok := m.(*ranking.KNN); ok {
+		if _, ok := m.(ranking.ItemBasedModel); ok {
 			favoredItems, err := loadUserHistoricalItems(w.dataClient, userId, w.cfg.Database.PositiveFeedbackType...)
 			if err != nil {
 				base.Logger().Error("failed to pull user feedback",
@@ -423,19 +452,33 @@ func (w *Worker) Recommend(m ranking.Model, users []string) {
 					positiveItemIndices = append(positiveItemIndices, itemIndex)
 				}
 			}
+			// score candidates by the most recent items
+			if sequentialModel, ok := m.(ranking.SequentialModel); ok {
+				positiveItemIndices = ranking.RecentItems(positiveItemIndices, sequentialModel.SequenceLength())
+			}
 		}
 		// generate recommendation
 		recItems := base.NewTopKStringFilter(w.cfg.Database.CacheSize)
-		for itemIndex, itemId := range itemIds {
-			if !historySet.Has(itemId) {
-				switch m := m.(type) {
-				case ranking.MatrixFactorization:
-					recItems.Push(itemId, m.InternalPredict(userIndex, itemIndex))
-				case *ranking.KNN:
-					recItems.Push(itemId, m.InternalPredict(positiveItemIndices, itemIndex))
-				default:
-					base.Logger().Error("unknown model type",
-						zap.String("type", reflect.TypeOf(m).String()))
+		if factorModel, ok := m.(ranking.FactorModel); ok && rankingIndex != nil && userIndex != base.NotId {
+			// retrieve candidates from vector index
+			indices, scores := rankingIndex.Search(factorModel.GetUserFactor(userIndex), w.cfg.Database.CacheSize+historySet.Size()+hiddenSet.Size())
+			for i, itemIndex := range indices {
+				if itemId := itemIds[itemIndex]; !historySet.Has(itemId) && !hiddenSet.Has(itemId) {
+					recItems.Push(itemId, scores[i])
+				}
+			}
+		} else {
+			for itemIndex, itemId := range itemIds {
+				if !historySet.Has(itemId) && !hiddenSet.Has(itemId) {
+					switch m := m.(type) {
+					case ranking.MatrixFactorization:
+						recItems.Push(itemId, m.InternalPredict(userIndex, itemIndex))
+					case ranking.ItemBasedModel:
+						recItems.Push(itemId, m.InternalPredict(positiveItemIndices, itemIndex))
+					default:
+						base.Logger().Error("unknown model type",
+							zap.String("type", reflect.TypeOf(m).String()))
+					}
 				}
 			}
 		}
@@ -444,12 +487,12 @@ func (w *Worker) Recommend(m ranking.Model, users []string) {
 		// insert cold-start items
 		if w.cfg.Recommend.ExploreLatestNum > 0 {
 			candidateSet := strset.New(candidateItems...)
-			latestItems, err := w.cacheClient.GetScores(cache.LatestItems, "", 0, w.cfg.Recommend.ExploreLatestNum-1)
+			latestItems, err := w.cacheClient.GetSortedScores(cache.LatestItems, "", 0, w.cfg.Recommend.ExploreLatestNum-1)
 			if err != nil {
 				return err
 			}
 			for _, latestItem := range latestItems {
-				if !candidateSet.Has(latestItem.ItemId) && !historySet.Has(latestItem.ItemId) {
+				if !candidateSet.Has(latestItem.ItemId) && !historySet.Has(latestItem.ItemId) && !hiddenSet.Has(latestItem.ItemId) {
 					candidateItems = append(candidateItems, latestItem.ItemId)
 				}
 			}
@@ -464,6 +507,12 @@ func (w *Worker) Recommend(m ranking.Model, users []string) {
 		} else {
 			result = w.randomInsertLatestItem(candidateItems, candidateScores)
 		}
+		// re-rank items by business rules
+		result, err = w.rerank(result, strset.Union(historySet, hiddenSet), pinnedItems)
+		if err != nil {
+			base.Logger().Error("failed to re-rank recommendation", zap.Error(err))
+			return err
+		}
 		if err = w.cacheClient.SetScores(cache.RecommendItems, userId, result); err != nil {
 			base.Logger().Error("failed to cache recommendation", zap.Error(err))
 			return err
@@ -484,6 +533,46 @@ func (w *Worker) Recommend(m ranking.Model, users []string) {
 		zap.String("used_time", time.Since(startTime).String()))
 }
 
+// loadUnavailableItems returns hidden items and scheduled items not published or expired.
+func (w *Worker) loadUnavailableItems() (*strset.Set, error) {
+	return cache.UnavailableItems(w.cacheClient, time.Now())
+}
+
+// getRankingIndex returns the vector index built for the ranking model. Nil is returned if the index is disabled
+// or the model has been replaced by a newly pulled model.
+func (w *Worker) getRankingIndex(m ranking.Model) ranking.VectorIndex {
+	w.rankingModelMutex.RLock()
+	defer w.rankingModelMutex.RUnlock()
+	if w.rankingModel != m {
+		return nil
+	}
+	return w.rankingIndex
+}
+
+// buildRankingIndex builds the vector index over item factors if the index is enabled and the ranking model
+// is a matrix factorization model. The recall of the index is checked against brute force search, and the index
+// is dropped if its recall is less than the min recall so that all items are scored.
+func (w *Worker) buildRankingIndex(m ranking.Model) ranking.VectorIndex {
+	factorModel, ok := m.(ranking.FactorModel)
+	if !w.cfg.Recommend.EnableIndex || !ok {
+		return nil
+	}
+	startTime := time.Now()
+	index := ranking.NewIVF(ranking.ItemFactors(factorModel),
+		w.cfg.Recommend.IndexClusters, w.cfg.Recommend.IndexProbes, numIndexIter, w.jobs, 0)
+	recall := ranking.EvaluateIndex(factorModel, index, w.cfg.Database.CacheSize, numIndexRecallQueries)
+	if recall < w.cfg.Recommend.IndexMinRecall {
+		base.Logger().Warn("recall of vector index is too low, score all items",
+			zap.Float32("recall", recall),
+			zap.Float32("min_recall", w.cfg.Recommend.IndexMinRecall))
+		return nil
+	}
+	base.Logger().Info("build vector index",
+		zap.Float32("recall", recall),
+		zap.Duration("build_time", time.Since(startTime)))
+	return index
+}
+
 // randomInsertLatestItem inserts latest items to the recommendation list randomly. Latest items
 // are located at itemIds[len(scores):len(itemIds)]
 func (w *Worker) randomInsertLatestItem(itemIds []string, scores []float32) []cache.ScoredItem {
@@ -511,7 +600,7 @@ func (w *Worker) rankByClickTroughRate(userId string, itemIds []string) ([]cache
 	// rank by CTR
 	topItems := base.NewTopKStringFilter(w.cfg.Database.CacheSize)
 	for _, item := range items {
-		topItems.Push(item.ItemId, w.clickModel.Predict(userId, item.ItemId, item.Labels))
+		topItems.Push(item.ItemId, w.clickModel.Predict(userId, item.ItemId, item.Labels, item.Attributes, nil))
 	}
 	elems, scores := topItems.PopAll()
 	return cache.CreateScoredItems(elems, scores), nil
@@ -551,12 +640,16 @@ func (w *Worker) checkRecommendCacheTimeout(userId string) bool {
 	return true
 }
 
+// loadUserHistoricalItems loads items of a user in chronological order.
 func loadUserHistoricalItems(database data.Database, userId string, feedbackTypes ...string) ([]string, error) {
 	items := make([]string, 0)
 	feedbacks, err := database.GetUserFeedback(userId, feedbackTypes...)
 	if err != nil {
 		return nil, err
 	}
+	sort.SliceStable(feedbacks, func(i, j int) bool {
+		return feedbacks[i].Timestamp.Before(feedbacks[j].Timestamp)
+	})
 	for _, feedback := range feedbacks {
 		items = append(items, feedback.ItemId)
 	}
@@ -20,6 +20,7 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"github.com/alicebob/miniredis/v2"
+	"github.com/scylladb/go-set/strset"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
@@ -184,6 +185,43 @@ func TestRecommendMatrixFactorization(t *testing.T) {
 	assert.Equal(t, []string{"4", "6", "8"}, read)
 }
 
+func TestRecommendUnavailableItems(t *testing.T) {
+	// create mock worker
+	w := newMockWorker(t)
+	defer w.Close(t)
+	// insert feedbacks
+	err := w.dataClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "9"}, Timestamp: time.Now()},
+	}, true, true)
+	assert.Nil(t, err)
+	// hide items
+	err = w.cacheClient.AddSet(cache.HiddenItems, "", "8", "6")
+	assert.Nil(t, err)
+	// schedule items
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	err = w.cacheClient.AddSorted(cache.UnpublishedItems, "", map[string]float64{
+		"7": cache.TimeScore(past),
+		"5": cache.TimeScore(future),
+	})
+	assert.Nil(t, err)
+	err = w.cacheClient.AddSorted(cache.ExpiringItems, "", map[string]float64{"3": cache.TimeScore(past)})
+	assert.Nil(t, err)
+	// pin items, pinned items not existed are skipped
+	err = w.dataClient.BatchInsertItem([]data.Item{{ItemId: "0"}, {ItemId: "6"}})
+	assert.Nil(t, err)
+	w.cfg.Database.CacheSize = 3
+	w.cfg.Recommend.PinnedItems = []string{"6", "0", "10"}
+	m := newMockMatrixFactorizationForRecommend(1, 10)
+	w.Recommend(m, []string{"0"})
+	recommends, err := w.cacheClient.GetScores(cache.RecommendItems, "0", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{"0", 7},
+		{"7", 7},
+		{"4", 4},
+	}, recommends)
+}
+
 func marshal(t *testing.T, v interface{}) string {
 	s, err := json.Marshal(v)
 	assert.Nil(t, err)
@@ -333,3 +371,140 @@ func TestWorker_Sync(t *testing.T) {
 	assert.Equal(t, int64(3), serv.currentUserIndexVersion)
 	master.Stop()
 }
+
+func TestRerank(t *testing.T) {
+	// create mock worker
+	w := newMockWorker(t)
+	defer w.Close(t)
+	// insert items
+	err := w.dataClient.BatchInsertItem([]data.Item{
+		{ItemId: "1", Labels: []string{"a"}},
+		{ItemId: "2", Labels: []string{"a"}},
+		{ItemId: "3", Labels: []string{"a"}},
+		{ItemId: "4", Labels: []string{"b"}},
+		{ItemId: "5", Labels: []string{"b"}},
+		{ItemId: "6", IsHidden: true},
+		{ItemId: "7"},
+		{ItemId: "9"},
+	})
+	assert.Nil(t, err)
+	items := func() []cache.ScoredItem {
+		return []cache.ScoredItem{
+			{ItemId: "1", Score: 5},
+			{ItemId: "2", Score: 4},
+			{ItemId: "3", Score: 3},
+			{ItemId: "4", Score: 2},
+			{ItemId: "5", Score: 1},
+		}
+	}
+	historySet := strset.New("9")
+	// keep order by default
+	result, err := w.rerank(items(), historySet, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, items(), result)
+	// max items per label
+	w.cfg.Recommend.MaxItemsPerLabel = 2
+	result, err = w.rerank(items(), historySet, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2", "4", "5"}, cache.RemoveScores(result))
+	// label diversity
+	w.cfg.Recommend.MaxItemsPerLabel = 0
+	w.cfg.Recommend.DiversityLambda = 0.5
+	result, err = w.rerank(items(), historySet, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "4", "2", "3", "5"}, cache.RemoveScores(result))
+	// boosted and pinned items
+	w.cfg.Recommend.DiversityLambda = 0
+	w.cfg.Recommend.BoostedItems = map[string]float32{"5": 10}
+	w.cfg.Recommend.PinnedItems = []string{"8", "9", "3", "6", "7"}
+	pinnedItems, err := w.loadPinnedItems(strset.New("7"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"9", "3"}, pinnedItems)
+	result, err = w.rerank(items(), historySet, pinnedItems)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{ItemId: "3", Score: 5},
+		{ItemId: "5", Score: 10},
+		{ItemId: "1", Score: 5},
+		{ItemId: "2", Score: 4},
+		{ItemId: "4", Score: 2},
+	}, result)
+	// truncate to the cache size
+	w.cfg.Database.CacheSize = 3
+	result, err = w.rerank(items(), historySet, pinnedItems)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3", "5", "1"}, cache.RemoveScores(result))
+}
+
+func TestRecommendVectorIndex(t *testing.T) {
+	// create mock worker
+	w := newMockWorker(t)
+	defer w.Close(t)
+	w.cfg.Database.CacheSize = 3
+	w.cfg.Recommend.EnableIndex = true
+	w.cfg.Recommend.IndexClusters = 2
+	w.cfg.Recommend.IndexProbes = 2
+	// insert feedbacks
+	err := w.dataClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "9"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "7"}},
+	}, true, true)
+	assert.Nil(t, err)
+	// create model with factors
+	m := ranking.NewBPR(nil)
+	m.UserIndex = base.NewMapIndex()
+	m.UserIndex.Add("0")
+	m.UserFactor = [][]float32{{1}}
+	m.ItemIndex = base.NewMapIndex()
+	for i := 0; i < 10; i++ {
+		m.ItemIndex.Add(strconv.Itoa(i))
+		m.ItemFactor = append(m.ItemFactor, []float32{float32(i)})
+	}
+	w.rankingModel, w.rankingIndex = m, w.buildRankingIndex(m)
+	assert.NotNil(t, w.rankingIndex)
+	w.Recommend(m, []string{"0"})
+	recommends, err := w.cacheClient.GetScores(cache.RecommendItems, "0", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{ItemId: "8", Score: 8},
+		{ItemId: "6", Score: 6},
+		{ItemId: "5", Score: 5},
+	}, recommends)
+	// index built for a replaced model isn't used
+	assert.Nil(t, w.getRankingIndex(ranking.NewBPR(nil)))
+	// index with low recall isn't used
+	w.cfg.Recommend.IndexMinRecall = 1.1
+	assert.Nil(t, w.buildRankingIndex(m))
+	// disable vector index
+	w.cfg.Recommend.EnableIndex = false
+	assert.Nil(t, w.buildRankingIndex(m))
+}
+
+func TestRecommendSequential(t *testing.T) {
+	// create mock worker
+	w := newMockWorker(t)
+	defer w.Close(t)
+	w.cfg.Database.CacheSize = 3
+	w.cfg.Database.PositiveFeedbackType = []string{"click"}
+	// insert feedbacks
+	now := time.Now()
+	err := w.dataClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "5"}, Timestamp: now},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "2"}, Timestamp: now.Add(-time.Hour)},
+	}, true, true)
+	assert.Nil(t, err)
+	// create model where item i is followed by item i+1
+	m := ranking.NewFMC(model.Params{model.Window: 1})
+	m.ItemIndex = base.NewMapIndex()
+	for i := 0; i < 10; i++ {
+		m.ItemIndex.Add(strconv.Itoa(i))
+		m.NextFactor = append(m.NextFactor, make([]float32, 10))
+		m.NextFactor[i][i] = 1
+		m.PrevFactor = append(m.PrevFactor, make([]float32, 10))
+		m.PrevFactor[i][(i+1)%10] = 1
+	}
+	w.Recommend(m, []string{"0"})
+	recommends, err := w.cacheClient.GetScores(cache.RecommendItems, "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "6", Score: 1}}, recommends)
+}